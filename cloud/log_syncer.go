@@ -71,47 +71,32 @@ func (s *LogSyncer) NewBuffer(channel LogChannel, out io.Writer) io.Writer {
 		linenum := int64(1)
 		syncDisabled := false
 
-		var pending []byte
 		errs := errors.L()
-		for {
-			lines, rest, readErr := readLines(r, pending)
-			if readErr != nil && readErr != io.EOF {
-				errs.Append(readErr)
-				break
-			}
-			if readErr == io.EOF && len(rest) > 0 {
-				lines = [][]byte{rest}
+		errs.Append(forEachLine(r, func(line []byte) {
+			_, err := out.Write(line)
+			if err != nil {
+				errs.Append(errors.E(err, "writing to terminal"))
 			}
-			for _, line := range lines {
-				_, err := out.Write(line)
-				if err != nil {
-					errs.Append(errors.E(err, "writing to terminal"))
-				}
-
-				if syncDisabled {
-					continue
-				}
 
-				if !utf8.Valid(line) {
-					syncDisabled = true
-					errs.Append(errors.E("skipping sync of non-utf8 (%s) output", channel.String()))
-					continue
-				}
+			if syncDisabled {
+				return
+			}
 
-				t := time.Now().UTC()
-				s.in <- &DeploymentLog{
-					Channel:   channel,
-					Line:      linenum,
-					Message:   string(dropCRLN([]byte(line))),
-					Timestamp: &t,
-				}
-				linenum++
+			if !utf8.Valid(line) {
+				syncDisabled = true
+				errs.Append(errors.E("skipping sync of non-utf8 (%s) output", channel.String()))
+				return
 			}
-			if readErr == io.EOF {
-				break
+
+			t := time.Now().UTC()
+			s.in <- &DeploymentLog{
+				Channel:   channel,
+				Line:      linenum,
+				Message:   string(dropCRLN([]byte(line))),
+				Timestamp: &t,
 			}
-			pending = rest
-		}
+			linenum++
+		}))
 
 		errs.Append(r.Close())
 		errs.Append(w.Close())
@@ -173,6 +158,65 @@ func (s *LogSyncer) enqueue(l *DeploymentLog) {
 	}
 }
 
+// LineWriter is a writer which calls a function for each line written into
+// it, using the same line buffering of the LogSyncer buffers.
+type LineWriter struct {
+	w    *io.PipeWriter
+	done chan struct{}
+	err  error
+}
+
+// NewLineWriter creates a new LineWriter calling fn for each line written into
+// it. The line includes the line terminator, except for the last line if it
+// has none. The fn is never called concurrently.
+func NewLineWriter(fn func(line []byte)) *LineWriter {
+	r, w := io.Pipe()
+	lw := &LineWriter{
+		w:    w,
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(lw.done)
+		lw.err = forEachLine(r, fn)
+		_ = r.Close()
+	}()
+	return lw
+}
+
+// Write the data into the line writer.
+func (lw *LineWriter) Write(p []byte) (int, error) {
+	return lw.w.Write(p)
+}
+
+// Close the writer, processing the last line and waiting for all the lines to
+// be processed. After calling this method, the writer must not be used.
+func (lw *LineWriter) Close() error {
+	_ = lw.w.Close()
+	<-lw.done
+	return lw.err
+}
+
+// forEachLine reads r until EOF calling fn for each line read.
+func forEachLine(r io.Reader, fn func(line []byte)) error {
+	var pending []byte
+	for {
+		lines, rest, err := readLines(r, pending)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if err == io.EOF && len(rest) > 0 {
+			lines = append(lines, rest)
+		}
+		for _, line := range lines {
+			fn(line)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		pending = rest
+	}
+}
+
 func readLines(r io.Reader, pending []byte) (line [][]byte, rest []byte, err error) {
 	const readSize = 1024
 
@@ -483,3 +483,23 @@ func divideBatches(batches []cloud.DeploymentLogs) (stdoutLogs, stderrLogs cloud
 	}
 	return stdoutLogs, stderrLogs
 }
+
+func TestLineWriter(t *testing.T) {
+	t.Parallel()
+
+	var lines []string
+	w := cloud.NewLineWriter(func(line []byte) {
+		lines = append(lines, string(line))
+	})
+
+	for _, data := range []string{"a", "bc\nd", "ef\r\n\n", "last"} {
+		_, err := w.Write([]byte(data))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Close())
+
+	want := []string{"abc\n", "def\r\n", "\n", "last"}
+	if diff := cmp.Diff(want, lines); diff != "" {
+		t.Fatalf("lines mismatch: %s", diff)
+	}
+}
@@ -6,6 +6,7 @@ package cloud
 import (
 	"bytes"
 	"encoding/json"
+	"regexp"
 	"strings"
 	"time"
 
@@ -394,9 +395,16 @@ func (s Stack) Validate() error {
 	if strings.ToLower(s.MetaID) != s.MetaID {
 		return errors.E(`"meta_id" requires a lowercase string but %s provided`, s.MetaID)
 	}
+	if len(s.MetaID) > 64 || !metaIDRegex.MatchString(s.MetaID) {
+		return errors.E(`"meta_id" %q doesn't match %q with up to 64 characters`,
+			s.MetaID, metaIDRegex)
+	}
 	return nil
 }
 
+// metaIDRegex matches the stack ID optionally suffixed by "@<variant>".
+var metaIDRegex = regexp.MustCompile(`^[a-z0-9_-]+(@[a-z0-9_-]+)?$`)
+
 // Validate a drift.
 func (d Drift) Validate() error {
 	if err := d.Status.Validate(); err != nil {
@@ -11,7 +11,9 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -44,6 +46,7 @@ import (
 	prj "github.com/terramate-io/terramate/project"
 	"github.com/terramate-io/terramate/run"
 	"github.com/terramate-io/terramate/run/dag"
+	"github.com/terramate-io/terramate/run/lock"
 	"github.com/terramate-io/terramate/tf"
 	"github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/json"
@@ -110,6 +113,8 @@ type cliSpec struct {
 	Quiet          bool     `optional:"false" help:"Disable output"`
 	Verbose        int      `short:"v" optional:"true" default:"0" type:"counter" help:"Increase verboseness of output"`
 
+	ChangedIncludeWorktree bool `optional:"true" help:"Also consider the staged, unstaged and untracked files as changes when using --changed"`
+
 	DisableCheckGitUntracked   bool `optional:"true" default:"false" help:"Disable git check for untracked files"`
 	DisableCheckGitUncommitted bool `optional:"true" default:"false" help:"Disable git check for uncommitted files"`
 
@@ -135,22 +140,41 @@ type cliSpec struct {
 	} `cmd:"" help:"Format all files inside dir recursively"`
 
 	List struct {
-		Why                bool   `help:"Shows the reason why the stack has changed"`
-		ExperimentalStatus string `help:"Filter by status"`
+		Why                 bool   `help:"Shows the reason why the stack has changed"`
+		ExperimentalStatus  string `help:"Filter by status"`
+		IncludeDependencies bool   `help:"Include the stacks which must run before the selected stacks"`
+		IncludeDependents   bool   `help:"Include the stacks which must run after the selected stacks"`
 	} `cmd:"" help:"List stacks"`
 
 	Run struct {
-		CloudSyncDeployment        bool     `default:"false" help:"Enable synchronization of stack execution with the Terramate Cloud"`
-		CloudSyncDriftStatus       bool     `default:"false" help:"Enable drift detection and synchronization with the Terramate Cloud"`
-		CloudSyncTerraformPlanFile string   `default:"" help:"Enable sync of Terraform plan file"`
-		DisableCheckGenCode        bool     `default:"false" help:"Disable outdated generated code check"`
-		DisableCheckGitRemote      bool     `default:"false" help:"Disable checking if local default branch is updated with remote"`
-		ContinueOnError            bool     `default:"false" help:"Continue executing in other stacks in case of error"`
-		NoRecursive                bool     `default:"false" help:"Do not recurse into child stacks"`
-		DryRun                     bool     `default:"false" help:"Plan the execution but do not execute it"`
-		Reverse                    bool     `default:"false" help:"Reverse the order of execution"`
-		Eval                       bool     `default:"false" help:"Evaluate command line arguments as HCL strings"`
-		Command                    []string `arg:"" name:"cmd" predictor:"file" passthrough:"" help:"Command to execute"`
+		CloudSyncDeployment        bool          `default:"false" help:"Enable synchronization of stack execution with the Terramate Cloud"`
+		CloudSyncDriftStatus       bool          `default:"false" help:"Enable drift detection and synchronization with the Terramate Cloud"`
+		CloudSyncTerraformPlanFile string        `default:"" help:"Enable sync of Terraform plan file"`
+		DisableCheckGenCode        bool          `default:"false" help:"Disable outdated generated code check"`
+		DisableCheckGitRemote      bool          `default:"false" help:"Disable checking if local default branch is updated with remote"`
+		ContinueOnError            bool          `default:"false" help:"Continue executing in other stacks in case of error"`
+		Parallel                   int           `default:"1" help:"Maximum number of stacks executed concurrently, respecting the run order"`
+		Timeout                    time.Duration `default:"0s" help:"Maximum duration of the command in each stack (e.g. 30m). Overrides the configured timeout"`
+		GracePeriod                time.Duration `default:"10s" help:"Time given to the commands to exit after a timeout or a SIGTERM/SIGHUP, before they are killed"`
+		Retries                    int           `default:"0" help:"Number of times a failed command is retried in each stack"`
+		RetryDelay                 time.Duration `default:"5s" help:"Time to wait before retrying a failed command"`
+		RetryOnExitCode            []int         `optional:"true" help:"Only retry commands which exit with one of the given codes"`
+		RetryOnStderr              []string      `optional:"true" sep:"none" help:"Only retry commands whose stderr matches the given regex. Can be provided multiple times"`
+		NoRecursive                bool          `default:"false" help:"Do not recurse into child stacks"`
+		DryRun                     bool          `default:"false" help:"Plan the execution but do not execute it"`
+		Reverse                    bool          `default:"false" help:"Reverse the order of execution"`
+		Eval                       bool          `default:"false" help:"Evaluate command line arguments as HCL strings"`
+		ReportFile                 string        `predictor:"file" default:"" help:"Write a JSON report of the execution to the given file"`
+		JUnitFile                  string        `name:"junit-file" predictor:"file" default:"" help:"Write a JUnit XML report of the execution to the given file"`
+		Resume                     bool          `default:"false" help:"Resume the previous run, skipping the stacks which already succeeded with the same command and git commit"`
+		IncludeDependencies        bool          `default:"false" help:"Include the stacks which must run before the selected stacks"`
+		IncludeDependents          bool          `default:"false" help:"Include the stacks which must run after the selected stacks"`
+		LockTimeout                time.Duration `default:"0s" help:"Time to wait for the run lock held by another run in the same project"`
+		NoLock                     bool          `default:"false" help:"Do not acquire the run lock, allowing concurrent runs in the same project"`
+		OutputPrefix               bool          `default:"false" help:"Prefix each output line with the path of the stack which produced it"`
+		OutputPrefixColor          bool          `default:"false" help:"Color the output prefix of each stack. Requires --output-prefix"`
+		LogDir                     string        `predictor:"file" default:"" help:"Write the output of each stack into <log-dir>/<stack-path>.log"`
+		Command                    []string      `arg:"" name:"cmd" predictor:"file" passthrough:"" help:"Command to execute"`
 	} `cmd:"" help:"Run command in the stacks"`
 
 	Generate struct{} `cmd:"" help:"Generate terraform code for stacks"`
@@ -179,12 +203,14 @@ type cliSpec struct {
 		} `cmd:"" help:"Experimental generate commands"`
 
 		RunGraph struct {
-			Outfile string `short:"o" predictor:"file" default:"" help:"Output .dot file"`
+			Outfile string `short:"o" predictor:"file" default:"" help:"Output file"`
 			Label   string `short:"l" default:"stack.name" help:"Label used in graph nodes (it could be either \"stack.name\" or \"stack.dir\""`
+			Format  string `short:"f" default:"dot" enum:"dot,mermaid,json,text" help:"Output format: 'dot', 'mermaid', 'json' or 'text'"`
 		} `cmd:"" help:"Generate a graph of the execution order"`
 
 		RunOrder struct {
-			Basedir string `arg:"" optional:"true" help:"Base directory to search stacks"`
+			Basedir      string `arg:"" optional:"true" help:"Base directory to search stacks"`
+			CriticalPath bool   `default:"false" help:"Show the longest chain of dependent stacks and its estimated duration, from the run history"`
 		} `cmd:"" help:"Show the topological ordering of the stacks"`
 
 		RunEnv struct{} `cmd:"" help:"List run environment variables for all stacks"`
@@ -230,9 +256,15 @@ type cliSpec struct {
 				Labels []string `arg:"" name:"labels" passthrough:"" help:"Name of the script"`
 			} `cmd:"" help:"Show detailed information about a script"`
 			Run struct {
-				NoRecursive bool     `default:"false" help:"Do not recurse into child stacks"`
-				DryRun      bool     `default:"false" help:"Plan the execution but do not execute it"`
-				Labels      []string `arg:"" name:"labels" passthrough:"" help:"Script to execute"`
+				NoRecursive         bool          `default:"false" help:"Do not recurse into child stacks"`
+				DryRun              bool          `default:"false" help:"Plan the execution but do not execute it"`
+				ReportFile          string        `predictor:"file" default:"" help:"Write a JSON report of the execution to the given file"`
+				JUnitFile           string        `name:"junit-file" predictor:"file" default:"" help:"Write a JUnit XML report of the execution to the given file"`
+				IncludeDependencies bool          `default:"false" help:"Include the stacks which must run before the selected stacks"`
+				IncludeDependents   bool          `default:"false" help:"Include the stacks which must run after the selected stacks"`
+				LockTimeout         time.Duration `default:"0s" help:"Time to wait for the run lock held by another run in the same project"`
+				NoLock              bool          `default:"false" help:"Do not acquire the run lock, allowing concurrent runs in the same project"`
+				Labels              []string      `arg:"" name:"labels" passthrough:"" help:"Script to execute"`
 			} `cmd:"" help:"Run script in stacks"`
 		} `cmd:"" help:"Terramate Script commands"`
 	} `cmd:"" help:"Experimental features (may change or be removed in the future)"`
@@ -271,12 +303,18 @@ type cli struct {
 	stdin      io.Reader
 	stdout     io.Writer
 	stderr     io.Writer
+	outputMu   sync.Mutex
 	output     out.O
 	exit       bool
 	prj        project
 	httpClient http.Client
 	cloud      cloudConfig
 	uimode     UIMode
+	runReport  *runReport
+	runState   *runState
+	runHistory *runHistory
+	runLock    *lock.Lock
+	runRetry   retryPolicy
 
 	checkpointResults chan *checkpoint.CheckResponse
 
@@ -497,6 +535,16 @@ Please see https://terramate.io/docs/cli/configuration/project-setup for details
 		log.Fatal().Msg("flag --changed provided but no git repository found")
 	}
 
+	if parsedArgs.ChangedIncludeWorktree && !parsedArgs.Changed {
+		log.Fatal().Msg("the --changed-include-worktree flag must be used together with --changed")
+	}
+
+	if parsedArgs.ChangedIncludeWorktree &&
+		(parsedArgs.Run.CloudSyncDeployment || parsedArgs.Run.CloudSyncDriftStatus) {
+		// the synchronized deployments and drifts must match committed code.
+		log.Fatal().Msg("the --changed-include-worktree flag conflicts with --cloud-sync-deployment and --cloud-sync-drift-status")
+	}
+
 	uimode := HumanMode
 	if val := os.Getenv("CI"); envVarIsSet(val) {
 		uimode = AutomationMode
@@ -866,6 +914,18 @@ func (c *cli) gencodeWithVendor() (generate.Report, download.Report) {
 	return report, vendorReport
 }
 
+// changeDetectionConfig returns the terramate.config.change_detection config,
+// which has all the optional change detection features disabled by default.
+func (c *cli) changeDetectionConfig() hcl.ChangeDetectionConfig {
+	cfg := c.rootNode()
+	if cfg.Terramate != nil &&
+		cfg.Terramate.Config != nil &&
+		cfg.Terramate.Config.ChangeDetection != nil {
+		return *cfg.Terramate.Config.ChangeDetection
+	}
+	return hcl.ChangeDetectionConfig{}
+}
+
 func (c *cli) checkGitUntracked() bool {
 	if c.parsedArgs.DisableCheckGitUntracked {
 		return false
@@ -924,6 +984,12 @@ func (c *cli) gitFileSafeguards(shouldAbort bool) {
 	debugFiles(c.prj.git.repoChecks.UntrackedFiles, "untracked file")
 	debugFiles(c.prj.git.repoChecks.UncommittedFiles, "uncommitted file")
 
+	if c.parsedArgs.ChangedIncludeWorktree {
+		// the uncommitted changes are explicitly selected by the user for
+		// change detection, as the flag is rejected together with cloud sync.
+		shouldAbort = false
+	}
+
 	if c.checkGitUntracked() && len(c.prj.git.repoChecks.UntrackedFiles) > 0 {
 		const msg = "repository has untracked files"
 		if shouldAbort {
@@ -966,6 +1032,18 @@ func (c *cli) listStacks(mgr *stack.Manager, isChanged bool, status cloudstack.F
 	)
 
 	if isChanged {
+		mgr.IncludeWorktree(c.parsedArgs.ChangedIncludeWorktree)
+		mgr.FollowVendoredModules(c.vendorDir())
+		if c.changeDetectionConfig().FileReads {
+			mgr.TrackFileReads(func(st *config.Stack) ([]stack.FileRead, error) {
+				return generate.LoadFileReads(c.cfg(), st, c.vendorDir())
+			})
+		}
+		if c.changeDetectionConfig().Evaluation {
+			mgr.TrackEvaluationChanges(func(root *config.Root, st *config.Stack) (map[string]string, error) {
+				return generate.LoadStackCode(root, st, c.vendorDir())
+			})
+		}
 		report, err = mgr.ListChanged()
 	} else {
 		report, err = mgr.List()
@@ -1005,8 +1083,11 @@ func (c *cli) listStacks(mgr *stack.Manager, isChanged bool, status cloudstack.F
 		var stacks []stack.Entry
 
 		for _, stack := range localStacks {
-			if cloudStacksMap[stack.Stack.ID] {
-				stacks = append(stacks, stack)
+			for _, variant := range stack.Stack.ExpandVariants() {
+				if cloudStacksMap[cloudMetaID(variant)] {
+					stacks = append(stacks, stack)
+					break
+				}
 			}
 		}
 		report.Stacks = stacks
@@ -1304,14 +1385,28 @@ func (c *cli) printStacks() {
 
 	c.gitFileSafeguards(false)
 
-	for _, entry := range c.filterStacks(report.Stacks) {
+	entries := c.filterStacks(report.Stacks)
+	if c.parsedArgs.List.IncludeDependencies || c.parsedArgs.List.IncludeDependents {
+		entries = c.addStackEntriesDependencies(entries,
+			c.parsedArgs.List.IncludeDependencies,
+			c.parsedArgs.List.IncludeDependents,
+		)
+	}
+
+	// disabled stacks are not selected but their changes are explained.
+	if c.parsedArgs.List.Why {
+		entries = append(entries, c.filterStacks(report.Disabled)...)
+	}
+
+	for _, entry := range entries {
 		stack := entry.Stack
 
 		log.Debug().Msgf("printing stack %s", stack.Dir)
 
 		stackRepr, ok := c.friendlyFmtDir(stack.Dir.String())
 		if !ok {
-			continue
+			// included dependencies may be outside of the working dir.
+			stackRepr = stack.Dir.String()
 		}
 
 		if c.parsedArgs.List.Why {
@@ -1340,22 +1435,55 @@ func (c *cli) printRunEnv() {
 		fatal(err, "listing stacks")
 	}
 
+	// with an inherit_env configuration, the inherited variables are part of
+	// the configured environment.
+	showInherited := c.cfg().Tree().Node.HasRunInheritEnv()
+
 	for _, stackEntry := range c.filterStacks(report.Stacks) {
-		envVars, err := run.LoadEnv(c.cfg(), stackEntry.Stack)
-		if err != nil {
-			fatal(err, "loading stack run environment")
-		}
+		for _, st := range stackEntry.Stack.ExpandVariants() {
+			envVars, err := run.LoadEnv(c.cfg(), st)
+			if err != nil {
+				fatal(err, "loading stack run environment")
+			}
 
-		c.output.MsgStdOut("\nstack %q:", stackEntry.Stack.Dir)
+			if showInherited {
+				envVars = effectiveEnviron(newEnvironFrom(c.cfg(), envVars))
+			}
+
+			c.output.MsgStdOut("\nstack %q:", st.VariantPath())
 
-		for _, envVar := range envVars {
-			c.output.MsgStdOut("\t%s", envVar)
+			for _, envVar := range envVars {
+				c.output.MsgStdOut("\t%s", envVar)
+			}
 		}
 	}
 }
 
+// effectiveEnviron returns the variables of the environ sorted by name, with
+// the later definitions of a variable overriding the earlier ones.
+func effectiveEnviron(environ []string) []string {
+	values := map[string]string{}
+	for _, env := range environ {
+		name, value, _ := strings.Cut(env, "=")
+		values[name] = value
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	effective := make([]string, 0, len(names))
+	for _, name := range names {
+		effective = append(effective, name+"="+values[name])
+	}
+	return effective
+}
+
 func (c *cli) generateGraph() {
 	var getLabel func(s *config.Stack) string
+	var getNodeLabel func(n runGraphNode) string
 
 	logger := log.With().
 		Str("action", "generateGraph()").
@@ -1367,27 +1495,46 @@ func (c *cli) generateGraph() {
 		logger.Debug().Msg("Set label to stack name.")
 
 		getLabel = func(s *config.Stack) string { return s.Name }
+		getNodeLabel = func(n runGraphNode) string { return n.Name }
 	case "stack.dir":
 		logger.Debug().Msg("Set label stack directory.")
 
 		getLabel = func(s *config.Stack) string { return s.Dir.String() }
+		getNodeLabel = func(n runGraphNode) string { return n.Path }
 	default:
 		logger.Fatal().
 			Msg("-label expects the values \"stack.name\" or \"stack.dir\"")
 	}
 
-	entries, err := stack.List(c.cfg().Tree())
+	mgr := stack.NewManager(c.cfg(), c.prj.baseRef)
+	report, err := c.listStacks(mgr, c.parsedArgs.Changed, cloudstack.NoFilter)
 	if err != nil {
 		fatal(err, "listing stacks to build graph")
 	}
 
+	entries := c.filterStacks(report.Stacks)
+
+	// The after/before references may add stacks outside of the working
+	// dir to the graph, but when filtering by --changed or --tags only the
+	// selected stacks are shown.
+	include := func(dag.ID) bool { return true }
+	if c.parsedArgs.Changed || !c.tags.IsEmpty() {
+		selected := map[dag.ID]struct{}{}
+		for _, e := range entries {
+			selected[dag.ID(e.Stack.Dir.String())] = struct{}{}
+		}
+		include = func(id dag.ID) bool {
+			_, ok := selected[id]
+			return ok
+		}
+	}
+
 	logger.Debug().Msg("Create new graph.")
 
-	dotGraph := dot.NewGraph(dot.Directed)
 	graph := dag.New()
 
 	visited := dag.Visited{}
-	for _, e := range c.filterStacksByWorkingDir(entries) {
+	for _, e := range entries {
 		if _, ok := visited[dag.ID(e.Stack.Dir.String())]; ok {
 			continue
 		}
@@ -1406,15 +1553,41 @@ func (c *cli) generateGraph() {
 		}
 	}
 
-	for _, id := range graph.IDs() {
-		val, err := graph.Node(id)
+	var data []byte
+	if c.parsedArgs.Experimental.RunGraph.Format == "dot" {
+		dotGraph := dot.NewGraph(dot.Directed)
+		for _, id := range graph.IDs() {
+			if !include(id) {
+				continue
+			}
+
+			val, err := graph.Node(id)
+			if err != nil {
+				log.Fatal().
+					Err(err).
+					Msg("generating graph")
+			}
+
+			generateDot(dotGraph, graph, id, val.(*config.Stack), getLabel, include)
+		}
+		data = []byte(dotGraph.String())
+	} else {
+		rg, err := newRunGraph(c.cfg(), graph, include)
 		if err != nil {
-			log.Fatal().
-				Err(err).
-				Msg("generating graph")
+			fatal(err, "generating graph")
 		}
 
-		generateDot(dotGraph, graph, id, val.(*config.Stack), getLabel)
+		switch c.parsedArgs.Experimental.RunGraph.Format {
+		case "mermaid":
+			data = rg.mermaid(getNodeLabel)
+		case "json":
+			data, err = rg.json()
+			if err != nil {
+				fatal(err, "generating graph")
+			}
+		case "text":
+			data = rg.text(getNodeLabel)
+		}
 	}
 
 	logger.Debug().
@@ -1445,7 +1618,7 @@ func (c *cli) generateGraph() {
 
 	logger.Debug().
 		Msg("Write graph to output.")
-	_, err = out.Write([]byte(dotGraph.String()))
+	_, err = out.Write(data)
 	if err != nil {
 		logger := log.With().
 			Str("path", outFile).
@@ -1461,9 +1634,10 @@ func generateDot(
 	id dag.ID,
 	stackval *config.Stack,
 	getLabel func(s *config.Stack) string,
+	include func(dag.ID) bool,
 ) {
 	parent := dotGraph.Node(getLabel(stackval))
-	for _, childid := range graph.AncestorsOf(id) {
+	for _, childid := range includedAncestorsOf(graph, id, include) {
 		val, err := graph.Node(childid)
 		if err != nil {
 			fatal(err, "generating dot file")
@@ -1484,7 +1658,7 @@ func generateDot(
 			continue
 		}
 
-		generateDot(dotGraph, graph, childid, s, getLabel)
+		generateDot(dotGraph, graph, childid, s, getLabel, include)
 	}
 }
 
@@ -1499,6 +1673,11 @@ func (c *cli) printRunOrder() {
 		fatal(err, "computing selected stacks")
 	}
 
+	if c.parsedArgs.Experimental.RunOrder.CriticalPath {
+		c.printCriticalPath(stacks)
+		return
+	}
+
 	logger.Debug().Msg("Get run order.")
 	orderedStacks, reason, err := run.Sort(c.cfg(), stacks)
 	if err != nil {
@@ -1818,6 +1997,9 @@ func (c *cli) setupEvalContext(st *config.Stack, overrideGlobals map[string]stri
 	if err != nil {
 		fatal(err, "loading globals expressions")
 	}
+	if st != nil {
+		exprs.SetVariantOverrides(st)
+	}
 
 	for name, exprStr := range overrideGlobals {
 		expr, err := ast.ParseExpression(exprStr, "<cmdline>")
@@ -1927,6 +2109,72 @@ func (c *cli) computeSelectedStacks(ensureCleanRepo bool) (config.List[*config.S
 	return stacks, nil
 }
 
+// addStackDependencies returns the given stacks together with their
+// dependencies and/or dependents, which are the stacks that must run,
+// respectively, before and after them.
+func (c *cli) addStackDependencies(stacks config.List[*config.SortableStack], dependencies, dependents bool) config.List[*config.SortableStack] {
+	entries := make([]stack.Entry, len(stacks))
+	for i, st := range stacks {
+		entries[i] = stack.Entry{Stack: st.Stack}
+	}
+
+	entries = c.addStackEntriesDependencies(entries, dependencies, dependents)
+
+	stacks = make(config.List[*config.SortableStack], len(entries))
+	for i, e := range entries {
+		stacks[i] = e.Stack.Sortable()
+	}
+	return stacks
+}
+
+// addStackEntriesDependencies is like addStackDependencies but for stack
+// entries. The reason of the added entries tells why they were included.
+func (c *cli) addStackEntriesDependencies(entries []stack.Entry, dependencies, dependents bool) []stack.Entry {
+	if !dependencies && !dependents {
+		return entries
+	}
+
+	mgr := stack.NewManager(c.cfg(), c.prj.baseRef)
+
+	selected := make(config.List[*config.SortableStack], len(entries))
+	seen := map[prj.Path]struct{}{}
+	for i, e := range entries {
+		selected[i] = e.Stack.Sortable()
+		seen[e.Stack.Dir] = struct{}{}
+	}
+
+	addEntries := func(stacks config.List[*config.SortableStack], reason string) {
+		for _, st := range stacks {
+			if _, ok := seen[st.Dir()]; ok {
+				continue
+			}
+			seen[st.Dir()] = struct{}{}
+			entries = append(entries, stack.Entry{Stack: st.Stack, Reason: reason})
+		}
+	}
+
+	// dependencies and dependents are computed from the original selection,
+	// so the dependents of the added dependencies are not included.
+	if dependencies {
+		stacks, err := mgr.AddDependenciesOf(selected)
+		if err != nil {
+			fatal(err, "adding dependencies of the selected stacks")
+		}
+		addEntries(stacks, "stack is a dependency of a selected stack")
+	}
+
+	if dependents {
+		stacks, err := mgr.AddDependentsOf(selected)
+		if err != nil {
+			fatal(err, "adding dependents of the selected stacks")
+		}
+		addEntries(stacks, "stack is a dependent of a selected stack")
+	}
+
+	sort.Sort(stack.EntrySlice(entries))
+	return entries
+}
+
 func (c *cli) filterStacks(stacks []stack.Entry) []stack.Entry {
 	return c.filterStacksByTags(c.filterStacksByWorkingDir(stacks))
 }
@@ -1964,7 +2212,7 @@ func (c *cli) filterStacksByTags(entries []stack.Entry) []stack.Entry {
 	return filtered
 }
 
-func (c cli) checkVersion() {
+func (c *cli) checkVersion() {
 	logger := log.With().
 		Str("action", "cli.checkVersion()").
 		Str("root", c.rootdir()).
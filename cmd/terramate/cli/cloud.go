@@ -222,6 +222,12 @@ func (c *cli) cloudSyncAfter(runContext ExecContext, res RunResult, err error) {
 	}
 }
 
+// cloudMetaID returns the cloud meta_id of the stack, which is its lowercased
+// ID suffixed by "@<variant>" when a variant is selected.
+func cloudMetaID(st *config.Stack) string {
+	return strings.ToLower(st.VariantID())
+}
+
 func (c *cli) cloudSyncCancelStacks(stacks []ExecContext) {
 	for _, run := range stacks {
 		c.cloudSyncAfter(run, RunResult{ExitCode: -1}, errors.E(ErrRunCanceled))
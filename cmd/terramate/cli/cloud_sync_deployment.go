@@ -79,13 +79,13 @@ func (c *cli) createCloudDeployment(runStacks []ExecContext) {
 		}
 		payload.Stacks = append(payload.Stacks, cloud.DeploymentStackRequest{
 			Stack: cloud.Stack{
-				MetaID:          strings.ToLower(run.Stack.ID),
+				MetaID:          cloudMetaID(run.Stack),
 				MetaName:        run.Stack.Name,
 				MetaDescription: run.Stack.Description,
 				MetaTags:        tags,
 				Repository:      c.prj.prettyRepo(),
 				DefaultBranch:   c.prj.gitcfg().DefaultBranch,
-				Path:            run.Stack.Dir.String(),
+				Path:            run.Stack.VariantPath(),
 			},
 			CommitSHA:         deploymentCommitSHA,
 			DeploymentCommand: strings.Join(run.Cmd, " "),
@@ -131,7 +131,7 @@ func (c *cli) cloudSyncDeployment(runContext ExecContext, err error) {
 		status = deployment.OK
 	case errors.IsKind(err, ErrRunCanceled):
 		status = deployment.Canceled
-	case errors.IsAnyKind(err, ErrRunFailed, ErrRunCommandNotFound):
+	case errors.IsAnyKind(err, ErrRunFailed, ErrRunCommandNotFound, ErrRunTimeout, ErrRunHookFailed):
 		status = deployment.Failed
 	default:
 		panic(errors.E(errors.ErrInternal, "unexpected run status"))
@@ -144,11 +144,11 @@ func (c *cli) doCloudSyncDeployment(runContext ExecContext, status deployment.St
 	st := runContext.Stack
 	logger := log.With().
 		Str("organization", string(c.cloud.run.orgUUID)).
-		Str("stack", st.RelPath()).
+		Str("stack", st.VariantPath()).
 		Stringer("status", status).
 		Logger()
 
-	stackID, ok := c.cloud.run.meta2id[st.ID]
+	stackID, ok := c.cloud.run.meta2id[cloudMetaID(st)]
 	if !ok {
 		logger.Error().Msg("unable to update deployment status due to invalid API response")
 		return
@@ -26,7 +26,7 @@ func (c *cli) cloudSyncDriftStatus(runContext ExecContext, res RunResult, err er
 
 	logger := log.With().
 		Str("action", "cloudSyncDriftStatus").
-		Stringer("stack", st.Dir).
+		Str("stack", st.VariantPath()).
 		Int("exit_code", res.ExitCode).
 		Strs("command", runContext.Cmd).
 		Err(err).
@@ -38,7 +38,7 @@ func (c *cli) cloudSyncDriftStatus(runContext ExecContext, res RunResult, err er
 		status = drift.OK
 	case res.ExitCode == 2:
 		status = drift.Drifted
-	case res.ExitCode == 1 || res.ExitCode > 2 || errors.IsAnyKind(err, ErrRunCommandNotFound, ErrRunFailed):
+	case res.ExitCode == 1 || res.ExitCode > 2 || errors.IsAnyKind(err, ErrRunCommandNotFound, ErrRunFailed, ErrRunTimeout, ErrRunHookFailed):
 		status = drift.Failed
 	default:
 		// ignore exit codes < 0
@@ -67,8 +67,8 @@ func (c *cli) cloudSyncDriftStatus(runContext ExecContext, res RunResult, err er
 		Stack: cloud.Stack{
 			Repository:      c.prj.prettyRepo(),
 			DefaultBranch:   c.prj.gitcfg().DefaultBranch,
-			Path:            st.Dir.String(),
-			MetaID:          st.ID,
+			Path:            st.VariantPath(),
+			MetaID:          cloudMetaID(st),
 			MetaName:        st.Name,
 			MetaDescription: st.Description,
 			MetaTags:        st.Tags,
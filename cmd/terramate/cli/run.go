@@ -4,12 +4,17 @@
 package cli
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -32,6 +37,14 @@ const (
 	// ErrRunCommandNotFound represents the error when the command cannot be found
 	// in the system.
 	ErrRunCommandNotFound errors.Kind = "command not found"
+
+	// ErrRunTimeout represents the error when the command does not finish
+	// before the configured timeout.
+	ErrRunTimeout errors.Kind = "execution timed out"
+
+	// ErrRunHookFailed represents the error when a terramate.config.run hook
+	// fails.
+	ErrRunHookFailed errors.Kind = "hook execution failed"
 )
 
 // ExecContext declares an stack execution context.
@@ -59,6 +72,25 @@ func (c *cli) runOnStacks() {
 		logger.Fatal().Msgf("run expects a cmd")
 	}
 
+	if c.parsedArgs.Run.Parallel < 1 {
+		fatal(errors.E("--parallel must be greater than or equal to 1"))
+	}
+
+	if c.parsedArgs.Run.OutputPrefixColor && !c.parsedArgs.Run.OutputPrefix {
+		fatal(errors.E("--output-prefix-color requires --output-prefix"))
+	}
+
+	retry, err := newRetryPolicy(
+		c.parsedArgs.Run.Retries,
+		c.parsedArgs.Run.RetryDelay,
+		c.parsedArgs.Run.RetryOnExitCode,
+		c.parsedArgs.Run.RetryOnStderr,
+	)
+	if err != nil {
+		fatal(err, "invalid retry options")
+	}
+	c.runRetry = retry
+
 	c.checkOutdatedGeneratedCode()
 	c.checkCloudSync()
 
@@ -83,6 +115,11 @@ func (c *cli) runOnStacks() {
 		}
 	}
 
+	stacks = c.addStackDependencies(stacks,
+		c.parsedArgs.Run.IncludeDependencies,
+		c.parsedArgs.Run.IncludeDependents,
+	)
+
 	orderedStacks, reason, err := run.Sort(c.cfg(), stacks)
 	if err != nil {
 		if errors.IsKind(err, dag.ErrCycleDetected) {
@@ -96,25 +133,25 @@ func (c *cli) runOnStacks() {
 		config.ReverseStacks(orderedStacks)
 	}
 
-	if c.parsedArgs.Run.DryRun {
-		if len(orderedStacks) > 0 {
-			c.output.MsgStdOut("The stacks will be executed using order below:")
+	// each variant of a stack is executed as a distinct unit, in the position
+	// of the stack in the run order.
+	var execStacks, disabledStacks []*config.Stack
+	for _, st := range orderedStacks {
+		if st.Disabled {
+			log.Info().
+				Stringer("stack", st.Dir()).
+				Msg("skipping stack because it is disabled")
 
-			for i, s := range orderedStacks {
-				stackdir, _ := c.friendlyFmtDir(s.Dir().String())
-				c.output.MsgStdOut("\t%d. %s (%s)", i, s.Name, stackdir)
-			}
-		} else {
-			c.output.MsgStdOut("No stacks will be executed.")
+			disabledStacks = append(disabledStacks, st.Stack)
+			continue
 		}
-
-		return
+		execStacks = append(execStacks, st.Stack.ExpandVariants()...)
 	}
 
 	var runStacks []ExecContext
-	for _, st := range orderedStacks {
+	for _, st := range execStacks {
 		run := ExecContext{
-			Stack: st.Stack,
+			Stack: st,
 			Cmd:   c.parsedArgs.Run.Command,
 		}
 		if c.parsedArgs.Run.Eval {
@@ -123,6 +160,38 @@ func (c *cli) runOnStacks() {
 		runStacks = append(runStacks, run)
 	}
 
+	disabled := make([]ExecContext, len(disabledStacks))
+	for i, st := range disabledStacks {
+		disabled[i] = ExecContext{Stack: st, Cmd: c.parsedArgs.Run.Command}
+	}
+
+	runStacks, notMet := c.filterRunConditions(runStacks)
+
+	if c.parsedArgs.Run.DryRun {
+		if len(runStacks) > 0 {
+			c.output.MsgStdOut("The stacks will be executed using order below:")
+
+			for i, runContext := range runStacks {
+				c.output.MsgStdOut("\t%d. %s (%s)", i, runContext.Stack.Name, c.dryRunStackDir(runContext.Stack))
+			}
+		} else {
+			c.output.MsgStdOut("No stacks will be executed.")
+		}
+
+		if len(disabled) > 0 || len(notMet) > 0 {
+			c.output.MsgStdOut("The stacks below will be skipped:")
+
+			for _, runContext := range disabled {
+				c.output.MsgStdOut("\t%s (%s): %s", runContext.Stack.Name, c.dryRunStackDir(runContext.Stack), stackDisabledSkipReason)
+			}
+			for _, runContext := range notMet {
+				c.output.MsgStdOut("\t%s (%s): %s", runContext.Stack.Name, c.dryRunStackDir(runContext.Stack), runConditionSkipReason)
+			}
+		}
+
+		return
+	}
+
 	if c.parsedArgs.Run.CloudSyncDeployment && c.parsedArgs.Run.CloudSyncDriftStatus {
 		fatal(errors.E("--cloud-sync-deployment conflicts with --cloud-sync-drift-status"))
 	}
@@ -143,6 +212,16 @@ func (c *cli) runOnStacks() {
 		c.detectCloudMetadata()
 	}
 
+	c.acquireRunLock(c.parsedArgs.Run.LockTimeout, c.parsedArgs.Run.NoLock)
+
+	c.initRunReport(c.parsedArgs.Run.ReportFile, c.parsedArgs.Run.JUnitFile)
+
+	c.runReport.addSkipped(disabled, stackDisabledSkipReason)
+	c.runReport.addSkipped(notMet, runConditionSkipReason)
+
+	runStacks, skipped := c.initRunState(runStacks, c.parsedArgs.Run.Resume)
+	c.runReport.addSkipped(skipped, "already succeeded in the previous run")
+
 	isSuccessExit := func(exitCode int) bool {
 		return exitCode == 0
 	}
@@ -157,12 +236,84 @@ func (c *cli) runOnStacks() {
 		}
 	}
 
+	c.initRunHistory()
+
 	err = c.RunAll(runStacks, isSuccessExit)
+	c.runHistory.save()
+	c.writeRunReport(c.parsedArgs.Run.ReportFile, c.parsedArgs.Run.JUnitFile)
+	c.releaseRunLock()
 	if err != nil {
 		fatal(err, "one or more commands failed")
 	}
 }
 
+// dryRunStackDir returns the directory of the stack shown by --dry-run, with
+// the variant name, if any.
+func (c *cli) dryRunStackDir(st *config.Stack) string {
+	stackdir, _ := c.friendlyFmtDir(st.Dir.String())
+	if st.Variant != nil {
+		stackdir += "@" + st.Variant.Name
+	}
+	return stackdir
+}
+
+// runConditionSkipReason is the reason reported for the stacks skipped because
+// of their run.condition.
+const runConditionSkipReason = "run.condition is false"
+
+// stackDisabledSkipReason is the reason reported for the stacks skipped because
+// of their stack.disabled attribute.
+const stackDisabledSkipReason = "stack is disabled"
+
+// filterRunConditions evaluates the run.condition of the given stacks and
+// returns the stacks which must be executed and the ones which must be skipped.
+func (c *cli) filterRunConditions(runStacks []ExecContext) (selected, skipped []ExecContext) {
+	for _, runContext := range runStacks {
+		ok, err := run.EvalCondition(c.cfg(), runContext.Stack)
+		if err != nil {
+			fatal(err, "evaluating run.condition of stack %s", runContext.Stack.VariantPath())
+		}
+
+		if !ok {
+			log.Info().
+				Str("stack", runContext.Stack.VariantPath()).
+				Msg("skipping stack because its run.condition is false")
+
+			skipped = append(skipped, runContext)
+			continue
+		}
+		selected = append(selected, runContext)
+	}
+	return selected, skipped
+}
+
+// initRunReport enables the run report if any of the report files is set.
+func (c *cli) initRunReport(reportFile, junitFile string) {
+	if reportFile == "" && junitFile == "" {
+		return
+	}
+	c.runReport = newRunReport(junitFile != "")
+}
+
+// writeRunReport writes the run report into the given files, if enabled.
+func (c *cli) writeRunReport(reportFile, junitFile string) {
+	if c.runReport == nil {
+		return
+	}
+
+	c.runReport.FinishedAt = time.Now().UTC()
+	if reportFile != "" {
+		if err := c.runReport.writeJSON(reportFile); err != nil {
+			c.runFatal(err, "failed to write run report")
+		}
+	}
+	if junitFile != "" {
+		if err := c.runReport.writeJUnit(junitFile); err != nil {
+			c.runFatal(err, "failed to write JUnit report")
+		}
+	}
+}
+
 // RunAll will execute the list of RunStack definitions. A RunStack defines the
 // stack and its command to be executed. The isSuccessCode is a predicate used
 // to decide if the command is considered a successful run or not.
@@ -174,6 +325,22 @@ func (c *cli) runOnStacks() {
 // stacks.
 // If SIGINT is sent 3x then Terramate will send a SIGKILL to the currently
 // running process and abort the execution of all subsequent stacks.
+// A SIGTERM or SIGHUP aborts the execution of all subsequent stacks and is
+// forwarded to the running processes, which are killed if they don't exit
+// within the --grace-period.
+// When the --parallel option is greater than 1, stacks which do not depend on
+// each other (by the run order) are executed concurrently. In this case, the
+// output of each stack is buffered and written only when the stack finishes,
+// so the output of different stacks never interleaves, and the ready stacks
+// with the longest estimated duration, from the run history, start first.
+// With --output-prefix, the output is streamed line by line instead, with each
+// line prefixed by the stack path. With --log-dir, the output of each stack is
+// also written into its own log file.
+// Failed commands are retried according to the --retries options. Only the
+// result of the final attempt is synchronized with the cloud and reported.
+// The terramate.config.run.before and terramate.config.run.after hooks are
+// executed around the command of each stack. The after hook gets the exit code
+// of the command in the TM_RUN_EXIT_CODE environment variable.
 func (c *cli) RunAll(runStacks []ExecContext, isSuccessCode func(exitCode int) bool) error {
 	errs := errors.L()
 
@@ -184,163 +351,915 @@ func (c *cli) RunAll(runStacks []ExecContext, isSuccessCode func(exitCode int) b
 		return err
 	}
 
+	stackHooks, err := c.loadAllStackHooks(runStacks)
+	if err != nil {
+		return err
+	}
+
+	stackMaskers, err := c.loadAllStackMaskers(runStacks, stackEnvs)
+	if err != nil {
+		return err
+	}
+
+	parallel := c.parsedArgs.Run.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	deps, err := c.runDependencies(runStacks, parallel)
+	if err != nil {
+		return err
+	}
+
+	schedule := c.runSchedule(runStacks, deps, parallel)
+
 	const signalsBufferSize = 10
+	handledSignals := []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP}
 	signals := make(chan os.Signal, signalsBufferSize)
-	signal.Notify(signals, os.Interrupt)
-	defer signal.Reset(os.Interrupt)
+	signal.Notify(signals, handledSignals...)
+	defer signal.Reset(handledSignals...)
+
+	gracePeriod := c.parsedArgs.Run.GracePeriod
 
-	cmds := make(chan *exec.Cmd)
-	defer close(cmds)
+	results := make(chan stackResult)
 
 	continueOnError := c.parsedArgs.Run.ContinueOnError
-	results := startCmdConsumer(cmds)
-	for i, runContext := range runStacks {
-		cmdStr := strings.Join(runContext.Cmd, " ")
-		logger := log.With().
-			Str("cmd", cmdStr).
-			Stringer("stack", runContext.Stack).
-			Logger()
 
-		c.cloudSyncBefore(runContext, cmdStr)
+	var (
+		started       = make([]bool, len(runStacks))
+		finished      = make([]bool, len(runStacks))
+		running       = map[int]*runningStack{}
+		aborted       bool
+		abortReason   string
+		killed        bool
+		killReason    string
+		killErr       error
+		interruptions int
+
+		// graceExpired fires when the grace period given to the running
+		// processes after a termination signal expires.
+		graceExpired <-chan time.Time
+	)
 
-		environ := newEnvironFrom(stackEnvs[runContext.Stack.Dir])
-		cmdPath, err := run.LookPath(runContext.Cmd[0], environ)
-		if err != nil {
-			c.cloudSyncAfter(runContext, RunResult{ExitCode: -1}, errors.E(ErrRunCommandNotFound, err))
-			errs.Append(errors.E(err, "running `%s` in stack %s", cmdStr, runContext.Stack.Dir))
-			if continueOnError {
-				continue
+	isReady := func(i int) bool {
+		for _, dep := range deps[i] {
+			if !finished[dep] {
+				return false
 			}
-			c.cloudSyncCancelStacks(runStacks[i+1:])
-			return errs.AsError()
 		}
-		cmd := exec.Command(cmdPath, runContext.Cmd[1:]...)
-		cmd.Dir = runContext.Stack.HostDir(c.cfg())
-		cmd.Env = environ
+		return true
+	}
 
-		stdout := c.stdout
-		stderr := c.stderr
+	killAll := func(reason string, err error) {
+		if killed {
+			return
+		}
+		killed = true
+		killReason = reason
+		killErr = err
+		for _, r := range running {
+			r.kill()
+		}
+	}
 
-		logSyncWait := func() {}
-		if c.cloudEnabled() && c.parsedArgs.Run.CloudSyncDeployment {
-			logSyncer := cloud.NewLogSyncer(func(logs cloud.DeploymentLogs) {
-				c.syncLogs(&logger, runContext, logs)
-			})
-			stdout = logSyncer.NewBuffer(cloud.StdoutLogChannel, c.stdout)
-			stderr = logSyncer.NewBuffer(cloud.StderrLogChannel, c.stderr)
+	handleTermination := func(sig os.Signal) {
+		log.Info().
+			Str("signal", sig.String()).
+			Msg("received termination signal, forwarding it to the running processes")
 
-			logSyncWait = logSyncer.Wait
+		if !aborted {
+			aborted = true
+			abortReason = "execution terminated by signal"
 		}
 
-		cmd.Stdin = c.stdin
-		cmd.Stdout = stdout
-		cmd.Stderr = stderr
+		for _, r := range running {
+			r.terminate(sig)
+		}
 
-		logger.Info().Msg("running")
+		if graceExpired == nil {
+			graceExpired = time.After(gracePeriod)
+		}
+	}
 
-		startTime := time.Now().UTC()
+	handleSignal := func(sig os.Signal) {
+		if sig != os.Interrupt {
+			handleTermination(sig)
+			return
+		}
 
-		if err := cmd.Start(); err != nil {
-			endTime := time.Now().UTC()
+		interruptions++
 
-			logSyncWait()
+		log.Info().
+			Str("signal", sig.String()).
+			Int("interruptions", interruptions).
+			Msg("received interruption signal")
 
-			res := RunResult{
-				ExitCode:   -1,
-				StartedAt:  &startTime,
-				FinishedAt: &endTime,
-			}
-			c.cloudSyncAfter(runContext, res, errors.E(err, ErrRunFailed))
-			errs.Append(errors.E(err, "running %s (at stack %s)", cmd, runContext.Stack.Dir))
-			logger.Error().Err(err).Msg("failed to execute")
-			if continueOnError {
-				continue
-			}
-			c.cloudSyncCancelStacks(runStacks[i+1:])
-			return errs.AsError()
+		if !aborted {
+			log.Info().Msg("interrupting execution of further stacks")
+			aborted = true
+			abortReason = "execution interrupted by signal"
 		}
 
-		cmds <- cmd
-		interruptions := 0
-		cmdIsRunning := true
+		for _, r := range running {
+			r.interrupt()
+		}
+
+		if interruptions >= 3 && !killed {
+			log.Info().Msg("interrupted 3x times or more, killing child processes")
+
+			killAll("killed after repeated interruptions",
+				errors.E(ErrRunCanceled, "execution aborted by CTRL-C (3x)"))
+		}
+	}
 
-		for cmdIsRunning {
+	for {
+		// signals must be handled before scheduling any other stack.
+	drainSignals:
+		for {
 			select {
 			case sig := <-signals:
-				interruptions++
-
-				logger.Info().
-					Str("signal", sig.String()).
-					Int("interruptions", interruptions).
-					Msg("received interruption signal")
-
-				if interruptions >= 3 {
-					logger.Info().Msg("interrupted 3x times or more, killing child process")
-
-					if err := cmd.Process.Kill(); err != nil {
-						logger.Debug().Err(err).Msg("unable to send kill signal to child process")
-					}
-
-					endTime := time.Now().UTC()
-
-					logSyncWait()
-
-					res := RunResult{
-						ExitCode:   -1,
-						StartedAt:  &startTime,
-						FinishedAt: &endTime,
-					}
-					c.cloudSyncAfter(runContext, res, errors.E(ErrRunCanceled))
-					c.cloudSyncCancelStacks(runStacks[i+1:])
-					return errors.E(ErrRunCanceled, "execution aborted by CTRL-C (3x)")
-				}
-			case result := <-results:
-				logSyncWait()
-				var err error
-				if !isSuccessCode(result.cmd.ProcessState.ExitCode()) {
-					err = errors.E(result.err, ErrRunFailed, "running %s (at stack %s)", result.cmd, runContext.Stack.Dir)
-					errs.Append(err)
-					logger.Error().Err(err).Msg("failed to execute")
-				}
-
-				res := RunResult{
-					ExitCode:   result.cmd.ProcessState.ExitCode(),
-					StartedAt:  &startTime,
-					FinishedAt: result.finishedAt,
-				}
-
-				logMsg := logger.Debug().Int("exit_code", res.ExitCode)
-				if res.StartedAt != nil && res.FinishedAt != nil {
-					logMsg = logMsg.
-						Time("started_at", *res.StartedAt).
-						Time("finished_at", *res.FinishedAt).
-						TimeDiff("duration", *res.FinishedAt, *res.StartedAt)
-				}
-				logMsg.Msg("command execution finished")
-
-				c.cloudSyncAfter(runContext, res, err)
-				cmdIsRunning = false
+				handleSignal(sig)
+			default:
+				break drainSignals
+			}
+		}
+
+		for _, i := range schedule {
+			if aborted || len(running) >= parallel {
+				break
+			}
+			if started[i] || !isReady(i) {
+				continue
+			}
+
+			started[i] = true
+
+			runContext := runStacks[i]
+			c.cloudSyncBefore(runContext, strings.Join(runContext.Cmd, " "))
+
+			r := &runningStack{
+				index:      i,
+				runContext: runContext,
+				environ:    newEnvironFrom(c.cfg(), stackEnvs[i]),
+				hooks:      stackHooks[i],
+				masker:     stackMaskers[i],
+				buffered:   parallel > 1,
+				timeout:    c.runTimeout(runContext.Stack),
+				grace:      gracePeriod,
+				retry:      c.runRetry,
+				isSuccess:  isSuccessCode,
+				stopped:    make(chan struct{}),
 			}
+			running[i] = r
+			go func() {
+				result := c.execStack(r)
+				r.finish()
+				results <- result
+			}()
+		}
+
+		if len(running) == 0 {
+			break
 		}
 
-		err = errs.AsError()
-		if interruptions > 0 || (err != nil && !continueOnError) {
-			logger.Info().Msg("interrupting execution of further stacks")
+		select {
+		case sig := <-signals:
+			handleSignal(sig)
+		case <-graceExpired:
+			log.Info().
+				Dur("grace_period", gracePeriod).
+				Msg("processes did not exit after the grace period, killing them")
+
+			killAll("killed after the termination grace period",
+				errors.E(ErrRunCanceled, "execution terminated by signal, processes killed after the grace period of %s", gracePeriod))
+		case result := <-results:
+			r := running[result.index]
+			delete(running, result.index)
+			finished[result.index] = true
+
+			runContext := runStacks[result.index]
+			err := result.err
+
+			// only the stacks still running when the kill happened are
+			// canceled, the finished ones keep their result.
+			stackKilled := r.isKilled()
+			if stackKilled {
+				err = errors.E(ErrRunCanceled)
+			} else if err == nil && !isSuccessCode(result.res.ExitCode) {
+				err = errors.E(result.cmdErr, ErrRunFailed, "running %s (at stack %s)", result.cmdStr, runContext.Stack.VariantPath())
+				result.logger.Error().Err(err).Msg("failed to execute")
+			}
+
+			// commands which fail after being terminated were canceled.
+			if err != nil && !stackKilled && r.isTerminated() && !errors.IsKind(err, ErrRunCanceled) {
+				err = errors.E(ErrRunCanceled, err, "stack %s terminated by signal", runContext.Stack.VariantPath())
+			}
+
+			if err != nil && !stackKilled {
+				errs.Append(err)
+			}
+
+			logMsg := result.logger.Debug().Int("exit_code", result.res.ExitCode)
+			if result.res.StartedAt != nil && result.res.FinishedAt != nil {
+				logMsg = logMsg.
+					Time("started_at", *result.res.StartedAt).
+					Time("finished_at", *result.res.FinishedAt).
+					TimeDiff("duration", *result.res.FinishedAt, *result.res.StartedAt)
+			}
+			logMsg.Msg("command execution finished")
+
+			c.cloudSyncAfter(runContext, result.res, err)
 
-			c.cloudSyncCancelStacks(runStacks[i+1:])
-			return errs.AsError()
+			reason := ""
+			if stackKilled {
+				reason = killReason
+			}
+			c.runReport.addResult(runContext, result.res, err, reason, result.stderr)
+			c.runState.update(runContext, err)
+			c.runHistory.add(runContext, result.res, err)
+
+			if err != nil && !continueOnError && !aborted {
+				aborted = true
+				abortReason = "previous stack failed"
+			}
+		}
+	}
+
+	var canceled []ExecContext
+	for i, runContext := range runStacks {
+		if !started[i] {
+			canceled = append(canceled, runContext)
 		}
 	}
+	c.cloudSyncCancelStacks(canceled)
+	c.runReport.addCanceled(canceled, abortReason)
+	c.runState.cancel(canceled)
 
+	if killed {
+		return killErr
+	}
 	return errs.AsError()
 }
 
+// runningStack holds the execution state of a single stack.
+type runningStack struct {
+	index      int
+	runContext ExecContext
+	environ    []string
+
+	// hooks are executed before and after the stack command.
+	hooks run.Hooks
+
+	// masker masks the secrets in the output of the commands.
+	masker *run.Masker
+
+	// buffered tells if the output must be kept in memory and only written
+	// to the cli output after the command finishes.
+	buffered bool
+
+	// timeout is the maximum duration of each attempt of the command.
+	// Zero means no timeout.
+	timeout time.Duration
+
+	// grace is the time given for the command to exit after being
+	// interrupted by the timeout, before it gets killed.
+	grace time.Duration
+
+	// retry and isSuccess decide if a finished attempt must be retried.
+	retry     retryPolicy
+	isSuccess func(exitCode int) bool
+
+	// stopped is closed when the stack is interrupted or killed, so no
+	// further attempts are made.
+	stopped chan struct{}
+
+	mu         sync.Mutex
+	cmd        *exec.Cmd
+	group      bool // tells if cmd runs in its own process group.
+	done       bool
+	killed     bool
+	expired    bool // tells if cmd was killed after the grace period of its timeout.
+	terminated bool
+	timedOut   bool
+	graceTimer *time.Timer
+}
+
+// stackResult is the result of a stack execution.
+type stackResult struct {
+	index  int
+	res    RunResult
+	cmdStr string
+	logger zerolog.Logger
+
+	// err is set when the command could not be executed.
+	err error
+
+	// cmdErr is the error returned when waiting for the command.
+	cmdErr error
+
+	// stderr is the captured stderr of the command, if requested by the
+	// run report or the retry policy.
+	stderr []byte
+
+	// attempts is the number of times the command was executed.
+	attempts int
+}
+
+// kill sends a SIGKILL to the running command, if any, canceling the stack.
+// Stacks which already finished are not killed.
+func (r *runningStack) kill() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.done {
+		return
+	}
+	r.killed = true
+	r.stopLocked()
+	r.killLocked()
+}
+
+// killExpired sends a SIGKILL to the command which did not exit within the
+// grace period of its timeout. Unlike kill, the stack is not canceled, so the
+// timeout is reported as its failure.
+func (r *runningStack) killExpired() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.done || r.killed {
+		return
+	}
+	r.expired = true
+	r.killLocked()
+}
+
+func (r *runningStack) killLocked() {
+	if r.cmd == nil || r.cmd.Process == nil {
+		return
+	}
+	if err := killProcess(r.cmd, r.group); err != nil {
+		log.Debug().
+			Str("stack", r.runContext.Stack.VariantPath()).
+			Err(err).
+			Msg("unable to send kill signal to child process")
+	}
+}
+
+// terminate forwards the termination signal to the running command and
+// prevents further attempts and commands of the stack.
+func (r *runningStack) terminate(sig os.Signal) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.terminated = true
+	r.stopLocked()
+	if r.cmd == nil || r.cmd.Process == nil {
+		return
+	}
+	if err := signalProcess(r.cmd, r.group, sig); err != nil {
+		log.Debug().
+			Str("stack", r.runContext.Stack.VariantPath()).
+			Str("signal", sig.String()).
+			Err(err).
+			Msg("unable to forward signal to child process")
+	}
+}
+
+// interrupt prevents further attempts of the command. The interruption is
+// forwarded to the running command if it runs in its own process group,
+// otherwise it already got the signal from the terminal.
+func (r *runningStack) interrupt() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stopLocked()
+	if r.cmd == nil || r.cmd.Process == nil || !r.group {
+		return
+	}
+	if err := signalProcess(r.cmd, r.group, os.Interrupt); err != nil {
+		log.Debug().
+			Str("stack", r.runContext.Stack.VariantPath()).
+			Err(err).
+			Msg("unable to forward interrupt signal to child process")
+	}
+}
+
+func (r *runningStack) stopLocked() {
+	select {
+	case <-r.stopped:
+	default:
+		close(r.stopped)
+	}
+}
+
+// finish marks the execution of the stack as done, so it can't be killed
+// anymore.
+func (r *runningStack) finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.done = true
+}
+
+// isKilled tells if the stack was killed before finishing its execution.
+func (r *runningStack) isKilled() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.killed
+}
+
+// isTerminated tells if a termination signal was forwarded to the stack.
+func (r *runningStack) isTerminated() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.terminated
+}
+
+// isStopped tells if the stack was interrupted or killed.
+func (r *runningStack) isStopped() bool {
+	select {
+	case <-r.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// expire interrupts the running command because its timeout expired and kills
+// it if it doesn't exit after the grace period.
+func (r *runningStack) expire() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.timedOut = true
+
+	logger := log.With().
+		Str("stack", r.runContext.Stack.VariantPath()).
+		Dur("timeout", r.timeout).
+		Logger()
+
+	logger.Warn().Msg("command timed out, interrupting it")
+
+	if err := signalProcess(r.cmd, r.group, os.Interrupt); err != nil {
+		// interrupt is not supported on all platforms (eg.: windows).
+		logger.Debug().Err(err).Msg("unable to send interrupt signal, killing the process")
+		if err := killProcess(r.cmd, r.group); err != nil {
+			logger.Debug().Err(err).Msg("unable to send kill signal to child process")
+		}
+		return
+	}
+
+	r.graceTimer = time.AfterFunc(r.grace, func() {
+		logger.Warn().Msg("command did not exit after the grace period, killing it")
+		r.killExpired()
+	})
+}
+
+// hasTimedOut tells if the command was interrupted by the timeout and stops
+// any pending kill.
+func (r *runningStack) hasTimedOut() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.graceTimer != nil {
+		r.graceTimer.Stop()
+	}
+	return r.timedOut
+}
+
+// start starts the command unless the stack was killed already.
+func (r *runningStack) start(cmd *exec.Cmd) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.killed || r.terminated {
+		return errors.E(ErrRunCanceled)
+	}
+	r.cmd = cmd
+	r.group = setProcessGroup(cmd)
+	r.timedOut = false
+	r.expired = false
+	r.graceTimer = nil
+	return cmd.Start()
+}
+
+// waitProcessGroup waits for the processes left in the process group of the
+// command after it exited, if the stack was signaled. This gives the processes
+// started by the command (eg.: by a wrapper script) the chance to exit
+// gracefully, while they are still killed with the stack after the grace
+// period.
+func (r *runningStack) waitProcessGroup(cmd *exec.Cmd) {
+	for {
+		r.mu.Lock()
+		wait := r.group && !r.killed && !r.expired &&
+			(r.terminated || r.timedOut || r.isStopped())
+		r.mu.Unlock()
+
+		if !wait || !processGroupExists(cmd) {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// execStack executes the command of the given stack and waits for it to finish.
+// Failed attempts are retried according to the retry policy of the stack.
+func (c *cli) execStack(r *runningStack) stackResult {
+	runContext := r.runContext
+	cmdStr := strings.Join(runContext.Cmd, " ")
+	logger := log.With().
+		Str("cmd", cmdStr).
+		Str("stack", runContext.Stack.VariantPath()).
+		Logger()
+
+	result := stackResult{
+		index:  r.index,
+		cmdStr: cmdStr,
+		logger: logger,
+		res:    RunResult{ExitCode: -1},
+	}
+
+	cmdPath, err := run.LookPath(runContext.Cmd[0], r.environ)
+	if err != nil {
+		result.err = errors.E(ErrRunCommandNotFound, err, "running `%s` in stack %s", cmdStr, runContext.Stack.VariantPath())
+		return result
+	}
+
+	var stdout, stderr io.Writer = c.stdout, c.stderr
+
+	// prefixed output is streamed line by line, so the lines of concurrent
+	// stacks can interleave without losing track of their stack.
+	buffered := r.buffered && !c.parsedArgs.Run.OutputPrefix
+
+	flush := func() {}
+	if buffered {
+		stdoutBuf := &bytes.Buffer{}
+		stderrBuf := &bytes.Buffer{}
+		stdout = stdoutBuf
+		stderr = stderrBuf
+		flush = func() {
+			c.outputMu.Lock()
+			defer c.outputMu.Unlock()
+
+			if _, err := c.stdout.Write(stdoutBuf.Bytes()); err != nil {
+				logger.Debug().Err(err).Msg("failed to write stack stdout")
+			}
+			if _, err := c.stderr.Write(stderrBuf.Bytes()); err != nil {
+				logger.Debug().Err(err).Msg("failed to write stack stderr")
+			}
+		}
+	}
+
+	output, err := c.newStackOutput(r, stdout, stderr, buffered)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	if output != nil {
+		stdout = output.stdout
+		stderr = output.stderr
+	}
+
+	logSyncWait := func() {}
+	if c.cloudEnabled() && c.parsedArgs.Run.CloudSyncDeployment {
+		logSyncer := cloud.NewLogSyncer(func(logs cloud.DeploymentLogs) {
+			c.syncLogs(&logger, runContext, logs)
+		})
+		stdout = logSyncer.NewBuffer(cloud.StdoutLogChannel, stdout)
+		stderr = logSyncer.NewBuffer(cloud.StderrLogChannel, stderr)
+
+		logSyncWait = logSyncer.Wait
+	}
+
+	// secrets are masked before the output is written or synced.
+	maskWait := func() {}
+	if !r.masker.Empty() {
+		stdoutMask := run.NewMaskWriter(r.masker, stdout, run.DefaultMaskIdleFlush)
+		stderrMask := run.NewMaskWriter(r.masker, stderr, run.DefaultMaskIdleFlush)
+		stdout = stdoutMask
+		stderr = stderrMask
+		maskWait = func() {
+			_ = stdoutMask.Close()
+			_ = stderrMask.Close()
+		}
+	}
+
+	finish := func() {
+		maskWait()
+		logSyncWait()
+		if output != nil {
+			if err := output.close(); err != nil {
+				logger.Warn().Err(err).Msg("failed to write stack output")
+			}
+		}
+		flush()
+	}
+
+	if r.hooks.Before != nil {
+		if err := c.execHook(r, "before", r.hooks.Before, nil, stdout, stderr, logger); err != nil {
+			if !errors.IsKind(err, ErrRunCanceled) {
+				logger.Error().Err(err).Msg("failed to execute")
+			}
+			result.err = err
+			finish()
+			return result
+		}
+	}
+
+	maxAttempts := r.retry.retries + 1
+	for attempt := 1; ; attempt++ {
+		attemptLogger := logger.With().
+			Int("attempt", attempt).
+			Int("max_attempts", maxAttempts).
+			Logger()
+
+		result.attempts = attempt
+		c.execAttempt(r, cmdPath, stdout, stderr, attemptLogger, &result)
+
+		if attempt == maxAttempts || !r.shouldRetry(result) {
+			break
+		}
+
+		attemptLogger.Warn().
+			Int("exit_code", result.res.ExitCode).
+			Dur("retry_delay", r.retry.delay).
+			Msg("command failed, retrying")
+
+		select {
+		case <-time.After(r.retry.delay):
+		case <-r.stopped:
+		}
+
+		if r.isStopped() {
+			attemptLogger.Info().Msg("execution interrupted, not retrying")
+			break
+		}
+	}
+
+	executed := result.err == nil || errors.IsKind(result.err, ErrRunTimeout)
+	if r.hooks.After != nil && executed && !r.isStopped() {
+		env := []string{fmt.Sprintf("%s=%d", run.ExitCodeEnv, result.res.ExitCode)}
+		err := c.execHook(r, "after", r.hooks.After, env, stdout, stderr, logger)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to execute")
+
+			// the failure of the command itself takes precedence.
+			if result.err == nil && r.isSuccess(result.res.ExitCode) {
+				result.err = err
+			}
+		}
+	}
+
+	finish()
+	return result
+}
+
+// execHook executes the given hook command in the stack directory, with the
+// environment of the stack plus the given env. The output of the hook is
+// handled the same way as the output of the stack command.
+func (c *cli) execHook(
+	r *runningStack,
+	name string,
+	hookCmd []string,
+	env []string,
+	stdout, stderr io.Writer,
+	logger zerolog.Logger,
+) error {
+	runContext := r.runContext
+	hookStr := strings.Join(hookCmd, " ")
+	logger = logger.With().
+		Str("hook", name).
+		Str("hook_cmd", hookStr).
+		Logger()
+
+	environ := make([]string, 0, len(r.environ)+len(env))
+	environ = append(environ, r.environ...)
+	environ = append(environ, env...)
+
+	cmdPath, err := run.LookPath(hookCmd[0], environ)
+	if err != nil {
+		return errors.E(ErrRunHookFailed, err, "running %s hook `%s` in stack %s", name, hookStr, runContext.Stack.VariantPath())
+	}
+
+	cmd := exec.Command(cmdPath, hookCmd[1:]...)
+	cmd.Dir = runContext.Stack.HostDir(c.cfg())
+	cmd.Env = environ
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if !r.buffered {
+		cmd.Stdin = c.stdin
+	}
+
+	logger.Info().Msg("running hook")
+
+	if err := r.start(cmd); err != nil {
+		if errors.IsKind(err, ErrRunCanceled) {
+			return err
+		}
+		return errors.E(ErrRunHookFailed, err, "running %s hook `%s` in stack %s", name, hookStr, runContext.Stack.VariantPath())
+	}
+
+	err = cmd.Wait()
+	r.waitProcessGroup(cmd)
+	if err != nil {
+		return errors.E(ErrRunHookFailed, err, "running %s hook `%s` in stack %s", name, hookStr, runContext.Stack.VariantPath())
+	}
+	return nil
+}
+
+// execAttempt executes the stack command once, setting the outcome of the
+// attempt in the given result.
+func (c *cli) execAttempt(
+	r *runningStack,
+	cmdPath string,
+	stdout, stderr io.Writer,
+	logger zerolog.Logger,
+	result *stackResult,
+) {
+	runContext := r.runContext
+
+	result.res = RunResult{ExitCode: -1}
+	result.err = nil
+	result.cmdErr = nil
+	result.stderr = nil
+
+	cmd := exec.Command(cmdPath, runContext.Cmd[1:]...)
+	cmd.Dir = runContext.Stack.HostDir(c.cfg())
+	cmd.Env = r.environ
+
+	if !r.buffered {
+		cmd.Stdin = c.stdin
+	}
+
+	var capturedStderr *bytes.Buffer
+	if c.runReport.capturesStderr() || r.retry.capturesStderr() {
+		capturedStderr = &bytes.Buffer{}
+		stderr = io.MultiWriter(stderr, capturedStderr)
+	}
+
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	logger.Info().Msg("running")
+
+	startTime := time.Now().UTC()
+	result.res.StartedAt = &startTime
+
+	if err := r.start(cmd); err != nil {
+		endTime := time.Now().UTC()
+		result.res.FinishedAt = &endTime
+
+		if errors.IsKind(err, ErrRunCanceled) {
+			result.err = err
+			return
+		}
+
+		logger.Error().Err(err).Msg("failed to execute")
+		result.err = errors.E(err, ErrRunFailed, "running %s (at stack %s)", cmd, runContext.Stack.VariantPath())
+		return
+	}
+
+	var timeoutTimer *time.Timer
+	if r.timeout > 0 {
+		timeoutTimer = time.AfterFunc(r.timeout, r.expire)
+	}
+
+	result.cmdErr = cmd.Wait()
+	r.waitProcessGroup(cmd)
+	endTime := time.Now().UTC()
+
+	if timeoutTimer != nil {
+		timeoutTimer.Stop()
+		if r.hasTimedOut() {
+			result.err = errors.E(ErrRunTimeout, result.cmdErr,
+				"running %s (at stack %s) exceeded the timeout of %s",
+				result.cmdStr, runContext.Stack.VariantPath(), r.timeout)
+			logger.Error().Err(result.err).Msg("failed to execute")
+		}
+	}
+
+	if capturedStderr != nil {
+		result.stderr = r.masker.Mask(capturedStderr.Bytes())
+	}
+
+	result.res.ExitCode = cmd.ProcessState.ExitCode()
+	result.res.FinishedAt = &endTime
+}
+
+// shouldRetry tells if the given attempt result is a retryable failure.
+// Commands which could not be started or that were interrupted are never
+// retried.
+func (r *runningStack) shouldRetry(result stackResult) bool {
+	if r.isStopped() {
+		return false
+	}
+	if result.err != nil && !errors.IsKind(result.err, ErrRunTimeout) {
+		return false
+	}
+	if result.err == nil && r.isSuccess(result.res.ExitCode) {
+		return false
+	}
+	return r.retry.retryable(result.res.ExitCode, result.stderr)
+}
+
+// runTimeout returns the timeout of the commands executed in the given stack.
+// The --timeout flag has precedence over the stack.timeout attribute, which
+// has precedence over the terramate.config.run.timeout attribute.
+func (c *cli) runTimeout(st *config.Stack) time.Duration {
+	if c.parsedArgs.Run.Timeout > 0 {
+		return c.parsedArgs.Run.Timeout
+	}
+	if st.Timeout > 0 {
+		return st.Timeout
+	}
+
+	cfg := c.rootNode()
+	if cfg.Terramate != nil &&
+		cfg.Terramate.Config != nil &&
+		cfg.Terramate.Config.Run != nil {
+		return cfg.Terramate.Config.Run.Timeout
+	}
+	return 0
+}
+
+// runDependencies computes, for each stack in runStacks, the indexes of the
+// stacks which must finish before it can start.
+// When executing sequentially, the order of runStacks is enough and then no
+// dependency is computed.
+func (c *cli) runDependencies(runStacks []ExecContext, parallel int) (map[int][]int, error) {
+	deps := map[int][]int{}
+	if parallel <= 1 {
+		return deps, nil
+	}
+
+	// the variants of a stack share its dependencies, in the run order.
+	index := map[dag.ID][]int{}
+	stacks := make(config.List[*config.SortableStack], 0, len(runStacks))
+	for i, runContext := range runStacks {
+		id := dag.ID(runContext.Stack.Dir.String())
+		if _, ok := index[id]; !ok {
+			stacks = append(stacks, runContext.Stack.Sortable())
+		}
+		index[id] = append(index[id], i)
+	}
+
+	d, reason, err := run.BuildStacksDAG(c.cfg(), stacks)
+	if err != nil {
+		if errors.IsKind(err, dag.ErrCycleDetected) {
+			return nil, errors.E(err, "cycle detected: %s", reason)
+		}
+		return nil, errors.E(err, "computing stacks dependencies")
+	}
+
+	for i, runContext := range runStacks {
+		id := dag.ID(runContext.Stack.Dir.String())
+
+		var related []dag.ID
+		if c.parsedArgs.Run.Reverse {
+			related = d.TransitiveDescendantsOf(id)
+		} else {
+			related = d.TransitiveAncestorsOf(id)
+		}
+
+		for _, other := range related {
+			deps[i] = append(deps[i], index[other]...)
+		}
+
+		// the variants of a stack are executed in the same directory, then
+		// each variant waits for the previous ones.
+		for _, variant := range index[id] {
+			if variant >= i {
+				break
+			}
+			deps[i] = append(deps[i], variant)
+		}
+	}
+	return deps, nil
+}
+
+func (c *cli) loadAllStackHooks(runStacks []ExecContext) ([]run.Hooks, error) {
+	errs := errors.L()
+	stackHooks := make([]run.Hooks, len(runStacks))
+	for i, elem := range runStacks {
+		hooks, err := run.LoadHooks(c.cfg(), elem.Stack)
+		errs.Append(err)
+		stackHooks[i] = hooks
+	}
+
+	if errs.AsError() != nil {
+		return nil, errs.AsError()
+	}
+	return stackHooks, nil
+}
+
 func (c *cli) syncLogs(logger *zerolog.Logger, runContext ExecContext, logs cloud.DeploymentLogs) {
 	data, _ := json.Marshal(logs)
 	logger.Debug().RawJSON("logs", data).Msg("synchronizing logs")
 	ctx, cancel := context.WithTimeout(context.Background(), defaultCloudTimeout)
 	defer cancel()
-	stackID := c.cloud.run.meta2id[runContext.Stack.ID]
+	stackID := c.cloud.run.meta2id[cloudMetaID(runContext.Stack)]
 	err := c.cloud.client.SyncDeploymentLogs(
 		ctx, c.cloud.run.orgUUID, stackID, c.cloud.run.runUUID, logs,
 	)
@@ -349,44 +1268,40 @@ func (c *cli) syncLogs(logger *zerolog.Logger, runContext ExecContext, logs clou
 	}
 }
 
-type cmdResult struct {
-	cmd        *exec.Cmd
-	err        error
-	finishedAt *time.Time
+// newEnvironFrom returns the environment of the stack commands, which is the
+// inherited host environment plus the given stack environment.
+func newEnvironFrom(root *config.Root, stackEnviron []string) []string {
+	inherited := run.InheritEnv(root, os.Environ())
+	environ := make([]string, len(inherited), len(inherited)+len(stackEnviron))
+	copy(environ, inherited)
+	environ = append(environ, stackEnviron...)
+	return environ
 }
 
-func startCmdConsumer(cmds <-chan *exec.Cmd) <-chan cmdResult {
-	results := make(chan cmdResult)
-	go func() {
-		for cmd := range cmds {
-			err := cmd.Wait()
-			endTime := time.Now().UTC()
-
-			results <- cmdResult{
-				cmd:        cmd,
-				err:        err,
-				finishedAt: &endTime,
-			}
-		}
-		close(results)
-	}()
-	return results
-}
+func (c *cli) loadAllStackMaskers(runStacks []ExecContext, stackEnvs []run.EnvVars) ([]*run.Masker, error) {
+	errs := errors.L()
+	stackMaskers := make([]*run.Masker, len(runStacks))
+	for i, elem := range runStacks {
+		masker, err := run.LoadMasker(c.cfg(), elem.Stack, newEnvironFrom(c.cfg(), stackEnvs[i]))
+		errs.Append(err)
+		stackMaskers[i] = masker
+	}
 
-func newEnvironFrom(stackEnviron []string) []string {
-	environ := make([]string, len(os.Environ()))
-	copy(environ, os.Environ())
-	environ = append(environ, stackEnviron...)
-	return environ
+	if errs.AsError() != nil {
+		return nil, errs.AsError()
+	}
+	return stackMaskers, nil
 }
 
-func (c *cli) loadAllStackEnvs(runStacks []ExecContext) (map[prj.Path]run.EnvVars, error) {
+// loadAllStackEnvs loads the environment of each of the given stacks, indexed
+// in the same way.
+func (c *cli) loadAllStackEnvs(runStacks []ExecContext) ([]run.EnvVars, error) {
 	errs := errors.L()
-	stackEnvs := map[prj.Path]run.EnvVars{}
-	for _, elem := range runStacks {
+	stackEnvs := make([]run.EnvVars, len(runStacks))
+	for i, elem := range runStacks {
 		env, err := run.LoadEnv(c.cfg(), elem.Stack)
 		errs.Append(err)
-		stackEnvs[elem.Stack.Dir] = env
+		stackEnvs[i] = env
 	}
 
 	if errs.AsError() != nil {
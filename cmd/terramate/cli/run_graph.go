@@ -0,0 +1,242 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/run"
+	"github.com/terramate-io/terramate/run/dag"
+)
+
+// Kinds of edges of the run graph.
+const (
+	runGraphEdgeOrder = "order"
+	runGraphEdgeWants = "wants"
+)
+
+type (
+	// runGraph is the structured form of the run graph.
+	runGraph struct {
+		Nodes []runGraphNode `json:"nodes"`
+		Edges []runGraphEdge `json:"edges"`
+	}
+
+	runGraphNode struct {
+		Path string   `json:"path"`
+		ID   string   `json:"id,omitempty"`
+		Name string   `json:"name"`
+		Tags []string `json:"tags"`
+	}
+
+	// runGraphEdge is an edge of the run graph. For "order" edges, the stack
+	// From runs before the stack To. For "wants" edges, the stack From wants
+	// the stack To.
+	runGraphEdge struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+		Type string `json:"type"`
+	}
+)
+
+// newRunGraph creates the structured run graph from the order DAG, having
+// only the nodes accepted by include. The order edges through the nodes not
+// included are kept as edges between the included nodes, so the graph keeps
+// the order of execution. The wants edges are computed from the stack.wants
+// and stack.wanted_by attributes of the nodes.
+func newRunGraph(root *config.Root, graph *dag.DAG, include func(dag.ID) bool) (*runGraph, error) {
+	rg := &runGraph{
+		Nodes: []runGraphNode{},
+		Edges: []runGraphEdge{},
+	}
+
+	var ids []dag.ID
+	for _, id := range graph.IDs() {
+		if include(id) {
+			ids = append(ids, id)
+		}
+	}
+
+	wantsDag := dag.New()
+	visited := dag.Visited{}
+	for _, id := range ids {
+		val, err := graph.Node(id)
+		if err != nil {
+			return nil, errors.E(err, "building run graph")
+		}
+		st := val.(*config.Stack)
+
+		tags := make([]string, len(st.Tags))
+		copy(tags, st.Tags)
+		sort.Strings(tags)
+
+		rg.Nodes = append(rg.Nodes, runGraphNode{
+			Path: st.Dir.String(),
+			ID:   st.ID,
+			Name: st.Name,
+			Tags: tags,
+		})
+
+		for _, ancestor := range includedAncestorsOf(graph, id, include) {
+			rg.Edges = append(rg.Edges, runGraphEdge{
+				From: string(ancestor),
+				To:   string(id),
+				Type: runGraphEdgeOrder,
+			})
+		}
+
+		err = run.BuildDAG(
+			wantsDag,
+			root,
+			st,
+			"wanted_by",
+			func(s config.Stack) []string { return s.WantedBy },
+			"wants",
+			func(s config.Stack) []string { return s.Wants },
+			visited,
+		)
+		if err != nil {
+			return nil, errors.E(err, "building wants graph")
+		}
+	}
+
+	for _, id := range ids {
+		for _, wanted := range sortedIDs(wantsDag.AncestorsOf(id)) {
+			if !include(wanted) {
+				continue
+			}
+			rg.Edges = append(rg.Edges, runGraphEdge{
+				From: string(id),
+				To:   string(wanted),
+				Type: runGraphEdgeWants,
+			})
+		}
+	}
+	return rg, nil
+}
+
+func (rg *runGraph) json() ([]byte, error) {
+	data, err := json.MarshalIndent(rg, "", "  ")
+	if err != nil {
+		return nil, errors.E(err, "marshaling run graph")
+	}
+	return append(data, '\n'), nil
+}
+
+// mermaid renders the graph as a Mermaid flowchart. Order edges point from
+// the stack which runs first and wants edges are dotted.
+func (rg *runGraph) mermaid(getLabel func(n runGraphNode) string) []byte {
+	var b bytes.Buffer
+	b.WriteString("flowchart TD\n")
+
+	nodeIDs := map[string]string{}
+	for i, n := range rg.Nodes {
+		nodeIDs[n.Path] = fmt.Sprintf("s%d", i)
+		fmt.Fprintf(&b, "    %s[\"%s\"]\n", nodeIDs[n.Path], mermaidEscape(getLabel(n)))
+	}
+	for _, e := range rg.Edges {
+		switch e.Type {
+		case runGraphEdgeOrder:
+			fmt.Fprintf(&b, "    %s --> %s\n", nodeIDs[e.From], nodeIDs[e.To])
+		case runGraphEdgeWants:
+			fmt.Fprintf(&b, "    %s -. wants .-> %s\n", nodeIDs[e.From], nodeIDs[e.To])
+		}
+	}
+	return b.Bytes()
+}
+
+// text renders the order edges of the graph as a tree, starting from the
+// stacks which have no dependencies. Stacks with multiple dependencies are
+// shown under each one of them.
+func (rg *runGraph) text(getLabel func(n runGraphNode) string) []byte {
+	nodes := map[string]runGraphNode{}
+	for _, n := range rg.Nodes {
+		nodes[n.Path] = n
+	}
+
+	children := map[string][]string{}
+	hasParent := map[string]bool{}
+	for _, e := range rg.Edges {
+		if e.Type != runGraphEdgeOrder {
+			continue
+		}
+		children[e.From] = append(children[e.From], e.To)
+		hasParent[e.To] = true
+	}
+
+	var b bytes.Buffer
+	var walk func(path, prefix string, last bool, branch map[string]bool)
+	walk = func(path, prefix string, last bool, branch map[string]bool) {
+		connector, childPrefix := "├── ", prefix+"│   "
+		if last {
+			connector, childPrefix = "└── ", prefix+"    "
+		}
+		label := getLabel(nodes[path])
+		if branch[path] {
+			fmt.Fprintf(&b, "%s%s%s (cycle)\n", prefix, connector, label)
+			return
+		}
+		fmt.Fprintf(&b, "%s%s%s\n", prefix, connector, label)
+
+		branch[path] = true
+		defer delete(branch, path)
+
+		for i, child := range children[path] {
+			walk(child, childPrefix, i == len(children[path])-1, branch)
+		}
+	}
+
+	for _, n := range rg.Nodes {
+		if hasParent[n.Path] {
+			continue
+		}
+		b.WriteString(getLabel(n) + "\n")
+		branch := map[string]bool{n.Path: true}
+		for i, child := range children[n.Path] {
+			walk(child, "", i == len(children[n.Path])-1, branch)
+		}
+	}
+	return b.Bytes()
+}
+
+// includedAncestorsOf returns the sorted nearest ancestors of the given id
+// accepted by include, following the ancestors which are not included.
+func includedAncestorsOf(graph *dag.DAG, id dag.ID, include func(dag.ID) bool) []dag.ID {
+	var ancestors []dag.ID
+	visited := dag.Visited{}
+
+	var walk func(id dag.ID)
+	walk = func(id dag.ID) {
+		for _, ancestor := range graph.AncestorsOf(id) {
+			if _, ok := visited[ancestor]; ok {
+				continue
+			}
+			visited[ancestor] = struct{}{}
+			if include(ancestor) {
+				ancestors = append(ancestors, ancestor)
+			} else {
+				walk(ancestor)
+			}
+		}
+	}
+	walk(id)
+	return sortedIDs(ancestors)
+}
+
+func mermaidEscape(s string) string {
+	return strings.ReplaceAll(s, `"`, "#quot;")
+}
+
+func sortedIDs(ids []dag.ID) []dag.ID {
+	sorted := make([]dag.ID, len(ids))
+	copy(sorted, ids)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
@@ -0,0 +1,158 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/run"
+	"github.com/terramate-io/terramate/run/dag"
+	"github.com/terramate-io/terramate/run/history"
+)
+
+// runHistory records the duration of the stack commands of the current run
+// into the local run history.
+type runHistory struct {
+	rootdir string
+	history history.History
+}
+
+// initRunHistory loads the local run history of the project.
+// A corrupted history is ignored and replaced by the durations of this run.
+func (c *cli) initRunHistory() {
+	h, err := history.Load(c.rootdir())
+	if err != nil {
+		log.Warn().Err(err).Msg("ignoring the local run history")
+		h = history.History{}
+	}
+	c.runHistory = &runHistory{
+		rootdir: c.rootdir(),
+		history: h,
+	}
+}
+
+// estimate returns the estimated duration of the stack command, or zero if
+// it's unknown. It returns zero if the run history is nil.
+func (h *runHistory) estimate(runContext ExecContext) time.Duration {
+	if h == nil {
+		return 0
+	}
+	d, _ := h.history.Estimate(runContext.Stack.VariantPath(), runContext.Cmd)
+	return d
+}
+
+// add records the duration of the stack command. Only successful commands are
+// recorded since failures usually finish early. It's a no-op if the run
+// history is nil.
+func (h *runHistory) add(runContext ExecContext, res RunResult, err error) {
+	if h == nil || err != nil || res.StartedAt == nil || res.FinishedAt == nil {
+		return
+	}
+	h.history.Add(
+		runContext.Stack.VariantPath(),
+		runContext.Cmd,
+		res.FinishedAt.Sub(*res.StartedAt),
+		*res.FinishedAt,
+	)
+}
+
+// save persists the run history. A failure is only logged as the history just
+// improves the scheduling of future runs. It's a no-op if the run history is
+// nil.
+func (h *runHistory) save() {
+	if h == nil {
+		return
+	}
+	if err := history.Save(h.rootdir, h.history); err != nil {
+		log.Warn().Err(err).Msg("failed to save the run history")
+	}
+}
+
+// runSchedule returns the indexes of the stacks in the order they must be
+// considered when starting new stacks. When running in parallel, the stacks
+// with the longest estimated path of dependent stacks (including themselves)
+// come first, so the stacks which bottleneck the execution start as early as
+// possible. Otherwise, the run order is kept.
+func (c *cli) runSchedule(runStacks []ExecContext, deps map[int][]int, parallel int) []int {
+	schedule := make([]int, len(runStacks))
+	for i := range schedule {
+		schedule[i] = i
+	}
+	if parallel <= 1 || c.runHistory == nil {
+		return schedule
+	}
+
+	// the dependencies of a stack always come before it in the run order.
+	priority := make([]time.Duration, len(runStacks))
+	longestDependent := make([]time.Duration, len(runStacks))
+	for i := len(runStacks) - 1; i >= 0; i-- {
+		priority[i] = c.runHistory.estimate(runStacks[i]) + longestDependent[i]
+		for _, dep := range deps[i] {
+			if priority[i] > longestDependent[dep] {
+				longestDependent[dep] = priority[i]
+			}
+		}
+	}
+
+	sort.SliceStable(schedule, func(a, b int) bool {
+		return priority[schedule[a]] > priority[schedule[b]]
+	})
+	return schedule
+}
+
+// printCriticalPath prints the longest chain of dependent stacks, by their
+// estimated duration from the run history, followed by the total duration.
+func (c *cli) printCriticalPath(stacks config.List[*config.SortableStack]) {
+	h, err := history.Load(c.rootdir())
+	if err != nil {
+		fatal(err, "loading run history")
+	}
+
+	estimate := func(s *config.Stack) time.Duration {
+		d, _ := estimateStack(h, s)
+		return d
+	}
+
+	path, total, reason, err := run.CriticalPath(c.cfg(), stacks, estimate)
+	if err != nil {
+		if errors.IsKind(err, dag.ErrCycleDetected) {
+			fatal(err, "cycle detected on run order: %s", reason)
+		} else {
+			fatal(err, "failed to compute the critical path")
+		}
+	}
+
+	for _, s := range path {
+		d, ok := estimateStack(h, s.Stack)
+		if !ok {
+			c.output.MsgStdOut("%s (no history)", s.Dir())
+			continue
+		}
+		c.output.MsgStdOut("%s (%s)", s.Dir(), d.Round(time.Millisecond))
+	}
+	if len(path) > 0 {
+		c.output.MsgStdOut("Estimated duration: %s", total.Round(time.Millisecond))
+	}
+}
+
+// estimateStack returns the estimated duration of the stack from the history,
+// which records each variant by its variant path. The variants of a stack are
+// executed one after the other, so their durations are summed. It returns
+// false if there's no history for the stack.
+func estimateStack(h history.History, st *config.Stack) (time.Duration, bool) {
+	var total time.Duration
+	var found bool
+	for _, variant := range st.ExpandVariants() {
+		d, ok := h.Estimate(variant.VariantPath(), nil)
+		if ok {
+			total += d
+			found = true
+		}
+	}
+	return total, found
+}
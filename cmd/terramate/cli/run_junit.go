@@ -0,0 +1,126 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/terramate-io/terramate/errors"
+)
+
+type (
+	junitTestSuites struct {
+		XMLName  xml.Name         `xml:"testsuites"`
+		Name     string           `xml:"name,attr"`
+		Tests    int              `xml:"tests,attr"`
+		Failures int              `xml:"failures,attr"`
+		Skipped  int              `xml:"skipped,attr"`
+		Time     string           `xml:"time,attr"`
+		Suites   []junitTestSuite `xml:"testsuite"`
+	}
+
+	junitTestSuite struct {
+		Name      string          `xml:"name,attr"`
+		Tests     int             `xml:"tests,attr"`
+		Failures  int             `xml:"failures,attr"`
+		Skipped   int             `xml:"skipped,attr"`
+		Time      string          `xml:"time,attr"`
+		Timestamp string          `xml:"timestamp,attr"`
+		Cases     []junitTestCase `xml:"testcase"`
+	}
+
+	junitTestCase struct {
+		Name      string        `xml:"name,attr"`
+		Classname string        `xml:"classname,attr"`
+		Time      string        `xml:"time,attr"`
+		Failure   *junitFailure `xml:"failure,omitempty"`
+		Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	}
+
+	junitFailure struct {
+		Message string `xml:"message,attr"`
+		Type    string `xml:"type,attr"`
+		Output  string `xml:",chardata"`
+	}
+
+	junitSkipped struct {
+		Message string `xml:"message,attr"`
+	}
+)
+
+// writeJUnit writes the report as JUnit XML into the given file.
+// Each stack command is a testcase and the captured stderr of failed commands
+// is set as the failure output.
+func (r *runReport) writeJUnit(path string) error {
+	suite := junitTestSuite{
+		Name:      "terramate",
+		Timestamp: r.StartedAt.Format("2006-01-02T15:04:05"),
+		Time:      junitTime(r.FinishedAt.Sub(r.StartedAt).Seconds()),
+	}
+
+	for _, entry := range r.Stacks {
+		name := entry.Path
+		if entry.Variant != "" {
+			name += "@" + entry.Variant
+		}
+		testcase := junitTestCase{
+			Name:      name,
+			Classname: strings.Join(entry.Command, " "),
+			Time:      junitTime(entry.Duration),
+		}
+
+		switch entry.Status {
+		case runStatusFailed, runStatusTimeout:
+			suite.Failures++
+			message := entry.Error
+			if entry.ExitCode != nil {
+				message = fmt.Sprintf("exit code %d: %s", *entry.ExitCode, entry.Error)
+			}
+			testcase.Failure = &junitFailure{
+				Message: message,
+				Type:    entry.Status,
+				Output:  string(entry.stderr),
+			}
+		case runStatusCanceled, runStatusSkipped:
+			suite.Skipped++
+			message := entry.Status
+			if entry.Reason != "" {
+				message += ": " + entry.Reason
+			}
+			testcase.Skipped = &junitSkipped{Message: message}
+		}
+
+		suite.Cases = append(suite.Cases, testcase)
+	}
+
+	suite.Tests = len(suite.Cases)
+
+	suites := junitTestSuites{
+		Name:     suite.Name,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+
+	data, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return errors.E(err, "marshaling JUnit report")
+	}
+
+	data = append([]byte(xml.Header), data...)
+	data = append(data, '\n')
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return errors.E(err, "writing JUnit report to %s", path)
+	}
+	return nil
+}
+
+func junitTime(seconds float64) string {
+	return fmt.Sprintf("%.3f", seconds)
+}
@@ -0,0 +1,50 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/run/lock"
+)
+
+// acquireRunLock takes the run lock of the project, so concurrent runs in the
+// same checkout are not allowed. It must be called after all validations, and
+// the fatal errors while the lock is held must use runFatal. It's a no-op if
+// noLock is set.
+func (c *cli) acquireRunLock(timeout time.Duration, noLock bool) {
+	if noLock {
+		log.Debug().Msg("run lock disabled by --no-lock")
+		return
+	}
+
+	l, err := lock.Acquire(c.rootdir(), timeout)
+	if err != nil {
+		if errors.IsKind(err, lock.ErrLocked) {
+			fatal(err, "another run is in progress (use --lock-timeout to wait for it or --no-lock to disable the lock)")
+		}
+		fatal(err, "acquiring the run lock")
+	}
+	c.runLock = l
+}
+
+// releaseRunLock releases the run lock, if acquired.
+func (c *cli) releaseRunLock() {
+	if c.runLock == nil {
+		return
+	}
+	if err := c.runLock.Release(); err != nil {
+		log.Warn().Err(err).Msg("failed to release the run lock")
+	}
+	c.runLock = nil
+}
+
+// runFatal releases the run lock, so the lock owner is cleared, and exits with
+// the fatal error. It must be used instead of fatal while the lock is held.
+func (c *cli) runFatal(err error, args ...any) {
+	c.releaseRunLock()
+	fatal(err, args...)
+}
@@ -0,0 +1,138 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fatih/color"
+	"github.com/terramate-io/terramate/cloud"
+	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/errors"
+)
+
+// rootStackLogName is the name of the log file of the stack at the root of the
+// project, which has no name in its path.
+const rootStackLogName = "_root"
+
+// outputPrefixColors are the colors of the output prefix, chosen by the index
+// of the stack in the run order.
+var outputPrefixColors = []color.Attribute{
+	color.FgCyan,
+	color.FgGreen,
+	color.FgYellow,
+	color.FgBlue,
+	color.FgMagenta,
+	color.FgRed,
+}
+
+// stackOutput is the line oriented output of a stack, which prefixes each
+// line with the stack path and copies the output into the stack log file, as
+// requested by the --output-prefix and --log-dir options.
+type stackOutput struct {
+	stdout  *cloud.LineWriter
+	stderr  *cloud.LineWriter
+	logFile *os.File
+}
+
+// newStackOutput creates the output of the running stack, writing into the
+// given stdout and stderr. When the output is not buffered, each line is
+// written while holding the cli output lock so lines of concurrent stacks do
+// not interleave. It returns nil if no output option is enabled.
+func (c *cli) newStackOutput(r *runningStack, stdout, stderr io.Writer, buffered bool) (*stackOutput, error) {
+	prefixed := c.parsedArgs.Run.OutputPrefix
+	logDir := c.parsedArgs.Run.LogDir
+	if !prefixed && logDir == "" {
+		return nil, nil
+	}
+
+	o := &stackOutput{}
+	if logDir != "" {
+		f, err := createStackLogFile(logDir, r.runContext.Stack)
+		if err != nil {
+			return nil, err
+		}
+		o.logFile = f
+	}
+
+	var prefix []byte
+	if prefixed {
+		prefix = []byte(c.outputPrefix(r))
+	}
+
+	var logMu sync.Mutex
+	writer := func(out io.Writer) *cloud.LineWriter {
+		return cloud.NewLineWriter(func(line []byte) {
+			if o.logFile != nil {
+				logMu.Lock()
+				// the log file is a copy of the output, which is still
+				// written even if the log file can't be written.
+				_, _ = o.logFile.Write(line)
+				logMu.Unlock()
+			}
+
+			if !buffered {
+				c.outputMu.Lock()
+				defer c.outputMu.Unlock()
+			}
+			if prefix != nil {
+				_, _ = out.Write(prefix)
+			}
+			_, _ = out.Write(line)
+		})
+	}
+
+	o.stdout = writer(stdout)
+	o.stderr = writer(stderr)
+	return o, nil
+}
+
+// close waits for all the output to be written and closes the log file.
+func (o *stackOutput) close() error {
+	errs := errors.L()
+	errs.Append(o.stdout.Close())
+	errs.Append(o.stderr.Close())
+	if o.logFile != nil {
+		errs.Append(o.logFile.Close())
+	}
+	return errs.AsError()
+}
+
+// outputPrefix returns the prefix of the output lines of the running stack.
+func (c *cli) outputPrefix(r *runningStack) string {
+	prefix := "[" + r.runContext.Stack.VariantPath() + "]"
+	if c.parsedArgs.Run.OutputPrefixColor {
+		attr := outputPrefixColors[r.index%len(outputPrefixColors)]
+		col := color.New(attr)
+		col.EnableColor()
+		prefix = col.Sprint(prefix)
+	}
+	return prefix + " "
+}
+
+// createStackLogFile creates the <logDir>/<stack path>.log file, or the
+// <logDir>/<stack path>@<variant>.log file for a stack variant, truncating it
+// if it already exists.
+func createStackLogFile(logDir string, st *config.Stack) (*os.File, error) {
+	stackPath := st.VariantPath()
+	name := filepath.FromSlash(st.Dir.String())
+	if st.Dir.String() == "/" {
+		name = rootStackLogName
+	}
+	if st.Variant != nil {
+		name += "@" + st.Variant.Name
+	}
+	path := filepath.Join(logDir, name+".log")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, errors.E(err, "creating log dir for stack %s", stackPath)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, errors.E(err, "creating log file for stack %s", stackPath)
+	}
+	return f, nil
+}
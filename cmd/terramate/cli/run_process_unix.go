@@ -0,0 +1,66 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build aix || android || darwin || dragonfly || freebsd || hurd || illumos || ios || linux || netbsd || openbsd || solaris
+
+package cli
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup makes the command start in its own process group, so the
+// signals forwarded by Terramate reach all its processes, like the commands
+// started by wrappers (eg.: sh -c, tfenv, terragrunt). It returns false if the
+// command reads from an interactive terminal, as only the foreground process
+// group of the terminal can read from it. In this case, the command stays in
+// the Terramate process group, which gets the signals of the terminal.
+func setProcessGroup(cmd *exec.Cmd) bool {
+	if isTerminal(cmd.Stdin) {
+		return false
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	return true
+}
+
+// signalProcess sends the signal to the started command or, if group is set,
+// to its whole process group.
+func signalProcess(cmd *exec.Cmd, group bool, sig os.Signal) error {
+	sysSig, ok := sig.(syscall.Signal)
+	if !group || !ok {
+		return cmd.Process.Signal(sig)
+	}
+	return syscall.Kill(-cmd.Process.Pid, sysSig)
+}
+
+// killProcess kills the started command or, if group is set, its whole
+// process group.
+func killProcess(cmd *exec.Cmd, group bool) error {
+	if !group {
+		return cmd.Process.Kill()
+	}
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// processGroupExists tells if any process of the process group of the started
+// command is still running.
+func processGroupExists(cmd *exec.Cmd) bool {
+	return syscall.Kill(-cmd.Process.Pid, 0) == nil
+}
+
+func isTerminal(r any) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+	st, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return st.Mode()&os.ModeCharDevice != 0
+}
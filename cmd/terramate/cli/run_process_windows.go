@@ -0,0 +1,33 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build windows
+
+package cli
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup is not supported on Windows, where the signals are only
+// sent to the started command.
+func setProcessGroup(_ *exec.Cmd) bool {
+	return false
+}
+
+// signalProcess sends the signal to the started command.
+func signalProcess(cmd *exec.Cmd, _ bool, sig os.Signal) error {
+	return cmd.Process.Signal(sig)
+}
+
+// killProcess kills the started command.
+func killProcess(cmd *exec.Cmd, _ bool) error {
+	return cmd.Process.Kill()
+}
+
+// processGroupExists always returns false as the commands don't run in their
+// own process group on Windows.
+func processGroupExists(_ *exec.Cmd) bool {
+	return false
+}
@@ -0,0 +1,155 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/terramate-io/terramate/errors"
+)
+
+// Status of the stacks in the run report.
+const (
+	runStatusOK       = "ok"
+	runStatusFailed   = "failed"
+	runStatusCanceled = "canceled"
+	runStatusSkipped  = "skipped"
+	runStatusTimeout  = "timeout"
+)
+
+// runReport is the machine-readable report of the stacks execution, written
+// when --report-file is provided.
+type runReport struct {
+	StartedAt  time.Time        `json:"started_at"`
+	FinishedAt time.Time        `json:"finished_at"`
+	Stacks     []runReportEntry `json:"stacks"`
+
+	// captureStderr tells if the stderr of the commands must be kept in the
+	// report entries.
+	captureStderr bool
+}
+
+// runReportEntry is the report of a single command executed in a stack.
+type runReportEntry struct {
+	Path       string     `json:"path"`
+	Variant    string     `json:"variant,omitempty"`
+	ID         string     `json:"id,omitempty"`
+	Command    []string   `json:"command,omitempty"`
+	Status     string     `json:"status"`
+	ExitCode   *int       `json:"exit_code,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Duration   float64    `json:"duration_seconds"`
+	Reason     string     `json:"reason,omitempty"`
+	Error      string     `json:"error,omitempty"`
+
+	stderr []byte
+}
+
+func newRunReport(captureStderr bool) *runReport {
+	return &runReport{
+		StartedAt:     time.Now().UTC(),
+		Stacks:        []runReportEntry{},
+		captureStderr: captureStderr,
+	}
+}
+
+// capturesStderr tells if the stderr of the commands must be provided when
+// adding results. It returns false if the report is nil.
+func (r *runReport) capturesStderr() bool {
+	return r != nil && r.captureStderr
+}
+
+// addResult records the result of executing the command of the given context.
+// The reason is only used when the execution is not successful.
+// The stderr is the captured standard error of the command, if any.
+// It's a no-op if the report is nil.
+func (r *runReport) addResult(runContext ExecContext, res RunResult, err error, reason string, stderr []byte) {
+	if r == nil {
+		return
+	}
+
+	entry := newRunReportEntry(runContext)
+	entry.StartedAt = res.StartedAt
+	entry.FinishedAt = res.FinishedAt
+	if res.StartedAt != nil && res.FinishedAt != nil {
+		entry.Duration = res.FinishedAt.Sub(*res.StartedAt).Seconds()
+	}
+	if res.ExitCode >= 0 {
+		exitCode := res.ExitCode
+		entry.ExitCode = &exitCode
+	}
+
+	switch {
+	case err == nil:
+		entry.Status = runStatusOK
+	case errors.IsKind(err, ErrRunCanceled):
+		entry.Status = runStatusCanceled
+		entry.Reason = reason
+	case errors.IsKind(err, ErrRunTimeout):
+		entry.Status = runStatusTimeout
+		entry.Reason = reason
+		entry.Error = err.Error()
+		entry.stderr = stderr
+	default:
+		entry.Status = runStatusFailed
+		entry.Reason = reason
+		entry.Error = err.Error()
+		entry.stderr = stderr
+	}
+
+	r.Stacks = append(r.Stacks, entry)
+}
+
+// addCanceled records the given contexts as canceled by the given reason.
+// It's a no-op if the report is nil.
+func (r *runReport) addCanceled(runContexts []ExecContext, reason string) {
+	r.add(runContexts, runStatusCanceled, reason)
+}
+
+// addSkipped records the given contexts as skipped by the given reason.
+// It's a no-op if the report is nil.
+func (r *runReport) addSkipped(runContexts []ExecContext, reason string) {
+	r.add(runContexts, runStatusSkipped, reason)
+}
+
+func (r *runReport) add(runContexts []ExecContext, status, reason string) {
+	if r == nil {
+		return
+	}
+	for _, runContext := range runContexts {
+		entry := newRunReportEntry(runContext)
+		entry.Status = status
+		entry.Reason = reason
+		r.Stacks = append(r.Stacks, entry)
+	}
+}
+
+// writeJSON writes the report as JSON into the given file.
+func (r *runReport) writeJSON(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return errors.E(err, "marshaling run report")
+	}
+
+	data = append(data, '\n')
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return errors.E(err, "writing run report to %s", path)
+	}
+	return nil
+}
+
+func newRunReportEntry(runContext ExecContext) runReportEntry {
+	entry := runReportEntry{
+		Path:    runContext.Stack.Dir.String(),
+		ID:      runContext.Stack.ID,
+		Command: runContext.Cmd,
+	}
+	if runContext.Stack.Variant != nil {
+		entry.Variant = runContext.Stack.Variant.Name
+	}
+	return entry
+}
@@ -0,0 +1,76 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/terramate-io/terramate/errors"
+)
+
+// retryPolicy defines when a failed stack command must be executed again.
+// The zero value disables retries.
+type retryPolicy struct {
+	// retries is the maximum number of retries after the first attempt.
+	retries int
+
+	// delay is the time waited before each retry.
+	delay time.Duration
+
+	// exitCodes and stderrPatterns restrict which failures are retryable.
+	// If both are empty, every failure is retryable.
+	exitCodes      []int
+	stderrPatterns []*regexp.Regexp
+}
+
+// newRetryPolicy creates a retry policy from the given options, validating
+// them.
+func newRetryPolicy(retries int, delay time.Duration, exitCodes []int, stderrPatterns []string) (retryPolicy, error) {
+	if retries < 0 {
+		return retryPolicy{}, errors.E("--retries must be greater than or equal to 0")
+	}
+	if delay < 0 {
+		return retryPolicy{}, errors.E("--retry-delay must not be negative")
+	}
+
+	policy := retryPolicy{
+		retries:   retries,
+		delay:     delay,
+		exitCodes: exitCodes,
+	}
+	for _, pattern := range stderrPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return retryPolicy{}, errors.E(err, "invalid --retry-on-stderr regex %q", pattern)
+		}
+		policy.stderrPatterns = append(policy.stderrPatterns, re)
+	}
+	return policy, nil
+}
+
+// capturesStderr tells if the stderr of the commands is needed to decide if
+// they are retryable.
+func (p retryPolicy) capturesStderr() bool {
+	return len(p.stderrPatterns) > 0
+}
+
+// retryable tells if a failed attempt, with the given exit code and stderr,
+// can be retried. It doesn't take into account the number of attempts.
+func (p retryPolicy) retryable(exitCode int, stderr []byte) bool {
+	if len(p.exitCodes) == 0 && len(p.stderrPatterns) == 0 {
+		return true
+	}
+	for _, code := range p.exitCodes {
+		if code == exitCode {
+			return true
+		}
+	}
+	for _, re := range p.stderrPatterns {
+		if re.Match(stderr) {
+			return true
+		}
+	}
+	return false
+}
@@ -4,10 +4,12 @@
 package cli
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"strings"
+	"time"
 
 	"os/exec"
 
@@ -51,6 +53,11 @@ func (c *cli) runScript() {
 		}
 	}
 
+	stacks = c.addStackDependencies(stacks,
+		c.parsedArgs.Experimental.Script.Run.IncludeDependencies,
+		c.parsedArgs.Experimental.Script.Run.IncludeDependents,
+	)
+
 	// search for the script and prepare a list of script/stack entries
 	m := newScriptsMatcher(c.parsedArgs.Experimental.Script.Run.Labels)
 	m.Search(c.cfg(), stacks)
@@ -63,9 +70,27 @@ func (c *cli) runScript() {
 
 	if c.parsedArgs.Experimental.Script.Run.DryRun {
 		c.output.MsgStdErr("This is a dry run, commands will not be executed.")
+	} else {
+		c.acquireRunLock(c.parsedArgs.Experimental.Script.Run.LockTimeout, c.parsedArgs.Experimental.Script.Run.NoLock)
+		c.initRunReport(c.parsedArgs.Experimental.Script.Run.ReportFile, c.parsedArgs.Experimental.Script.Run.JUnitFile)
+	}
+
+	// cancelRemaining reports the stacks not processed yet as canceled.
+	cancelRemaining := func(resultIndex, stackIndex int) {
+		var canceled []ExecContext
+		for i := resultIndex; i < len(m.Results); i++ {
+			stacks := m.Results[i].Stacks
+			if i == resultIndex {
+				stacks = stacks[stackIndex+1:]
+			}
+			for _, st := range stacks {
+				canceled = append(canceled, ExecContext{Stack: st.Stack})
+			}
+		}
+		c.runReport.addCanceled(canceled, "previous stack failed")
 	}
 
-	for _, result := range m.Results {
+	for resultIndex, result := range m.Results {
 		if len(result.Stacks) == 0 {
 			continue
 		}
@@ -76,15 +101,32 @@ func (c *cli) runScript() {
 			color.BlueString(fmt.Sprintf("%d", len(result.ScriptCfg.Jobs))),
 		)
 
-		for _, st := range result.Stacks {
+		for stackIndex, st := range result.Stacks {
+			if st.Stack.Disabled {
+				c.output.MsgStdErr("Skipping stack %s: %s", st.Dir(), stackDisabledSkipReason)
+				c.runReport.addSkipped([]ExecContext{{Stack: st.Stack}}, stackDisabledSkipReason)
+				continue
+			}
+
+			ok, err := run.EvalCondition(c.cfg(), st.Stack)
+			if err != nil {
+				c.runFatal(err, "failed to evaluate run.condition")
+			}
+
+			if !ok {
+				c.output.MsgStdErr("Skipping stack %s: %s", st.Dir(), runConditionSkipReason)
+				c.runReport.addSkipped([]ExecContext{{Stack: st.Stack}}, runConditionSkipReason)
+				continue
+			}
+
 			ectx, err := scriptEvalContext(c.cfg(), st.Stack)
 			if err != nil {
-				logger.Fatal().Err(err).Msg("failed to get context")
+				c.runFatal(err, "failed to get context")
 			}
 
 			evalScript, err := config.EvalScript(ectx, *result.ScriptCfg)
 			if err != nil {
-				logger.Fatal().Err(err).Msg("failed to eval script")
+				c.runFatal(err, "failed to eval script")
 			}
 
 			for jobNum, j := range evalScript.Jobs {
@@ -94,33 +136,69 @@ func (c *cli) runScript() {
 
 					env, err := run.LoadEnv(c.cfg(), st.Stack)
 					if err != nil {
-						logger.Fatal().Err(err).Msg("failed to load env")
+						c.runFatal(err, "failed to load env")
+					}
+
+					res, stderr, err := c.executeCommand(cmd, st.Dir().HostPath(c.rootdir()), newEnvironFrom(c.cfg(), env))
+					if c.parsedArgs.Experimental.Script.Run.DryRun {
+						continue
 					}
 
-					if err := c.executeCommand(cmd, st.Dir().HostPath(c.rootdir()), newEnvironFrom(env)); err != nil {
-						logger.Fatal().Err(err).Msg("unable to execute command")
+					c.runReport.addResult(ExecContext{Stack: st.Stack, Cmd: cmd}, res, err, "", stderr)
+					if err != nil {
+						cancelRemaining(resultIndex, stackIndex)
+						c.writeRunReport(c.parsedArgs.Experimental.Script.Run.ReportFile, c.parsedArgs.Experimental.Script.Run.JUnitFile)
+						c.runFatal(err, "unable to execute command")
 					}
 				}
 			}
 		}
 	}
+
+	c.writeRunReport(c.parsedArgs.Experimental.Script.Run.ReportFile, c.parsedArgs.Experimental.Script.Run.JUnitFile)
+	c.releaseRunLock()
 }
 
-func (c *cli) executeCommand(cmd []string, wd string, env []string) error {
+// executeCommand executes the command and returns its result and also the
+// captured stderr, if requested by the run report.
+func (c *cli) executeCommand(cmd []string, wd string, env []string) (RunResult, []byte, error) {
+	res := RunResult{ExitCode: -1}
 	if c.parsedArgs.Experimental.Script.Run.DryRun {
-		return nil
+		return res, nil, nil
+	}
+
+	stderr := c.stderr
+	var capturedStderr *bytes.Buffer
+	if c.runReport.capturesStderr() {
+		capturedStderr = &bytes.Buffer{}
+		stderr = io.MultiWriter(stderr, capturedStderr)
 	}
 
-	newCmd, err := makeCommand(cmd, wd, env, c.stdout, c.stderr)
+	newCmd, err := makeCommand(cmd, wd, env, c.stdout, stderr)
 	if err != nil {
-		return errors.E(err, "failed to prepare command")
+		return res, nil, errors.E(ErrRunCommandNotFound, err, "failed to prepare command")
 	}
 
-	if err := newCmd.Run(); err != nil {
-		return errors.E(err, "failed to execute command")
+	startTime := time.Now().UTC()
+	err = newCmd.Run()
+	endTime := time.Now().UTC()
+
+	res.StartedAt = &startTime
+	res.FinishedAt = &endTime
+	if newCmd.ProcessState != nil {
+		res.ExitCode = newCmd.ProcessState.ExitCode()
+	}
+
+	var stderrOutput []byte
+	if capturedStderr != nil {
+		stderrOutput = capturedStderr.Bytes()
+	}
+
+	if err != nil {
+		return res, stderrOutput, errors.E(ErrRunFailed, err, "failed to execute command")
 	}
 
-	return nil
+	return res, stderrOutput, nil
 }
 
 func makeCommand(command []string, dir string, env []string, stdout, stderr io.Writer) (*exec.Cmd, error) {
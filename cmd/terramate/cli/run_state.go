@@ -0,0 +1,123 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/run/state"
+)
+
+// runState keeps the local state of the current run updated.
+type runState struct {
+	rootdir string
+	state   state.State
+}
+
+// initRunState creates a new local run state for the given stacks.
+// When resuming, the stacks which already succeeded with the same command and
+// git commit in the previous run are returned as skipped and must not be
+// executed again.
+func (c *cli) initRunState(runStacks []ExecContext, resume bool) (pending, skipped []ExecContext) {
+	logger := log.With().
+		Str("action", "cli.initRunState()").
+		Logger()
+
+	commit := ""
+	if c.prj.isRepo {
+		commit = c.prj.headCommit()
+	}
+
+	var prev state.State
+	if resume {
+		var found bool
+		var err error
+		prev, found, err = state.Load(c.rootdir())
+		if err != nil {
+			c.runFatal(err, "loading previous run state")
+		}
+		if !found {
+			logger.Warn().Msg("no previous run state found, running all stacks")
+		}
+	}
+
+	st := state.State{
+		Commit:    commit,
+		StartedAt: time.Now().UTC(),
+	}
+
+	for _, runContext := range runStacks {
+		path := runContext.Stack.VariantPath()
+		stackState := state.Stack{
+			Path:    path,
+			Command: runContext.Cmd,
+			Status:  state.Pending,
+			Commit:  commit,
+		}
+
+		if resume && prev.Succeeded(path, runContext.Cmd, commit) {
+			logger.Info().
+				Str("stack", path).
+				Msg("skipping stack which already succeeded in the previous run")
+
+			stackState.Status = state.OK
+			skipped = append(skipped, runContext)
+		} else {
+			pending = append(pending, runContext)
+		}
+
+		st.Stacks = append(st.Stacks, stackState)
+	}
+
+	c.runState = &runState{
+		rootdir: c.rootdir(),
+		state:   st,
+	}
+	c.runState.save()
+	return pending, skipped
+}
+
+// update sets the status of the stack based on the execution error.
+// It's a no-op if the run state is nil.
+func (s *runState) update(runContext ExecContext, err error) {
+	if s == nil {
+		return
+	}
+
+	status := state.OK
+	switch {
+	case err == nil:
+	case errors.IsKind(err, ErrRunCanceled):
+		status = state.Canceled
+	default:
+		status = state.Failed
+	}
+
+	s.state.Set(runContext.Stack.VariantPath(), status)
+	s.save()
+}
+
+// cancel sets the status of the given stacks as canceled.
+// It's a no-op if the run state is nil.
+func (s *runState) cancel(runContexts []ExecContext) {
+	if s == nil || len(runContexts) == 0 {
+		return
+	}
+
+	for _, runContext := range runContexts {
+		s.state.Set(runContext.Stack.VariantPath(), state.Canceled)
+	}
+	s.save()
+}
+
+// save persists the run state. The local run files, as the state and the run
+// history, are a best-effort record of the execution: failing to write them is
+// only logged and never fails the run.
+func (s *runState) save() {
+	if err := state.Save(s.rootdir, s.state); err != nil {
+		log.Warn().Err(err).Msg("failed to save the run state")
+	}
+}
@@ -250,6 +250,54 @@ func TestCLIRunWithCloudSyncDeployment(t *testing.T) {
 	}
 }
 
+func TestCLIRunWithCloudSyncDeploymentVariants(t *testing.T) {
+	t.Parallel()
+
+	cloudData, err := cloudstore.LoadDatastore(testserverJSONFile)
+	assert.NoError(t, err)
+	addr := startFakeTMCServer(t, cloudData)
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`f:stack/stack.tm:stack {
+		  id = "MyStack"
+		  variant "eu" {}
+		  variant "us" {}
+		}`,
+	})
+	s.Git().CommitAll("all stacks committed")
+
+	env := RemoveEnv(os.Environ(), "CI")
+	env = append(env, "TMC_API_URL=http://"+addr)
+	cli := NewCLI(t, s.RootDir(), env...)
+
+	uuid, err := uuid.NewRandom()
+	assert.NoError(t, err)
+	runid := uuid.String()
+	cli.AppendEnv = []string{"TM_TEST_RUN_ID=" + runid}
+
+	AssertRunResult(t, cli.Run("run", "--cloud-sync-deployment", "--", HelperPath, "true"), RunExpected{})
+
+	org := cloudData.MustOrgByName("terramate")
+	cloudEvents, err := cloudData.GetDeploymentEvents(org.UUID, cloud.UUID(runid))
+	assert.NoError(t, err)
+
+	gotEvents := eventsResponse{}
+	for id, events := range cloudEvents {
+		gotEvents[id] = []string{}
+		for _, status := range events {
+			gotEvents[id] = append(gotEvents[id], status.String())
+		}
+	}
+	wantEvents := eventsResponse{
+		"mystack@eu": []string{"pending", "running", "ok"},
+		"mystack@us": []string{"pending", "running", "ok"},
+	}
+	if diff := cmp.Diff(gotEvents, wantEvents); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
 func assertRunEvents(t *testing.T, cloudData *cloudstore.Data, runid string, ids []string, events map[string][]string) {
 	expectedEvents := eventsResponse{}
 	if events == nil {
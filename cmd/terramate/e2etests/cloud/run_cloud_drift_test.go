@@ -460,6 +460,47 @@ func TestCLIRunWithCloudSyncDriftStatus(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "variants are synced with the lowercased variant id",
+			layout: []string{
+				`f:stack/stack.tm:stack {
+				  id = "MyStack"
+				  variant "eu" {}
+				  variant "us" {}
+				}`,
+			},
+			cmd: []string{
+				HelperPath, "exit", "2",
+			},
+			want: want{
+				drifts: expectedDriftStackPayloadRequests{
+					{
+						DriftStackPayloadRequest: cloud.DriftStackPayloadRequest{
+							Stack: cloud.Stack{
+								Repository:    "local",
+								DefaultBranch: "main",
+								Path:          "/stack@eu",
+								MetaName:      "stack",
+								MetaID:        "mystack@eu",
+							},
+							Status: drift.Drifted,
+						},
+					},
+					{
+						DriftStackPayloadRequest: cloud.DriftStackPayloadRequest{
+							Stack: cloud.Stack{
+								Repository:    "local",
+								DefaultBranch: "main",
+								Path:          "/stack@us",
+								MetaName:      "stack",
+								MetaID:        "mystack@us",
+							},
+							Status: drift.Drifted,
+						},
+					},
+				},
+			},
+		},
 	} {
 		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
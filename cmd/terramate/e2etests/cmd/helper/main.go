@@ -55,6 +55,10 @@ func main() {
 		cat(os.Args[2])
 	case "rm":
 		rm(os.Args[2])
+	case "flaky":
+		flaky(os.Args[2], os.Args[3], os.Args[4])
+	case "exclusive":
+		exclusive(os.Args[2], os.Args[3])
 	case "tempdir":
 		tempDir()
 	case "stack-abs-path":
@@ -116,6 +120,52 @@ func rm(fname string) {
 	checkerr(err)
 }
 
+// flaky fails with the given exit code for the given number of executions and
+// succeeds afterwards. The number of executions is kept in the counter file.
+func flaky(counterFile, failuresStr, exitCodeStr string) {
+	failures, err := strconv.Atoi(failuresStr)
+	checkerr(err)
+	code, err := strconv.Atoi(exitCodeStr)
+	checkerr(err)
+
+	count := 0
+	data, err := os.ReadFile(counterFile)
+	if err == nil {
+		count, err = strconv.Atoi(string(data))
+		checkerr(err)
+	} else if !os.IsNotExist(err) {
+		checkerr(err)
+	}
+
+	count++
+	checkerr(os.WriteFile(counterFile, []byte(strconv.Itoa(count)), 0644))
+
+	if count <= failures {
+		fmt.Fprintf(os.Stderr, "attempt %d failed\n", count)
+		os.Exit(code)
+	}
+	fmt.Printf("attempt %d succeeded\n", count)
+}
+
+// exclusive creates the marker file, sleeps for the given duration and removes
+// it. It fails if the marker file already exists, which means another
+// exclusive command is executing at the same time.
+func exclusive(markerFile, durationStr string) {
+	d, err := time.ParseDuration(durationStr)
+	checkerr(err)
+
+	f, err := os.OpenFile(markerFile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "overlapping execution: %v\n", err)
+		os.Exit(1)
+	}
+	checkerr(f.Close())
+
+	time.Sleep(d)
+	checkerr(os.Remove(markerFile))
+	fmt.Println("done")
+}
+
 // tempdir creates a temporary directory.
 func tempDir() {
 	tmpdir, err := os.MkdirTemp("", "tm-tmpdir")
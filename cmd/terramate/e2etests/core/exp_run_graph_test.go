@@ -0,0 +1,195 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/madlambda/spells/assert"
+	. "github.com/terramate-io/terramate/cmd/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunGraphFormats(t *testing.T) {
+	t.Parallel()
+
+	layout := []string{
+		`s:network:id=network;tags=["infra"]`,
+		`s:app:after=["/network"];wants=["/db"];tags=["app"]`,
+		`s:db:after=["/network"];tags=["app","data"]`,
+		`s:monitor:after=["/app"]`,
+	}
+
+	type testcase struct {
+		name string
+		args []string
+		want RunExpected
+	}
+
+	for _, tc := range []testcase{
+		{
+			name: "mermaid",
+			args: []string{"--format", "mermaid"},
+			want: RunExpected{
+				Stdout: `flowchart TD
+    s0["app"]
+    s1["db"]
+    s2["monitor"]
+    s3["network"]
+    s3 --> s0
+    s3 --> s1
+    s0 --> s2
+    s0 -. wants .-> s1
+`,
+			},
+		},
+		{
+			name: "mermaid with stack.dir label",
+			args: []string{"--format", "mermaid", "--label", "stack.dir", "--tags", "app"},
+			want: RunExpected{
+				Stdout: `flowchart TD
+    s0["/app"]
+    s1["/db"]
+    s0 -. wants .-> s1
+`,
+			},
+		},
+		{
+			name: "text",
+			args: []string{"--format", "text"},
+			want: RunExpected{
+				Stdout: `network
+├── app
+│   └── monitor
+└── db
+`,
+			},
+		},
+		{
+			name: "text filtered by tags",
+			args: []string{"--format", "text", "--no-tags", "infra"},
+			want: RunExpected{
+				Stdout: `app
+└── monitor
+db
+`,
+			},
+		},
+		{
+			name: "text keeps the order through filtered stacks",
+			args: []string{"--format", "text", "--no-tags", "app"},
+			want: RunExpected{
+				Stdout: `network
+└── monitor
+`,
+			},
+		},
+		{
+			name: "dot keeps the order through filtered stacks",
+			args: []string{"--format", "dot", "--no-tags", "app"},
+			want: RunExpected{
+				Stdout: `digraph  {
+	
+	n1[label="monitor"];
+	n2[label="network"];
+	n1->n2;
+	
+}
+`,
+			},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := sandbox.New(t)
+			s.BuildTree(layout)
+
+			cli := NewCLI(t, s.RootDir())
+			args := append([]string{"experimental", "run-graph"}, tc.args...)
+			AssertRunResult(t, cli.Run(args...), tc.want)
+		})
+	}
+}
+
+func TestRunGraphJSON(t *testing.T) {
+	t.Parallel()
+
+	type (
+		node struct {
+			Path string   `json:"path"`
+			ID   string   `json:"id"`
+			Name string   `json:"name"`
+			Tags []string `json:"tags"`
+		}
+		edge struct {
+			From string `json:"from"`
+			To   string `json:"to"`
+			Type string `json:"type"`
+		}
+		graph struct {
+			Nodes []node `json:"nodes"`
+			Edges []edge `json:"edges"`
+		}
+	)
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:network:id=network;tags=["infra"]`,
+		`s:app:after=["/network"];wanted_by=["/db"]`,
+		`s:db:after=["/network"]`,
+	})
+
+	cli := NewCLI(t, s.RootDir())
+	res := cli.Run("experimental", "run-graph", "--format", "json")
+	AssertRunResult(t, res, RunExpected{IgnoreStdout: true})
+
+	var got graph
+	assert.NoError(t, json.Unmarshal([]byte(res.Stdout), &got))
+
+	want := graph{
+		Nodes: []node{
+			{Path: "/app", Name: "app", Tags: []string{}},
+			{Path: "/db", Name: "db", Tags: []string{}},
+			{Path: "/network", ID: "network", Name: "network", Tags: []string{"infra"}},
+		},
+		Edges: []edge{
+			{From: "/network", To: "/app", Type: "order"},
+			{From: "/network", To: "/db", Type: "order"},
+			{From: "/db", To: "/app", Type: "wants"},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("run graph mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRunGraphChanged(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:network`,
+		`s:app:after=["/network"]`,
+		`s:db:after=["/network"]`,
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+	git.CheckoutNew("change-app")
+
+	s.DirEntry("app").CreateFile("main.tf", "# changed")
+	s.DirEntry("network").CreateFile("main.tf", "# changed")
+	git.CommitAll("stacks changed")
+
+	cli := NewCLI(t, s.RootDir())
+	AssertRunResult(t, cli.Run("experimental", "run-graph", "--changed", "--format", "text"), RunExpected{
+		Stdout: `network
+└── app
+`,
+	})
+}
@@ -0,0 +1,193 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	. "github.com/terramate-io/terramate/cmd/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestListChangedDetectsGlobalsAndGeneratedCodeChanges(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		  terramate {
+		    config {
+		      change_detection {
+		        evaluation = true
+		      }
+		    }
+		  }`,
+		`f:stacks/globals.tm:
+		  globals {
+		    config = {
+		      region = "eu-west-1"
+		      dir    = terramate.root.path.fs.absolute
+		      name   = terramate.root.path.fs.basename
+		    }
+		  }`,
+		`f:generated/generate.tm:
+		  generate_file "file.txt" {
+		    content = "v1"
+		  }`,
+		`s:stacks/a`,
+		`s:stacks/b`,
+		`s:generated/stack`,
+		`s:other`,
+	})
+
+	cli := NewCLI(t, s.RootDir())
+	AssertRunResult(t, cli.Run("generate"), RunExpected{IgnoreStdout: true})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+	git.CheckoutNew("change")
+
+	test.WriteFile(t, filepath.Join(s.RootDir(), "stacks"), "globals.tm", `
+globals {
+  config = {
+    region = "us-east-1"
+    dir    = terramate.root.path.fs.absolute
+    name   = terramate.root.path.fs.basename
+  }
+}
+`)
+	git.CommitAll("change globals")
+
+	AssertRunResult(t, cli.ListChangedStacks("--why"), RunExpected{
+		Stdout: `stacks/a - stack changed because global "config.region" changed` + "\n" +
+			`stacks/b - stack changed because global "config.region" changed` + "\n",
+	})
+
+	test.WriteFile(t, filepath.Join(s.RootDir(), "generated"), "generate.tm", `
+generate_file "file.txt" {
+  content = "v2"
+}
+`)
+	git.CommitAll("change generated code")
+
+	AssertRunResult(t, cli.ListChangedStacks("--why"), RunExpected{
+		Stdout: `generated/stack - stack changed because generated file "file.txt" changed` + "\n" +
+			`stacks/a - stack changed because global "config.region" changed` + "\n" +
+			`stacks/b - stack changed because global "config.region" changed` + "\n",
+	})
+}
+
+func TestListChangedIgnoresUnchangedGlobalsValues(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		  terramate {
+		    config {
+		      change_detection {
+		        evaluation = true
+		      }
+		    }
+		  }`,
+		`f:stacks/globals.tm:
+		  globals {
+		    a = 1
+		  }`,
+		`s:stacks/a`,
+	})
+
+	cli := NewCLI(t, s.RootDir())
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+	git.CheckoutNew("change")
+
+	// the expression changes but the value is the same.
+	test.WriteFile(t, filepath.Join(s.RootDir(), "stacks"), "globals.tm", `
+globals {
+  a = 2 - 1
+}
+`)
+	git.CommitAll("change globals expression")
+
+	AssertRunResult(t, cli.ListChangedStacks(), RunExpected{})
+}
+
+func TestListChangedIgnoresEvaluationOfStacksFailingEvaluation(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		  terramate {
+		    config {
+		      change_detection {
+		        evaluation = true
+		      }
+		    }
+		  }`,
+		`f:stacks/globals.tm:
+		  globals {
+		    region = "eu-west-1"
+		  }`,
+		`f:broken/globals.tm:
+		  globals {
+		    content = tm_file("missing.txt")
+		  }`,
+		`s:stacks/a`,
+		`s:broken`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+	git.CheckoutNew("change")
+
+	test.WriteFile(t, filepath.Join(s.RootDir(), "stacks"), "globals.tm", `
+globals {
+  region = "us-east-1"
+}
+`)
+	git.CommitAll("change globals")
+
+	cli := NewCLI(t, s.RootDir())
+	cli.LogLevel = "warn"
+	AssertRunResult(t, cli.ListChangedStacks("--why"), RunExpected{
+		Stdout:      `stacks/a - stack changed because global "region" changed` + "\n",
+		StderrRegex: "because the globals of the stack failed to evaluate",
+	})
+}
+
+func TestListChangedDoesNotTrackEvaluationByDefault(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`f:stacks/globals.tm:
+		  globals {
+		    region = "eu-west-1"
+		  }`,
+		`s:stacks/a`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+	git.CheckoutNew("change")
+
+	test.WriteFile(t, filepath.Join(s.RootDir(), "stacks"), "globals.tm", `
+globals {
+  region = "us-east-1"
+}
+`)
+	git.CommitAll("change globals")
+
+	cli := NewCLI(t, s.RootDir())
+	AssertRunResult(t, cli.ListChangedStacks(), RunExpected{})
+}
@@ -0,0 +1,142 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	. "github.com/terramate-io/terramate/cmd/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestListChangedDetectsFilesReadByStackEvaluation(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		  terramate {
+		    config {
+		      change_detection {
+		        file_reads = true
+		      }
+		    }
+		  }`,
+		`f:templates/x.tpl:hello ${name}`,
+		`f:config/app.json:{}`,
+		`f:policies/a/policy.yaml:a`,
+		`f:stacks/genfile/generate.tm:
+		  generate_file "y" {
+		    content = tm_templatefile("../../templates/x.tpl", {name = "world"})
+		  }`,
+		`f:stacks/globals/globals.tm:
+		  globals {
+		    config = tm_file("../../config/app.json")
+		  }`,
+		`f:stacks/genhcl/generate.tm:
+		  generate_hcl "policies.hcl" {
+		    content {
+		      policies = tm_fileset("${terramate.root.path.fs.absolute}/policies", "**/*.yaml")
+		    }
+		  }`,
+		`s:stacks/genfile`,
+		`s:stacks/globals`,
+		`s:stacks/genhcl`,
+		`s:stacks/unrelated`,
+	})
+
+	cli := NewCLI(t, s.RootDir())
+	AssertRunResult(t, cli.Run("generate"), RunExpected{IgnoreStdout: true})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+	git.CheckoutNew("change")
+
+	test.WriteFile(t, filepath.Join(s.RootDir(), "templates"), "x.tpl", "bye ${name}")
+	git.CommitAll("change template")
+
+	AssertRunResult(t, cli.ListChangedStacks("--why"), RunExpected{
+		Stdout: `stacks/genfile - stack changed because templates/x.tpl read by generate_file "y" changed` + "\n",
+	})
+
+	test.WriteFile(t, filepath.Join(s.RootDir(), "config"), "app.json", `{"changed": true}`)
+	test.WriteFile(t, filepath.Join(s.RootDir(), "policies", "b"), "policy.yaml", "b")
+	git.CommitAll("change config and policies")
+
+	AssertRunResult(t, cli.ListChangedStacks("--why"), RunExpected{
+		Stdout: `stacks/genfile - stack changed because templates/x.tpl read by generate_file "y" changed` + "\n" +
+			`stacks/genhcl - stack changed because policies/b/policy.yaml read by generate_hcl "policies.hcl" changed` + "\n" +
+			`stacks/globals - stack changed because config/app.json read by globals changed` + "\n",
+	})
+}
+
+func TestListChangedIgnoresFileReadsOfStacksFailingEvaluation(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		  terramate {
+		    config {
+		      change_detection {
+		        file_reads = true
+		      }
+		    }
+		  }`,
+		`f:shared/file.txt:content`,
+		`f:stacks/reader/globals.tm:
+		  globals {
+		    content = tm_file("${terramate.root.path.fs.absolute}/shared/file.txt")
+		  }`,
+		`f:stacks/broken/globals.tm:
+		  globals {
+		    content = tm_file("missing.txt")
+		  }`,
+		`s:stacks/reader`,
+		`s:stacks/broken`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+	git.CheckoutNew("change")
+
+	test.WriteFile(t, filepath.Join(s.RootDir(), "shared"), "file.txt", "changed")
+	git.CommitAll("change shared file")
+
+	cli := NewCLI(t, s.RootDir())
+	cli.LogLevel = "warn"
+	AssertRunResult(t, cli.ListChangedStacks("--why"), RunExpected{
+		Stdout:      `stacks/reader - stack changed because shared/file.txt read by globals changed` + "\n",
+		StderrRegex: "ignoring the files read by the stack because its evaluation failed",
+	})
+}
+
+func TestListChangedDoesNotTrackFileReadsByDefault(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`f:shared/file.txt:content`,
+		`f:stacks/reader/globals.tm:
+		  globals {
+		    content = tm_file("${terramate.root.path.fs.absolute}/shared/file.txt")
+		  }`,
+		`s:stacks/reader`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+	git.CheckoutNew("change")
+
+	test.WriteFile(t, filepath.Join(s.RootDir(), "shared"), "file.txt", "changed")
+	git.CommitAll("change shared file")
+
+	cli := NewCLI(t, s.RootDir())
+	AssertRunResult(t, cli.ListChangedStacks(), RunExpected{})
+}
@@ -0,0 +1,48 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	. "github.com/terramate-io/terramate/cmd/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestListChangedDetectsVendoredModuleChanges(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stacks/vendored`,
+		`s:stacks/not-vendored`,
+		`f:stacks/vendored/main.tf:
+		  module "vpc" {
+		    source = "github.com/terramate-io/example//vpc?ref=v1"
+		  }`,
+		`f:stacks/not-vendored/main.tf:
+		  module "vpc" {
+		    source = "github.com/terramate-io/example//vpc?ref=v2"
+		  }`,
+		`f:modules/github.com/terramate-io/example/v1/vpc/main.tf:# vpc`,
+	})
+
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+	git.CheckoutNew("change")
+
+	test.WriteFile(t, filepath.Join(s.RootDir(), "modules/github.com/terramate-io/example/v1/vpc"),
+		"main.tf", "# patched vpc")
+	git.CommitAll("patch vendored module")
+
+	cli := NewCLI(t, s.RootDir())
+	AssertRunResult(t, cli.ListChangedStacks("--why"), RunExpected{
+		Stdout: `stacks/vendored - stack changed because "github.com/terramate-io/example//vpc?ref=v1" changed because ` +
+			`module "github.com/terramate-io/example//vpc?ref=v1" vendored at /modules/github.com/terramate-io/example/v1 ` +
+			`has unmerged changes` + "\n",
+	})
+}
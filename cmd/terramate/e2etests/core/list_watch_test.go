@@ -196,18 +196,22 @@ func TestListWatchExprWithFuncalls(t *testing.T) {
 	AssertRunResult(t, cli.ListChangedStacks(), want)
 }
 
-func TestListWatchDirectoryFails(t *testing.T) {
+func TestListWatchDirectory(t *testing.T) {
 	t.Parallel()
 
 	s := sandbox.New(t)
 
 	extDir := s.RootEntry().CreateDir("external")
-	extFile := extDir.CreateFile("file.txt", "anything")
+	extFile := extDir.CreateDir("policies").CreateFile("policy.json", "anything")
+	s.RootEntry().CreateDir("unrelated").CreateFile("file.txt", "anything")
 
 	s.BuildTree([]string{
 		`s:stack:watch=["/external"]`,
+		`s:stack2:watch=["/unrelated"]`,
 	})
 
+	stack := s.LoadStack(project.NewPath("/stack"))
+
 	cli := NewCLI(t, s.RootDir())
 
 	git := s.Git()
@@ -218,6 +222,73 @@ func TestListWatchDirectoryFails(t *testing.T) {
 	extFile.Write("changed")
 	git.CommitAll("external file changed")
 
+	want := RunExpected{
+		Stdout: stack.RelPath() + "\n",
+	}
+	AssertRunResult(t, cli.ListChangedStacks(), want)
+}
+
+func TestListWatchGlobPattern(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+
+	sharedDir := s.RootEntry().CreateDir("shared")
+	yamlFile := sharedDir.CreateDir("a").CreateDir("b").CreateFile("config.yaml", "anything")
+	jsonFile := sharedDir.CreateFile("config.json", "anything")
+
+	s.BuildTree([]string{
+		`s:stacks/yaml:watch=["../../shared/**/*.yaml"]`,
+		`s:stacks/json:watch=["/shared/*.json"]`,
+	})
+
+	yamlStack := s.LoadStack(project.NewPath("/stacks/yaml"))
+	jsonStack := s.LoadStack(project.NewPath("/stacks/json"))
+
+	cli := NewCLI(t, s.RootDir())
+
+	git := s.Git()
+	git.CommitAll("all")
+	git.Push("main")
+	git.CheckoutNew("change-yaml")
+
+	yamlFile.Write("changed")
+	git.CommitAll("yaml file changed")
+
+	AssertRunResult(t, cli.ListChangedStacks(), RunExpected{
+		Stdout: yamlStack.RelPath() + "\n",
+	})
+	AssertRunResult(t, cli.ListChangedStacks("--why"), RunExpected{
+		Stdout: yamlStack.RelPath() + " - stack changed because watched file \"/shared/**/*.yaml\" changed\n",
+	})
+
+	jsonFile.Write("changed")
+	git.CommitAll("json file changed")
+
+	AssertRunResult(t, cli.ListChangedStacks(), RunExpected{
+		Stdout: jsonStack.RelPath() + "\n" + yamlStack.RelPath() + "\n",
+	})
+}
+
+func TestListWatchInvalidGlobPatternFails(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+
+	s.BuildTree([]string{
+		`s:stack:watch=["/shared/[*.yaml"]`,
+	})
+
+	cli := NewCLI(t, s.RootDir())
+
+	git := s.Git()
+	git.CommitAll("all")
+	git.Push("main")
+	git.CheckoutNew("change")
+
+	s.RootEntry().CreateFile("test.txt", "anything")
+	git.CommitAll("any change")
+
 	want := RunExpected{
 		Status:      1,
 		StderrRegex: string(config.ErrStackInvalidWatch),
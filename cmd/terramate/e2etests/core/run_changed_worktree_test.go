@@ -0,0 +1,75 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	. "github.com/terramate-io/terramate/cmd/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunChangedIncludeWorktree(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stacks/a`,
+		`s:stacks/b`,
+		`s:stacks/c`,
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+	git.CheckoutNew("change")
+
+	test.WriteFile(t, filepath.Join(s.RootDir(), "stacks", "a"), "main.tf", "# uncommitted")
+
+	cli := NewCLI(t, s.RootDir())
+
+	AssertRunResult(t, cli.ListChangedStacks(), RunExpected{IgnoreStderr: true})
+	AssertRunResult(t, cli.Run("list", "--changed", "--changed-include-worktree"), RunExpected{
+		Stdout:       "stacks/a\n",
+		IgnoreStderr: true,
+	})
+	AssertRunResult(t, cli.Run("list", "--changed", "--changed-include-worktree", "--why"), RunExpected{
+		Stdout:       "stacks/a - stack has uncommitted changes\n",
+		IgnoreStderr: true,
+	})
+
+	// the untracked and uncommitted files safeguards do not abort the run.
+	AssertRunResult(t, cli.Run("run", "--changed", "--changed-include-worktree", "--", HelperPath, "stack-abs-path", s.RootDir()), RunExpected{
+		Stdout:       "/stacks/a\n",
+		IgnoreStderr: true,
+	})
+	AssertRunResult(t, cli.Run("run", "--changed", "--", HelperPath, "stack-abs-path", s.RootDir()), RunExpected{
+		Status:      1,
+		StderrRegex: "repository has untracked files",
+	})
+
+	test.WriteFile(t, filepath.Join(s.RootDir(), "stacks", "b"), "main.tf", "# committed")
+	git.Add(filepath.Join(s.RootDir(), "stacks", "b", "main.tf"))
+	git.Commit("change stack b")
+
+	AssertRunResult(t, cli.Run("list", "--changed", "--changed-include-worktree", "--why"), RunExpected{
+		Stdout: "stacks/a - stack has uncommitted changes\n" +
+			"stacks/b - stack has unmerged changes\n",
+		IgnoreStderr: true,
+	})
+
+	// the uncommitted code can't be synchronized to the cloud.
+	for _, syncFlag := range []string{"--cloud-sync-deployment", "--cloud-sync-drift-status"} {
+		AssertRunResult(t, cli.Run("run", "--changed", "--changed-include-worktree", syncFlag, "--", HelperPath, "true"), RunExpected{
+			Status:      1,
+			StderrRegex: "--changed-include-worktree flag conflicts with --cloud-sync-deployment",
+		})
+	}
+
+	AssertRunResult(t, cli.Run("list", "--changed-include-worktree"), RunExpected{
+		Status:      1,
+		StderrRegex: "must be used together with --changed",
+	})
+}
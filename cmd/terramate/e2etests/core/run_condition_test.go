@@ -0,0 +1,152 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	. "github.com/terramate-io/terramate/cmd/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunCondition(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`f:run.tm:
+		  run {
+		    condition = global.enabled
+		  }
+		  globals {
+		    enabled = true
+		  }`,
+		`s:stack-a`,
+		`s:stack-b`,
+		`f:stack-b/globals.tm:
+		  globals {
+		    enabled = false
+		  }`,
+		`s:stack-c`,
+		`f:stack-c/run.tm:
+		  run {
+		    condition = terramate.stack.name != "stack-c"
+		  }`,
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	reportFile := filepath.Join(test.TempDir(t), "report.json")
+
+	cli := NewCLI(t, s.RootDir())
+	AssertRunResult(t, cli.Run(
+		"run", "--report-file", reportFile, HelperPath, "stack-abs-path", s.RootDir(),
+	), RunExpected{
+		Stdout: "/stack-a\n",
+	})
+
+	report := loadRunReport(t, reportFile)
+	assert.EqualInts(t, 3, len(report.Stacks), "unexpected number of stacks")
+
+	assertReportEntry(t, report, 0, "/stack-b", "skipped", -1)
+	assertReportEntry(t, report, 1, "/stack-c", "skipped", -1)
+	assertReportEntry(t, report, 2, "/stack-a", "ok", 0)
+	assert.EqualStrings(t, "run.condition is false", report.Stacks[0].Reason)
+}
+
+func TestRunConditionDryRun(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack-a`,
+		`s:stack-b`,
+		`f:stack-b/run.tm:
+		  run {
+		    condition = false
+		  }`,
+		`s:stack-c`,
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := NewCLI(t, s.RootDir())
+	AssertRunResult(t, cli.Run("run", "--dry-run", HelperPath, "true"), RunExpected{
+		Stdout: `The stacks will be executed using order below:
+	0. stack-a (stack-a)
+	1. stack-c (stack-c)
+The stacks below will be skipped:
+	stack-b (stack-b): run.condition is false
+`,
+	})
+}
+
+func TestRunConditionInvalidType(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack`,
+		`f:stack/run.tm:
+		  run {
+		    condition = "true"
+		  }`,
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := NewCLI(t, s.RootDir())
+	AssertRunResult(t, cli.Run("run", HelperPath, "true"), RunExpected{
+		Status:      1,
+		StderrRegex: "invalid run.condition type",
+	})
+}
+
+func TestRunScriptCondition(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		  terramate {
+		    config {
+		      experiments = ["scripts"]
+		    }
+		  }`,
+		`s:stack-a`,
+		`s:stack-b`,
+		`f:stack-b/run.tm:
+		  run {
+		    condition = false
+		  }`,
+		`f:script.tm:
+		  script "hello" {
+		    description = "say hello"
+		    job {
+		      command = ["echo", "hello ${terramate.stack.name}"]
+		    }
+		  }`,
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	reportFile := filepath.Join(test.TempDir(t), "report.json")
+
+	cli := NewCLI(t, s.RootDir())
+	AssertRunResult(t, cli.Run(
+		"experimental", "script", "run", "--report-file", reportFile, "hello",
+	), RunExpected{
+		Stdout:       "\nhello stack-a\n",
+		IgnoreStderr: true,
+	})
+
+	report := loadRunReport(t, reportFile)
+	assert.EqualInts(t, 2, len(report.Stacks), "unexpected number of stacks")
+
+	assertReportEntry(t, report, 0, "/stack-a", "ok", 0)
+	assertReportEntry(t, report, 1, "/stack-b", "skipped", -1)
+}
@@ -0,0 +1,92 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	. "github.com/terramate-io/terramate/cmd/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunSkipsDisabledStacks(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		  terramate {
+		    config {
+		      experiments = ["scripts"]
+		    }
+		  }`,
+		`f:script.tm:
+		  script "hello" {
+		    description = "say hello"
+		    job {
+		      command = ["echo", "hello"]
+		    }
+		  }`,
+		`f:generate.tm:
+		  generate_file "file.txt" {
+		    content = terramate.stack.name
+		  }`,
+		`s:stacks/a`,
+		`f:stacks/b/stack.tm:
+		  stack {
+		    disabled = true
+		  }`,
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+
+	cli := NewCLI(t, s.RootDir())
+
+	// disabled stacks are still generated and listed.
+	AssertRunResult(t, cli.Run("generate"), RunExpected{IgnoreStdout: true})
+	git.CommitAll("generate code")
+	git.Push("main")
+	assert.EqualStrings(t, "b", string(test.ReadFile(t, filepath.Join(s.RootDir(), "stacks", "b"), "file.txt")))
+
+	AssertRunResult(t, cli.ListStacks(), RunExpected{
+		Stdout: "stacks/a\nstacks/b\n",
+	})
+
+	reportFile := filepath.Join(test.TempDir(t), "report.json")
+	AssertRunResult(t, cli.Run("run", "--quiet", "--report-file", reportFile, "--eval",
+		HelperPathAsHCL, "echo", "${terramate.stack.path.absolute}"), RunExpected{
+		Stdout: "/stacks/a\n",
+	})
+
+	report := loadRunReport(t, reportFile)
+	assert.EqualInts(t, 2, len(report.Stacks), "unexpected number of stacks")
+	assertReportEntry(t, report, 0, "/stacks/b", "skipped", -1)
+	assert.EqualStrings(t, "stack is disabled", report.Stacks[0].Reason)
+	assertReportEntry(t, report, 1, "/stacks/a", "ok", 0)
+
+	AssertRunResult(t, cli.Run("experimental", "script", "run", "hello"), RunExpected{
+		Stdout:      "\nhello\n",
+		StderrRegex: "Skipping stack /stacks/b: stack is disabled",
+	})
+
+	git.CheckoutNew("change")
+	test.WriteFile(t, filepath.Join(s.RootDir(), "stacks", "a"), "main.tf", "# changed")
+	test.WriteFile(t, filepath.Join(s.RootDir(), "stacks", "b"), "main.tf", "# changed")
+	git.CommitAll("change stacks")
+
+	AssertRunResult(t, cli.ListChangedStacks(), RunExpected{
+		Stdout: "stacks/a\n",
+	})
+	AssertRunResult(t, cli.ListChangedStacks("--why"), RunExpected{
+		Stdout: "stacks/a - stack has unmerged changes\nstacks/b - disabled: stack has unmerged changes\n",
+	})
+	AssertRunResult(t, cli.Run("run", "--quiet", "--changed", "--eval",
+		HelperPathAsHCL, "echo", "${terramate.stack.path.absolute}"), RunExpected{
+		Stdout: "/stacks/a\n",
+	})
+}
@@ -0,0 +1,50 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"testing"
+
+	. "github.com/terramate-io/terramate/cmd/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunEnvFiles(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		  terramate {
+		    config {
+		      run {
+		        env_files = [".env", ".env.${global.environment}"]
+		        env {
+		          FROM_BLOCK = "block"
+		        }
+		      }
+		    }
+		  }
+		  globals {
+		    environment = "prod"
+		  }`,
+		"f:.env:FROM_ROOT=root\nOVERRIDDEN=root\nFROM_BLOCK=dotenv\n",
+		"f:.env.prod:FROM_PROD='prod'\n",
+		"f:stack/.env:OVERRIDDEN=stack\n",
+		`s:stack`,
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := NewCLI(t, s.RootDir())
+	AssertRunResult(t, cli.Run("experimental", "run-env"), RunExpected{
+		Stdout: `
+stack "/stack":
+	FROM_BLOCK=block
+	FROM_PROD=prod
+	FROM_ROOT=root
+	OVERRIDDEN=stack
+`,
+	})
+}
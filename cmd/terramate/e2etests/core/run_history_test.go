@@ -0,0 +1,129 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/madlambda/spells/assert"
+	. "github.com/terramate-io/terramate/cmd/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/run/history"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunRecordsHistory(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack-a`,
+		`s:stack-b`,
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := NewCLI(t, s.RootDir())
+	AssertRunResult(t, cli.Run("run", "--parallel", "2", HelperPath, "true"), RunExpected{})
+	AssertRunResult(t, cli.Run("run", "--continue-on-error", "--eval", HelperPathAsHCL, "exit",
+		`${terramate.stack.name == "stack-a" ? "0" : "1"}`,
+	), RunExpected{
+		Status:       1,
+		IgnoreStderr: true,
+	})
+
+	h, err := history.Load(s.RootDir())
+	assert.NoError(t, err)
+
+	// failed commands are not recorded.
+	assert.EqualInts(t, 2, len(h.Stacks["/stack-a"]), "stack-a history")
+	assert.EqualInts(t, 1, len(h.Stacks["/stack-b"]), "stack-b history")
+
+	assert.EqualStrings(t, "true", h.Stacks["/stack-a"][0].Command[1])
+	assert.EqualStrings(t, "exit", h.Stacks["/stack-a"][1].Command[1])
+
+	_, ok := h.Estimate("/stack-a", nil)
+	assert.IsTrue(t, ok, "stack-a must have an estimate")
+}
+
+func TestRunOrderCriticalPath(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:network`,
+		`s:app:after=["/network"]`,
+		`s:db:after=["/network"]`,
+		`s:monitor:after=["/app"]`,
+		`s:unrelated`,
+	})
+
+	var h history.History
+	h.Add("/network", []string{"apply"}, 30*time.Second, time.Now())
+	h.Add("/app", []string{"apply"}, 10*time.Second, time.Now())
+	h.Add("/app", []string{"plan"}, 20*time.Second, time.Now())
+	h.Add("/db", []string{"apply"}, 1*time.Minute, time.Now())
+	h.Add("/monitor", []string{"apply"}, 5*time.Second, time.Now())
+	h.Add("/unrelated", []string{"apply"}, 80*time.Second, time.Now())
+	assert.NoError(t, history.Save(s.RootDir(), h))
+
+	cli := NewCLI(t, s.RootDir())
+	AssertRunResult(t, cli.Run("experimental", "run-order", "--critical-path"), RunExpected{
+		Stdout: nljoin(
+			"/network (30s)",
+			"/db (1m0s)",
+			"Estimated duration: 1m30s",
+		),
+	})
+
+	// without history, the critical path is the longest chain of stacks.
+	s2 := sandbox.New(t)
+	s2.BuildTree([]string{
+		`s:network`,
+		`s:app:after=["/network"]`,
+		`s:monitor:after=["/app"]`,
+	})
+
+	cli = NewCLI(t, s2.RootDir())
+	AssertRunResult(t, cli.Run("experimental", "run-order", "--critical-path"), RunExpected{
+		Stdout: nljoin(
+			"/network (no history)",
+			"/app (no history)",
+			"/monitor (no history)",
+			"Estimated duration: 0s",
+		),
+	})
+}
+
+func TestRunOrderCriticalPathWithVariants(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:network`,
+		`f:app/stack.tm:
+		  stack {
+		    after = ["/network"]
+		    variant "eu" {}
+		    variant "us" {}
+		  }`,
+		`s:db:after=["/network"]`,
+	})
+
+	var h history.History
+	h.Add("/network", []string{"apply"}, 30*time.Second, time.Now())
+	h.Add("/app@eu", []string{"apply"}, 20*time.Second, time.Now())
+	h.Add("/app@us", []string{"apply"}, 25*time.Second, time.Now())
+	h.Add("/db", []string{"apply"}, 40*time.Second, time.Now())
+	assert.NoError(t, history.Save(s.RootDir(), h))
+
+	cli := NewCLI(t, s.RootDir())
+	AssertRunResult(t, cli.Run("experimental", "run-order", "--critical-path"), RunExpected{
+		Stdout: nljoin(
+			"/network (30s)",
+			"/app (45s)",
+			"Estimated duration: 1m15s",
+		),
+	})
+}
@@ -0,0 +1,119 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/terramate-io/terramate/cmd/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunHooks(t *testing.T) {
+	t.Parallel()
+
+	type testcase struct {
+		name  string
+		hooks string
+		cmd   []string
+		want  RunExpected
+	}
+
+	for _, tc := range []testcase{
+		{
+			name: "before and after hooks run around the command",
+			hooks: fmt.Sprintf(`
+			  before {
+			    command = ["%s", "echo", "before", global.msg]
+			  }
+			  after {
+			    command = ["%s", "echo", "after", terramate.stack.name]
+			  }`, HelperPathAsHCL, HelperPathAsHCL),
+			cmd: []string{HelperPath, "echo", "command"},
+			want: RunExpected{
+				Stdout: "before hello\ncommand\nafter stack\n",
+			},
+		},
+		{
+			name: "after hook gets the exit code of the command",
+			hooks: fmt.Sprintf(`
+			  after {
+			    command = ["%s", "env"]
+			  }`, HelperPathAsHCL),
+			cmd: []string{HelperPath, "exit", "3"},
+			want: RunExpected{
+				Status:      1,
+				StdoutRegex: "TM_RUN_EXIT_CODE=3",
+				StderrRegex: "one or more commands failed",
+			},
+		},
+		{
+			name: "failed before hook skips the command",
+			hooks: fmt.Sprintf(`
+			  before {
+			    command = ["%s", "false"]
+			  }
+			  after {
+			    command = ["%s", "echo", "after"]
+			  }`, HelperPathAsHCL, HelperPathAsHCL),
+			cmd: []string{HelperPath, "echo", "command"},
+			want: RunExpected{
+				Status:      1,
+				StderrRegex: "hook execution failed",
+			},
+		},
+		{
+			name: "failed after hook fails the stack",
+			hooks: fmt.Sprintf(`
+			  after {
+			    command = ["%s", "false"]
+			  }`, HelperPathAsHCL),
+			cmd: []string{HelperPath, "echo", "command"},
+			want: RunExpected{
+				Status:      1,
+				Stdout:      "command\n",
+				StderrRegex: "hook execution failed",
+			},
+		},
+		{
+			name: "invalid hook command",
+			hooks: `
+			  before {
+			    command = "echo"
+			  }`,
+			cmd: []string{HelperPath, "echo", "command"},
+			want: RunExpected{
+				Status:      1,
+				StderrRegex: "invalid hook command",
+			},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := sandbox.New(t)
+			s.BuildTree([]string{
+				`s:stack`,
+				`f:globals.tm:globals {
+				  msg = "hello"
+				}`,
+				fmt.Sprintf(`f:terramate.tm:terramate {
+				  config {
+				    run {
+				      %s
+				    }
+				  }
+				}`, tc.hooks),
+			})
+			git := s.Git()
+			git.CommitAll("first commit")
+
+			cli := NewCLI(t, s.RootDir())
+			args := append([]string{"run", "--quiet"}, tc.cmd...)
+			AssertRunResult(t, cli.Run(args...), tc.want)
+		})
+	}
+}
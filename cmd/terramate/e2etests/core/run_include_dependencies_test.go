@@ -0,0 +1,126 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	. "github.com/terramate-io/terramate/cmd/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestIncludeDependenciesAndDependents(t *testing.T) {
+	t.Parallel()
+
+	layout := []string{
+		`s:network`,
+		`s:vpc:before=["/network"]`,
+		`s:app:after=["/network"]`,
+		`s:db:after=["/network"]`,
+		`s:monitor:after=["/app"]`,
+		`s:unrelated`,
+	}
+
+	t.Run("list", func(t *testing.T) {
+		t.Parallel()
+
+		s := sandbox.New(t)
+		s.BuildTree(layout)
+		git := s.Git()
+		git.CommitAll("first commit")
+
+		cli := NewCLI(t, filepath.Join(s.RootDir(), "app"))
+		AssertRunResult(t, cli.ListStacks(), RunExpected{
+			Stdout: ".\n",
+		})
+		AssertRunResult(t, cli.ListStacks("--include-dependencies"), RunExpected{
+			Stdout: ".\n/network\n/vpc\n",
+		})
+		AssertRunResult(t, cli.ListStacks("--include-dependents"), RunExpected{
+			Stdout: ".\n/monitor\n",
+		})
+
+		cli = NewCLI(t, filepath.Join(s.RootDir(), "network"))
+		AssertRunResult(t, cli.ListStacks("--include-dependencies", "--include-dependents"), RunExpected{
+			Stdout: "/app\n/db\n/monitor\n.\n/vpc\n",
+		})
+	})
+
+	t.Run("list changed", func(t *testing.T) {
+		t.Parallel()
+
+		s := sandbox.New(t)
+		s.BuildTree(layout)
+		git := s.Git()
+		git.CommitAll("first commit")
+		git.Push("main")
+		git.CheckoutNew("change-network")
+
+		s.DirEntry("network").CreateFile("main.tf", "# changed")
+		git.CommitAll("network changed")
+
+		cli := NewCLI(t, s.RootDir())
+		AssertRunResult(t, cli.ListChangedStacks(), RunExpected{
+			Stdout: "network\n",
+		})
+		AssertRunResult(t, cli.ListChangedStacks("--include-dependents"), RunExpected{
+			Stdout: "app\ndb\nmonitor\nnetwork\n",
+		})
+		AssertRunResult(t, cli.ListChangedStacks("--include-dependents", "--why"), RunExpected{
+			Stdout: "app - stack is a dependent of a selected stack\n" +
+				"db - stack is a dependent of a selected stack\n" +
+				"monitor - stack is a dependent of a selected stack\n" +
+				"network - stack has unmerged changes\n",
+		})
+	})
+
+	t.Run("run", func(t *testing.T) {
+		t.Parallel()
+
+		s := sandbox.New(t)
+		s.BuildTree(layout)
+		git := s.Git()
+		git.CommitAll("first commit")
+
+		cli := NewCLI(t, filepath.Join(s.RootDir(), "app"))
+		AssertRunResult(t, cli.Run(
+			"run", "--include-dependencies", "--include-dependents",
+			HelperPath, "stack-abs-path", s.RootDir(),
+		), RunExpected{
+			Stdout: "/vpc\n/network\n/app\n/monitor\n",
+		})
+	})
+
+	t.Run("script run", func(t *testing.T) {
+		t.Parallel()
+
+		s := sandbox.New(t)
+		s.BuildTree(append([]string{
+			`f:terramate.tm:
+			  terramate {
+			    config {
+			      experiments = ["scripts"]
+			    }
+			  }`,
+			`f:script.tm:
+			  script "hello" {
+			    description = "say hello"
+			    job {
+			      command = ["echo", "hello ${terramate.stack.name}"]
+			    }
+			  }`,
+		}, layout...))
+		git := s.Git()
+		git.CommitAll("first commit")
+
+		cli := NewCLI(t, filepath.Join(s.RootDir(), "db"))
+		AssertRunResult(t, cli.Run(
+			"experimental", "script", "run", "--include-dependencies", "hello",
+		), RunExpected{
+			Stdout:       "\nhello db\n\nhello network\n\nhello vpc\n",
+			IgnoreStderr: true,
+		})
+	})
+}
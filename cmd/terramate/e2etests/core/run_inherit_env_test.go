@@ -0,0 +1,72 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+
+	. "github.com/terramate-io/terramate/cmd/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunInheritEnv(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("the Windows environment always has extra variables")
+	}
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		  terramate {
+		    config {
+		      run {
+		        inherit_env {
+		          allow = ["ALLOWED_*"]
+		          deny  = ["ALLOWED_SECRET"]
+		        }
+		        env {
+		          FROM_STACK = "stack"
+		        }
+		      }
+		    }
+		  }`,
+		`s:stack`,
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	env := append(testEnviron(t),
+		"ALLOWED_A=a",
+		"ALLOWED_B=b",
+		"ALLOWED_SECRET=secret",
+		"NOT_ALLOWED=other",
+	)
+	cli := NewCLI(t, s.RootDir(), env...)
+
+	res := cli.Run("run", HelperPath, "env")
+	AssertRunResult(t, res, RunExpected{IgnoreStdout: true})
+
+	gotenv := strings.Split(strings.TrimSpace(res.Stdout), "\n")
+	sort.Strings(gotenv)
+	test.AssertDiff(t, gotenv, []string{
+		"ALLOWED_A=a",
+		"ALLOWED_B=b",
+		"FROM_STACK=stack",
+	})
+
+	AssertRunResult(t, cli.Run("experimental", "run-env"), RunExpected{
+		Stdout: `
+stack "/stack":
+	ALLOWED_A=a
+	ALLOWED_B=b
+	FROM_STACK=stack
+`,
+	})
+}
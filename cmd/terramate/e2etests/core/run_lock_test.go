@@ -0,0 +1,144 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/madlambda/spells/assert"
+	. "github.com/terramate-io/terramate/cmd/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/run/lock"
+	"github.com/terramate-io/terramate/run/state"
+	"github.com/terramate-io/terramate/test"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunLock(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		  terramate {
+		    config {
+		      experiments = ["scripts"]
+		    }
+		  }`,
+		`f:script.tm:
+		  script "hello" {
+		    description = "say hello"
+		    job {
+		      command = ["echo", "hello"]
+		    }
+		  }`,
+		`s:stack`,
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := NewCLI(t, s.RootDir())
+
+	// the lock is released after the run.
+	AssertRunResult(t, cli.Run("run", HelperPath, "true"), RunExpected{})
+	lockFile := filepath.Join(state.Dir(s.RootDir()), "run.lock")
+	data, err := os.ReadFile(lockFile)
+	assert.NoError(t, err)
+	assert.EqualInts(t, 0, len(data), "lock file must have no owner after the run")
+
+	// the lock is held by the test process.
+	l, err := lock.Acquire(s.RootDir(), 0)
+	assert.NoError(t, err)
+	defer func() { _ = l.Release() }()
+
+	hostname, err := os.Hostname()
+	assert.NoError(t, err)
+
+	AssertRunResult(t, cli.Run("run", HelperPath, "true"), RunExpected{
+		Status:      1,
+		StderrRegex: "another run is in progress",
+	})
+	AssertRunResult(t, cli.Run("run", "--lock-timeout", "500ms", HelperPath, "true"), RunExpected{
+		Status:      1,
+		StderrRegex: fmt.Sprintf("locked by PID %d on host %s", os.Getpid(), regexp.QuoteMeta(hostname)),
+	})
+	AssertRunResult(t, cli.Run("experimental", "script", "run", "hello"), RunExpected{
+		Status:      1,
+		StderrRegex: "another run is in progress",
+	})
+
+	AssertRunResult(t, cli.Run("run", "--no-lock", HelperPath, "echo", "unlocked"), RunExpected{
+		Stdout: "unlocked\n",
+	})
+	AssertRunResult(t, cli.Run("experimental", "script", "run", "--no-lock", "hello"), RunExpected{
+		Stdout:       "\nhello\n",
+		IgnoreStderr: true,
+	})
+
+	// dry runs don't take the lock.
+	AssertRunResult(t, cli.Run("run", "--dry-run", HelperPath, "true"), RunExpected{
+		IgnoreStdout: true,
+	})
+}
+
+func TestRunLockIgnoresLockFileLeftBehind(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{`s:stack`})
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	hostname, err := os.Hostname()
+	assert.NoError(t, err)
+
+	for _, host := range []string{hostname, "other-host"} {
+		// the lock file of a crashed process is not locked anymore.
+		writeRunLock(t, s.RootDir(), lock.Info{
+			PID:       1 << 30,
+			Hostname:  host,
+			CreatedAt: time.Now(),
+		})
+
+		cli := NewCLI(t, s.RootDir())
+		AssertRunResult(t, cli.Run("run", HelperPath, "echo", "hello"), RunExpected{
+			Stdout: "hello\n",
+		})
+	}
+}
+
+func writeRunLock(t *testing.T, rootdir string, info lock.Info) {
+	t.Helper()
+
+	data, err := json.Marshal(info)
+	assert.NoError(t, err)
+	test.WriteFile(t, state.Dir(rootdir), "run.lock", string(data))
+}
+
+func TestRunLockReleasedOnFatalErrors(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{`s:stack`})
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	// a corrupted run state fails the run after the lock is acquired.
+	test.WriteFile(t, state.Dir(s.RootDir()), "state.json", "corrupted")
+
+	cli := NewCLI(t, s.RootDir())
+	AssertRunResult(t, cli.Run("run", "--resume", HelperPath, "true"), RunExpected{
+		Status:      1,
+		StderrRegex: "loading previous run state",
+	})
+
+	data, err := os.ReadFile(filepath.Join(state.Dir(s.RootDir()), "run.lock"))
+	assert.NoError(t, err)
+	assert.EqualInts(t, 0, len(data), "lock file must have no owner after the failed run")
+}
@@ -0,0 +1,86 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	. "github.com/terramate-io/terramate/cmd/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunMasksSecrets(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		  terramate {
+		    config {
+		      run {
+		        sensitive_globals = ["db.password"]
+		        mask_patterns     = ["ghp_[a-zA-Z0-9]+"]
+		      }
+		    }
+		  }`,
+		`f:globals.tm:
+		  globals {
+		    db = {
+		      password = "hunter2"
+		    }
+		  }`,
+		`f:run.tm:
+		  run {
+		    sensitive_env = ["TOKEN"]
+		    env {
+		      TOKEN = "s3cr3t"
+		    }
+		  }`,
+		`s:stack`,
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	logDir := test.TempDir(t)
+
+	cli := NewCLI(t, s.RootDir())
+	AssertRunResult(t, cli.Run("run", "--log-dir", logDir, HelperPath, "echo", "s3cr3t", "hunter2", "ghp_abc123", "visible"), RunExpected{
+		Stdout: "*** *** *** visible\n",
+	})
+	assert.EqualStrings(t, "*** *** *** visible\n", string(test.ReadFile(t, logDir, "stack.log")))
+
+	res := cli.Run("run", HelperPath, "env")
+	AssertRunResult(t, res, RunExpected{
+		StdoutRegex: `(?m)^TOKEN=\*\*\*$`,
+	})
+	assert.IsTrue(t, !strings.Contains(res.Stdout, "s3cr3t"), "secret not masked: %s", res.Stdout)
+}
+
+func TestRunMasksMultiLineSecrets(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`f:run.tm:
+		  run {
+		    sensitive_env = ["KEY"]
+		    env {
+		      KEY = "-----BEGIN KEY-----\nc2VjcmV0\n-----END KEY-----"
+		    }
+		  }`,
+		`s:stack`,
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := NewCLI(t, s.RootDir())
+	res := cli.Run("run", HelperPath, "env")
+	AssertRunResult(t, res, RunExpected{
+		StdoutRegex: `(?m)^KEY=\*\*\*\n\*\*\*\n\*\*\*$`,
+	})
+	assert.IsTrue(t, !strings.Contains(res.Stdout, "c2VjcmV0"), "secret not masked: %s", res.Stdout)
+}
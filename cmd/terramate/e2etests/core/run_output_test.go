@@ -0,0 +1,91 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	. "github.com/terramate-io/terramate/cmd/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunOutputPrefix(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack-a`,
+		`s:stack-b`,
+		`s:stack-b/child`,
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := NewCLI(t, s.RootDir())
+	AssertRunResult(t, cli.Run("run", "--output-prefix", HelperPath, "echo", "hello"), RunExpected{
+		Stdout: nljoin(
+			"[/stack-a] hello",
+			"[/stack-b] hello",
+			"[/stack-b/child] hello",
+		),
+	})
+
+	// concurrent stacks stream their lines, in any order.
+	res := cli.Run("run", "--output-prefix", "--parallel", "3", HelperPath, "echo", "hello")
+	AssertRunResult(t, res, RunExpected{IgnoreStdout: true})
+	lines := strings.Split(strings.TrimSuffix(res.Stdout, "\n"), "\n")
+	sort.Strings(lines)
+	assert.EqualStrings(t, nljoin(
+		"[/stack-a] hello",
+		"[/stack-b/child] hello",
+		"[/stack-b] hello",
+	), strings.Join(lines, "\n")+"\n")
+
+	AssertRunResult(t, cli.Run("run", "--output-prefix", "--output-prefix-color", HelperPath, "echo", "hello"), RunExpected{
+		StdoutRegex: `\x1b\[36m\[/stack-a\]\x1b\[0m hello`,
+	})
+
+	AssertRunResult(t, cli.Run("run", "--output-prefix-color", HelperPath, "echo", "hello"), RunExpected{
+		Status:      1,
+		StderrRegex: "--output-prefix-color requires --output-prefix",
+	})
+}
+
+func TestRunLogDir(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack-a`,
+		`s:stack-b/child`,
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	logDir := test.TempDir(t)
+	cli := NewCLI(t, s.RootDir())
+	AssertRunResult(t, cli.Run("run", "--log-dir", logDir, "--eval", HelperPathAsHCL, "echo", "${terramate.stack.name}"), RunExpected{
+		Stdout: nljoin(
+			"stack-a",
+			"child",
+		),
+	})
+
+	assert.EqualStrings(t, "stack-a\n", string(test.ReadFile(t, logDir, "stack-a.log")))
+	assert.EqualStrings(t, "child\n", string(test.ReadFile(t, filepath.Join(logDir, "stack-b"), "child.log")))
+
+	// the log files are truncated by new runs.
+	AssertRunResult(t, cli.Run("run", "--log-dir", logDir, "--output-prefix", HelperPath, "echo", "again"), RunExpected{
+		Stdout: nljoin(
+			"[/stack-a] again",
+			"[/stack-b/child] again",
+		),
+	})
+	assert.EqualStrings(t, "again\n", string(test.ReadFile(t, logDir, "stack-a.log")))
+}
@@ -0,0 +1,145 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	. "github.com/terramate-io/terramate/cmd/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunParallelRespectsOrder(t *testing.T) {
+	t.Parallel()
+
+	type testcase struct {
+		name    string
+		layout  []string
+		reverse bool
+		want    RunExpected
+	}
+
+	for _, tc := range []testcase{
+		{
+			name: "chain of stacks",
+			layout: []string{
+				`s:stack-3:after=["/stack-2"]`,
+				`s:stack-2:after=["/stack-1"]`,
+				`s:stack-1`,
+			},
+			want: RunExpected{
+				Stdout: nljoin("/stack-1", "/stack-2", "/stack-3"),
+			},
+		},
+		{
+			name: "chain of stacks reversed",
+			layout: []string{
+				`s:stack-3:after=["/stack-2"]`,
+				`s:stack-2:after=["/stack-1"]`,
+				`s:stack-1`,
+			},
+			reverse: true,
+			want: RunExpected{
+				Stdout: nljoin("/stack-3", "/stack-2", "/stack-1"),
+			},
+		},
+		{
+			name: "parent stacks run before child stacks",
+			layout: []string{
+				`s:parent`,
+				`s:parent/child`,
+				`s:parent/child/grandchild`,
+			},
+			want: RunExpected{
+				Stdout: nljoin("/parent", "/parent/child", "/parent/child/grandchild"),
+			},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			s := sandbox.New(t)
+			s.BuildTree(tc.layout)
+			git := s.Git()
+			git.CommitAll("first commit")
+
+			args := []string{"run", "--parallel", "5"}
+			if tc.reverse {
+				args = append(args, "--reverse")
+			}
+			args = append(args, HelperPath, "stack-abs-path", s.RootDir())
+
+			cli := NewCLI(t, s.RootDir())
+			AssertRunResult(t, cli.Run(args...), tc.want)
+		})
+	}
+}
+
+func TestRunParallelDoesNotInterleaveOutput(t *testing.T) {
+	t.Parallel()
+
+	const (
+		testfile  = "testfile"
+		numStacks = 10
+		numLines  = 100
+	)
+
+	s := sandbox.New(t)
+
+	var layout []string
+	var want []string
+	for i := 0; i < numStacks; i++ {
+		stack := "stack-" + string(rune('a'+i))
+		var content []string
+		for j := 0; j < numLines; j++ {
+			content = append(content, stack)
+		}
+		layout = append(layout,
+			"s:"+stack,
+			"f:"+stack+"/"+testfile+":"+nljoin(content...),
+		)
+		want = append(want, nljoin(content...))
+	}
+	s.BuildTree(layout)
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := NewCLI(t, s.RootDir())
+	res := cli.Run("run", "--parallel", "4", HelperPath, "cat", testfile)
+	AssertRunResult(t, res, RunExpected{IgnoreStdout: true})
+
+	var got []string
+	stdout := res.Stdout
+	for len(stdout) > 0 {
+		stack := stdout[:strings.IndexByte(stdout, '\n')]
+		block := strings.Repeat(stack+"\n", numLines)
+		if !strings.HasPrefix(stdout, block) {
+			t.Fatalf("output of stack %s is interleaved:\n%s", stack, res.Stdout)
+		}
+		got = append(got, block)
+		stdout = stdout[len(block):]
+	}
+
+	sort.Strings(got)
+	if strings.Join(got, "") != strings.Join(want, "") {
+		t.Fatalf("want:\n%s\ngot:\n%s", strings.Join(want, ""), res.Stdout)
+	}
+}
+
+func TestRunParallelFailsWithInvalidValue(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{`s:stack`})
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := NewCLI(t, s.RootDir())
+	AssertRunResult(t, cli.Run("run", "--parallel", "0", HelperPath, "true"), RunExpected{
+		Status:      1,
+		StderrRegex: "--parallel must be greater than or equal to 1",
+	})
+}
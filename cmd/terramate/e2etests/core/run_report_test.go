@@ -0,0 +1,200 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	. "github.com/terramate-io/terramate/cmd/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+type runReport struct {
+	Stacks []struct {
+		Path     string   `json:"path"`
+		Variant  string   `json:"variant"`
+		Command  []string `json:"command"`
+		Status   string   `json:"status"`
+		ExitCode *int     `json:"exit_code"`
+		Reason   string   `json:"reason"`
+		Error    string   `json:"error"`
+	} `json:"stacks"`
+}
+
+func TestRunReportFile(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack-a`,
+		`s:stack-b`,
+		`s:stack-c`,
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	reportFile := filepath.Join(test.TempDir(t), "report.json")
+
+	cli := NewCLI(t, s.RootDir())
+	AssertRunResult(t, cli.Run(
+		"run", "--report-file", reportFile, "--eval",
+		HelperPathAsHCL, "exit", `${terramate.stack.path.absolute == "/stack-b" ? "1" : "0"}`,
+	), RunExpected{
+		Status:      1,
+		StderrRegex: "one or more commands failed",
+	})
+
+	report := loadRunReport(t, reportFile)
+	assert.EqualInts(t, 3, len(report.Stacks), "unexpected number of stacks")
+
+	assertReportEntry(t, report, 0, "/stack-a", "ok", 0)
+	assertReportEntry(t, report, 1, "/stack-b", "failed", 1)
+	assertReportEntry(t, report, 2, "/stack-c", "canceled", -1)
+
+	assert.IsTrue(t, report.Stacks[1].Error != "", "failed stack must report the error")
+	assert.EqualStrings(t, "previous stack failed", report.Stacks[2].Reason)
+	assert.EqualStrings(t, "exit", report.Stacks[0].Command[1])
+}
+
+func TestRunScriptReportFile(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		  terramate {
+			config {
+			  experiments = ["scripts"]
+			}
+		  }`,
+		`s:stack-a`,
+		`s:stack-b`,
+		`f:script.tm:
+		script "hello" {
+		  description = "say hello"
+		  job {
+			command = ["echo", "hello"]
+		  }
+		}`,
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	reportFile := filepath.Join(test.TempDir(t), "report.json")
+
+	cli := NewCLI(t, s.RootDir())
+	AssertRunResult(t, cli.Run(
+		"experimental", "script", "run", "--report-file", reportFile, "hello",
+	), RunExpected{
+		IgnoreStdout: true,
+		IgnoreStderr: true,
+	})
+
+	report := loadRunReport(t, reportFile)
+	assert.EqualInts(t, 2, len(report.Stacks), "unexpected number of stacks")
+
+	assertReportEntry(t, report, 0, "/stack-a", "ok", 0)
+	assertReportEntry(t, report, 1, "/stack-b", "ok", 0)
+}
+
+func loadRunReport(t *testing.T, path string) runReport {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	var report runReport
+	assert.NoError(t, json.Unmarshal(data, &report))
+	return report
+}
+
+func assertReportEntry(t *testing.T, report runReport, i int, path, status string, exitCode int) {
+	t.Helper()
+
+	entry := report.Stacks[i]
+	assert.EqualStrings(t, path, entry.Path, "stack %d path mismatch", i)
+	assert.EqualStrings(t, status, entry.Status, "stack %s status mismatch", path)
+
+	if exitCode < 0 {
+		assert.IsTrue(t, entry.ExitCode == nil, "stack %s must not have exit code", path)
+		return
+	}
+	assert.IsTrue(t, entry.ExitCode != nil, "stack %s must have exit code", path)
+	assert.EqualInts(t, exitCode, *entry.ExitCode, "stack %s exit code mismatch", path)
+}
+
+func TestRunJUnitFile(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack-a`,
+		`f:stack-a/file.txt:hello`,
+		`s:stack-b`,
+		`s:stack-c`,
+		`f:stack-c/file.txt:hello`,
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	junitFile := filepath.Join(test.TempDir(t), "junit.xml")
+
+	cli := NewCLI(t, s.RootDir())
+	AssertRunResult(t, cli.Run(
+		"run", "--junit-file", junitFile, HelperPath, "cat", "file.txt",
+	), RunExpected{
+		Status:       1,
+		IgnoreStdout: true,
+		IgnoreStderr: true,
+	})
+
+	data, err := os.ReadFile(junitFile)
+	assert.NoError(t, err)
+
+	type testcase struct {
+		Name    string `xml:"name,attr"`
+		Failure *struct {
+			Output string `xml:",chardata"`
+		} `xml:"failure"`
+		Skipped *struct {
+			Message string `xml:"message,attr"`
+		} `xml:"skipped"`
+	}
+
+	var suites struct {
+		Tests    int `xml:"tests,attr"`
+		Failures int `xml:"failures,attr"`
+		Skipped  int `xml:"skipped,attr"`
+		Suites   []struct {
+			Cases []testcase `xml:"testcase"`
+		} `xml:"testsuite"`
+	}
+	assert.NoError(t, xml.Unmarshal(data, &suites))
+
+	assert.EqualInts(t, 3, suites.Tests)
+	assert.EqualInts(t, 1, suites.Failures)
+	assert.EqualInts(t, 1, suites.Skipped)
+	assert.EqualInts(t, 1, len(suites.Suites))
+
+	cases := suites.Suites[0].Cases
+	assert.EqualInts(t, 3, len(cases))
+
+	assert.EqualStrings(t, "/stack-a", cases[0].Name)
+	assert.IsTrue(t, cases[0].Failure == nil && cases[0].Skipped == nil, "stack-a must succeed")
+
+	assert.EqualStrings(t, "/stack-b", cases[1].Name)
+	assert.IsTrue(t, cases[1].Failure != nil, "stack-b must fail")
+	assert.IsTrue(t, strings.Contains(cases[1].Failure.Output, "file.txt"),
+		"failure must contain the stderr of the command: %s", cases[1].Failure.Output)
+
+	assert.EqualStrings(t, "/stack-c", cases[2].Name)
+	assert.IsTrue(t, cases[2].Skipped != nil, "stack-c must be skipped")
+}
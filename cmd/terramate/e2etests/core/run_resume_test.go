@@ -0,0 +1,98 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	. "github.com/terramate-io/terramate/cmd/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunResume(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack-a`,
+		`s:stack-b`,
+		`s:stack-c`,
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	// the stacks read files outside of the repository, then the stack-b can
+	// be fixed without changing the git commit.
+	datadir := test.TempDir(t)
+	test.WriteFile(t, datadir, "stack-a", "a\n")
+	test.WriteFile(t, datadir, "stack-c", "c\n")
+
+	args := []string{
+		"run", "--eval", HelperPathAsHCL, "cat",
+		filepath.ToSlash(datadir) + "/${terramate.stack.name}",
+	}
+
+	cli := NewCLI(t, s.RootDir())
+	AssertRunResult(t, cli.Run(args...), RunExpected{
+		Status:       1,
+		Stdout:       "a\n",
+		IgnoreStderr: true,
+	})
+
+	test.WriteFile(t, datadir, "stack-b", "b\n")
+
+	resumeArgs := append([]string{"run", "--resume"}, args[1:]...)
+	AssertRunResult(t, cli.Run(resumeArgs...), RunExpected{
+		Stdout: "b\nc\n",
+	})
+
+	// everything succeeded then resuming again runs nothing.
+	AssertRunResult(t, cli.Run(resumeArgs...), RunExpected{})
+
+	// without --resume all stacks are executed.
+	AssertRunResult(t, cli.Run(args...), RunExpected{
+		Stdout: "a\nb\nc\n",
+	})
+}
+
+func TestRunStateIsKeptInsideGitDir(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack`,
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := NewCLI(t, s.RootDir())
+	AssertRunResult(t, cli.Run("run", HelperPath, "echo", "hello"), RunExpected{
+		Stdout: "hello\n",
+	})
+
+	test.IsDir(t, filepath.Join(s.RootDir(), ".git", "terramate"), "run")
+	test.DoesNotExist(t, s.RootDir(), ".tmrun")
+}
+
+func TestRunResumeDifferentCommandRunsAll(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack-a`,
+		`s:stack-b`,
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := NewCLI(t, s.RootDir())
+	AssertRunResult(t, cli.Run("run", HelperPath, "echo", "hello"), RunExpected{
+		Stdout: "hello\nhello\n",
+	})
+	AssertRunResult(t, cli.Run("run", "--resume", HelperPath, "echo", "other"), RunExpected{
+		Stdout: "other\nother\n",
+	})
+}
@@ -0,0 +1,161 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	. "github.com/terramate-io/terramate/cmd/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunRetries(t *testing.T) {
+	t.Parallel()
+
+	type testcase struct {
+		name         string
+		failures     string
+		exitCode     string
+		flags        []string
+		want         RunExpected
+		wantAttempts string
+	}
+
+	for _, tc := range []testcase{
+		{
+			name:     "no retries by default",
+			failures: "1",
+			exitCode: "1",
+			want: RunExpected{
+				Status:      1,
+				StderrRegex: "attempt 1 failed",
+			},
+			wantAttempts: "1",
+		},
+		{
+			name:     "succeeds after retries",
+			failures: "2",
+			exitCode: "1",
+			flags:    []string{"--retries", "2", "--retry-delay", "0s"},
+			want: RunExpected{
+				Stdout:      "attempt 3 succeeded\n",
+				StderrRegex: "attempt 2 failed",
+			},
+			wantAttempts: "3",
+		},
+		{
+			name:     "fails when retries are exhausted",
+			failures: "3",
+			exitCode: "1",
+			flags:    []string{"--retries", "2", "--retry-delay", "0s"},
+			want: RunExpected{
+				Status:      1,
+				StderrRegex: "attempt 3 failed",
+			},
+			wantAttempts: "3",
+		},
+		{
+			name:     "retryable exit code",
+			failures: "1",
+			exitCode: "3",
+			flags: []string{
+				"--retries", "1", "--retry-delay", "0s",
+				"--retry-on-exit-code", "2,3",
+			},
+			want: RunExpected{
+				Stdout:      "attempt 2 succeeded\n",
+				StderrRegex: "attempt 1 failed",
+			},
+			wantAttempts: "2",
+		},
+		{
+			name:     "non retryable exit code",
+			failures: "1",
+			exitCode: "4",
+			flags: []string{
+				"--retries", "1", "--retry-delay", "0s",
+				"--retry-on-exit-code", "3",
+			},
+			want: RunExpected{
+				Status:      1,
+				StderrRegex: "attempt 1 failed",
+			},
+			wantAttempts: "1",
+		},
+		{
+			name:     "retryable stderr",
+			failures: "1",
+			exitCode: "4",
+			flags: []string{
+				"--retries", "1", "--retry-delay", "0s",
+				"--retry-on-exit-code", "3",
+				"--retry-on-stderr", `attempt \d+ failed`,
+			},
+			want: RunExpected{
+				Stdout:      "attempt 2 succeeded\n",
+				StderrRegex: "attempt 1 failed",
+			},
+			wantAttempts: "2",
+		},
+		{
+			name:     "non retryable stderr",
+			failures: "1",
+			exitCode: "4",
+			flags: []string{
+				"--retries", "1", "--retry-delay", "0s",
+				"--retry-on-stderr", "throttling",
+			},
+			want: RunExpected{
+				Status:      1,
+				StderrRegex: "attempt 1 failed",
+			},
+			wantAttempts: "1",
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := sandbox.New(t)
+			s.BuildTree([]string{`s:stack`})
+			git := s.Git()
+			git.CommitAll("first commit")
+
+			counterFile := filepath.Join(test.TempDir(t), "counter")
+
+			args := append([]string{"run"}, tc.flags...)
+			args = append(args, HelperPath, "flaky", counterFile, tc.failures, tc.exitCode)
+
+			cli := NewCLI(t, s.RootDir())
+			AssertRunResult(t, cli.Run(args...), tc.want)
+
+			data, err := os.ReadFile(counterFile)
+			assert.NoError(t, err)
+			assert.EqualStrings(t, tc.wantAttempts, string(data), "number of attempts mismatch")
+		})
+	}
+}
+
+func TestRunRetriesInvalidOptions(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{`s:stack`})
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := NewCLI(t, s.RootDir())
+	AssertRunResult(t, cli.Run("run", "--retries=-1", HelperPath, "true"), RunExpected{
+		Status:      1,
+		StderrRegex: "--retries must be greater than or equal to 0",
+	})
+	AssertRunResult(t, cli.Run("run", "--retry-on-stderr", "[", HelperPath, "true"), RunExpected{
+		Status:      1,
+		StderrRegex: "invalid --retry-on-stderr regex",
+	})
+}
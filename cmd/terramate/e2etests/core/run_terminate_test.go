@@ -0,0 +1,203 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build unix && !darwin
+
+package core_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/madlambda/spells/assert"
+	. "github.com/terramate-io/terramate/cmd/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunForwardsSIGTERM(t *testing.T) {
+	t.Parallel()
+
+	for _, sig := range []syscall.Signal{syscall.SIGTERM, syscall.SIGHUP} {
+		sig := sig
+		t.Run(sig.String(), func(t *testing.T) {
+			t.Parallel()
+
+			s := sandbox.New(t)
+			s.BuildTree([]string{
+				`s:stack1`,
+				`s:stack2`,
+			})
+			git := s.Git()
+			git.CommitAll("first commit")
+
+			reportFile := filepath.Join(test.TempDir(t), "report.json")
+			tm := NewCLI(t, s.RootDir())
+			cmd := tm.NewCmd("run", "--report-file", reportFile, "--eval", HelperPathAsHCL,
+				`${terramate.stack.path.absolute == "/stack1" ? "sleep" : "echo"}`,
+				`${terramate.stack.path.absolute == "/stack1" ? "360s" : terramate.stack.path.absolute}`,
+			)
+			cmd.Setpgid()
+			cmd.Start()
+
+			errs := make(chan error)
+			go func() {
+				errs <- cmd.Wait()
+				close(errs)
+			}()
+
+			assert.NoError(t, PollBufferForMsgs(cmd.Stdout, errs, "ready"), cmd.Stderr.String())
+
+			// only terramate gets the signal, the sleeping process exits
+			// because the signal is forwarded to it.
+			cmd.Signal(sig)
+			waitTerramateExit(t, cmd, errs)
+
+			assert.IsTrue(t, !strings.Contains(cmd.Stdout.String(), "/stack2"), "subsequent stacks not canceled")
+
+			report := loadRunReport(t, reportFile)
+			assert.EqualInts(t, 2, len(report.Stacks), "unexpected number of stacks")
+			assert.EqualStrings(t, "canceled", report.Stacks[0].Status)
+			assert.EqualStrings(t, "canceled", report.Stacks[1].Status)
+		})
+	}
+}
+
+func TestRunKillsAfterGracePeriod(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack1`,
+		`s:stack2`,
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	tm := NewCLI(t, s.RootDir())
+	cmd := tm.NewCmd("run", "--grace-period", "1s", "--eval", HelperPathAsHCL,
+		`${terramate.stack.path.absolute == "/stack1" ? "hang" : "echo"}`,
+		`${terramate.stack.path.absolute == "/stack1" ? "" : terramate.stack.path.absolute}`,
+	)
+	cmd.Setpgid()
+	cmd.Start()
+
+	errs := make(chan error)
+	go func() {
+		errs <- cmd.Wait()
+		close(errs)
+	}()
+
+	assert.NoError(t, PollBufferForMsgs(cmd.Stdout, errs, "ready"), cmd.Stderr.String())
+
+	cmd.Signal(syscall.SIGTERM)
+	waitTerramateExit(t, cmd, errs)
+
+	// the hanging process got the forwarded signal before being killed.
+	assert.NoError(t, PollBufferForMsgs(cmd.Stdout, make(chan error), "ready", "terminated"))
+	assert.IsTrue(t, !strings.Contains(cmd.Stdout.String(), "/stack2"), "subsequent stacks not canceled")
+	assert.IsTrue(t, strings.Contains(cmd.Stderr.String(), "killed after the grace period"),
+		"unexpected stderr: %s", cmd.Stderr.String())
+}
+
+func TestRunKillKeepsResultOfFinishedStacks(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack1`,
+		`s:stack2`,
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	reportFile := filepath.Join(test.TempDir(t), "report.json")
+	tm := NewCLI(t, s.RootDir())
+	cmd := tm.NewCmd("run", "--parallel", "2", "--output-prefix", "--grace-period", "1s",
+		"--report-file", reportFile, "--eval", HelperPathAsHCL,
+		`${terramate.stack.path.absolute == "/stack1" ? "hang" : "echo"}`,
+		`${terramate.stack.path.absolute == "/stack1" ? "" : "finished"}`,
+	)
+	cmd.Setpgid()
+	cmd.Start()
+
+	errs := make(chan error)
+	go func() {
+		errs <- cmd.Wait()
+		close(errs)
+	}()
+
+	// the stacks run concurrently, so their output may come in any order.
+	assert.NoError(t, PollBufferForMsgs(cmd.Stdout, errs, "[/stack1] ready"), cmd.Stderr.String())
+	assert.NoError(t, PollBufferForMsgs(cmd.Stdout, errs, "[/stack2] finished"), cmd.Stderr.String())
+
+	cmd.Signal(syscall.SIGTERM)
+	waitTerramateExit(t, cmd, errs)
+
+	report := loadRunReport(t, reportFile)
+	assert.EqualInts(t, 2, len(report.Stacks), "unexpected number of stacks")
+
+	statuses := map[string]string{}
+	for _, entry := range report.Stacks {
+		statuses[entry.Path] = entry.Status
+	}
+	assert.EqualStrings(t, "canceled", statuses["/stack1"])
+	assert.EqualStrings(t, "ok", statuses["/stack2"])
+}
+
+func TestRunSignalsTheProcessGroupOfTheCommand(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack`,
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	// the shell stays as the parent of the hanging process, which is only
+	// signaled if the whole process group of the command gets the signals.
+	tm := NewCLI(t, s.RootDir())
+	cmd := tm.NewCmd("run", "--grace-period", "1s", "--",
+		"sh", "-c", fmt.Sprintf("%q hang; true", HelperPath),
+	)
+	cmd.Setpgid()
+	cmd.Start()
+
+	errs := make(chan error)
+	go func() {
+		errs <- cmd.Wait()
+		close(errs)
+	}()
+
+	assert.NoError(t, PollBufferForMsgs(cmd.Stdout, errs, "ready"), cmd.Stderr.String())
+
+	cmd.Signal(syscall.SIGTERM)
+	waitTerramateExit(t, cmd, errs)
+
+	assert.NoError(t, PollBufferForMsgs(cmd.Stdout, make(chan error), "ready", "terminated"))
+	assert.IsTrue(t, strings.Contains(cmd.Stderr.String(), "killed after the grace period"),
+		"unexpected stderr: %s", cmd.Stderr.String())
+}
+
+func waitTerramateExit(t *testing.T, cmd *Cmd, errs chan error) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	select {
+	case err := <-errs:
+		t.Logf("terramate stdout:\n%s\n", cmd.Stdout.String())
+		t.Logf("terramate stderr:\n%s\n", cmd.Stderr.String())
+		assert.Error(t, err)
+	case <-ctx.Done():
+		t.Fatalf("waiting for terramate to exit for too long: stdout: %s stderr: %s",
+			cmd.Stdout.String(), cmd.Stderr.String())
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	. "github.com/terramate-io/terramate/cmd/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunTimeout(t *testing.T) {
+	t.Parallel()
+
+	type testcase struct {
+		name   string
+		layout []string
+		flags  []string
+		want   RunExpected
+	}
+
+	for _, tc := range []testcase{
+		{
+			name:   "no timeout",
+			layout: []string{`s:stack`},
+			want: RunExpected{
+				Stdout: "ready\n",
+			},
+		},
+		{
+			name:   "timeout from the --timeout flag",
+			layout: []string{`s:stack`},
+			flags:  []string{"--timeout", "500ms"},
+			want: RunExpected{
+				Status:      1,
+				Stdout:      "ready\n",
+				StderrRegex: "exceeded the timeout of 500ms",
+			},
+		},
+		{
+			name:   "timeout from the stack",
+			layout: []string{`s:stack:timeout=500ms`},
+			want: RunExpected{
+				Status:      1,
+				Stdout:      "ready\n",
+				StderrRegex: "exceeded the timeout of 500ms",
+			},
+		},
+		{
+			name: "timeout from terramate.config.run",
+			layout: []string{
+				`s:stack`,
+				`f:terramate.tm:
+				terramate {
+				  config {
+				    run {
+				      timeout = "500ms"
+				    }
+				  }
+				}`,
+			},
+			want: RunExpected{
+				Status:      1,
+				Stdout:      "ready\n",
+				StderrRegex: "exceeded the timeout of 500ms",
+			},
+		},
+		{
+			name: "stack timeout overrides terramate.config.run",
+			layout: []string{
+				`s:stack:timeout=1m`,
+				`f:terramate.tm:
+				terramate {
+				  config {
+				    run {
+				      timeout = "500ms"
+				    }
+				  }
+				}`,
+			},
+			want: RunExpected{
+				Stdout: "ready\n",
+			},
+		},
+		{
+			name:   "--timeout overrides the stack timeout",
+			layout: []string{`s:stack:timeout=1m`},
+			flags:  []string{"--timeout", "500ms"},
+			want: RunExpected{
+				Status:      1,
+				Stdout:      "ready\n",
+				StderrRegex: "exceeded the timeout of 500ms",
+			},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := sandbox.New(t)
+			s.BuildTree(tc.layout)
+			git := s.Git()
+			git.CommitAll("first commit")
+
+			args := append([]string{"run"}, tc.flags...)
+			args = append(args, HelperPath, "sleep", "3s")
+
+			cli := NewCLI(t, s.RootDir())
+			AssertRunResult(t, cli.Run(args...), tc.want)
+		})
+	}
+}
+
+func TestRunTimeoutKillsAfterGracePeriod(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{`s:stack`})
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	// the hanging command ignores the interruption, so it's killed after
+	// the grace period and the timeout is still reported as a failure.
+	reportFile := filepath.Join(test.TempDir(t), "report.json")
+	cli := NewCLI(t, s.RootDir())
+	AssertRunResult(t, cli.Run("run", "--timeout", "500ms", "--grace-period", "1s",
+		"--report-file", reportFile, HelperPath, "hang"), RunExpected{
+		Status:       1,
+		IgnoreStdout: true,
+		StderrRegex:  "exceeded the timeout of 500ms",
+	})
+
+	report := loadRunReport(t, reportFile)
+	assert.EqualInts(t, 1, len(report.Stacks), "unexpected number of stacks")
+	assert.EqualStrings(t, "timeout", report.Stacks[0].Status)
+	assert.IsTrue(t, report.Stacks[0].Error != "", "timeout error not reported")
+}
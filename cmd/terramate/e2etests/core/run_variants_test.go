@@ -0,0 +1,109 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	. "github.com/terramate-io/terramate/cmd/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunStackVariants(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`f:globals.tm:
+		  globals {
+		    region = "us-east-1"
+		  }`,
+		`f:stacks/a/stack.tm:
+		  stack {
+		    variant "eu" {
+		      globals {
+		        region = "eu-west-1"
+		      }
+		      env {
+		        AWS_REGION = global.region
+		      }
+		    }
+		    variant "us" {
+		      env {
+		        AWS_REGION = global.region
+		      }
+		    }
+		  }`,
+		`s:stacks/b`,
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	cli := NewCLI(t, s.RootDir())
+	AssertRunResult(t, cli.Run("run", "--quiet", "--eval", HelperPathAsHCL, "echo", "${global.region}"), RunExpected{
+		Stdout: "eu-west-1\nus-east-1\nus-east-1\n",
+	})
+
+	AssertRunResult(t, cli.Run("run", "--dry-run", HelperPath, "true"), RunExpected{
+		Stdout: `The stacks will be executed using order below:
+	0. a (stacks/a@eu)
+	1. a (stacks/a@us)
+	2. b (stacks/b)
+`,
+	})
+
+	AssertRunResult(t, cli.Run("experimental", "run-env"), RunExpected{
+		Stdout: `
+stack "/stacks/a@eu":
+	AWS_REGION=eu-west-1
+
+stack "/stacks/a@us":
+	AWS_REGION=us-east-1
+
+stack "/stacks/b":
+`,
+	})
+
+	reportFile := filepath.Join(test.TempDir(t), "report.json")
+	AssertRunResult(t, cli.Run("run", "--quiet", "--report-file", reportFile, HelperPath, "true"), RunExpected{})
+
+	report := loadRunReport(t, reportFile)
+	assert.EqualInts(t, 3, len(report.Stacks), "unexpected number of stacks")
+	for i, want := range []struct{ path, variant string }{
+		{"/stacks/a", "eu"},
+		{"/stacks/a", "us"},
+		{"/stacks/b", ""},
+	} {
+		assert.EqualStrings(t, want.path, report.Stacks[i].Path)
+		assert.EqualStrings(t, want.variant, report.Stacks[i].Variant)
+		assert.EqualStrings(t, "ok", report.Stacks[i].Status)
+	}
+}
+
+func TestRunStackVariantsParallelDoNotOverlap(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`f:stacks/a/stack.tm:
+		  stack {
+		    variant "one" {}
+		    variant "two" {}
+		    variant "three" {}
+		  }`,
+		`s:stacks/b`,
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	// the marker is created inside the stack directory, then the stacks
+	// which are not variants of the same stack don't conflict.
+	cli := NewCLI(t, s.RootDir())
+	AssertRunResult(t, cli.Run("run", "--parallel", "4", HelperPath, "exclusive", "marker", "300ms"), RunExpected{
+		Stdout: nljoin("done", "done", "done", "done"),
+	})
+}
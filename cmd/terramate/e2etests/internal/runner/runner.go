@@ -158,6 +158,14 @@ func (tc *Cmd) Run() error {
 	return tc.cmd.Run()
 }
 
+// Signal sends the signal to the command process only.
+func (tc *Cmd) Signal(s os.Signal) {
+	t := tc.t
+	t.Helper()
+
+	assert.NoError(t, tc.cmd.Process.Signal(s))
+}
+
 // ExitCode returns the exit code for a finished command.
 func (tc *Cmd) ExitCode() int {
 	return tc.cmd.ProcessState.ExitCode()
@@ -242,27 +242,38 @@ func (root *Root) Runtime() project.Runtime {
 	return runtime
 }
 
+// SetRuntimeHostDir makes the terramate.root.path.fs metadata refer to the
+// given host directory instead of the directory the configuration was loaded
+// from. This is useful to evaluate a copy of the project, like the project
+// exported from another git revision, as if it was at the original directory.
+func (root *Root) SetRuntimeHostDir(hostdir string) {
+	root.runtime["root"] = rootRuntime(hostdir)
+}
+
 func (root *Root) initRuntime() {
-	rootfs := cty.ObjectVal(map[string]cty.Value{
-		"absolute": cty.StringVal(root.HostDir()),
-		"basename": cty.StringVal(filepath.Base(root.HostDir())),
-	})
-	rootpath := cty.ObjectVal(map[string]cty.Value{
-		"fs": rootfs,
-	})
-	rootNS := cty.ObjectVal(map[string]cty.Value{
-		"path": rootpath,
-	})
 	stacksNs := cty.ObjectVal(map[string]cty.Value{
 		"list": toCtyStringList(root.Stacks().Strings()),
 	})
 	root.runtime = project.Runtime{
-		"root":    rootNS,
+		"root":    rootRuntime(root.HostDir()),
 		"stacks":  stacksNs,
 		"version": cty.StringVal(terramate.Version()),
 	}
 }
 
+func rootRuntime(hostdir string) cty.Value {
+	rootfs := cty.ObjectVal(map[string]cty.Value{
+		"absolute": cty.StringVal(hostdir),
+		"basename": cty.StringVal(filepath.Base(hostdir)),
+	})
+	rootpath := cty.ObjectVal(map[string]cty.Value{
+		"fs": rootfs,
+	})
+	return cty.ObjectVal(map[string]cty.Value{
+		"path": rootpath,
+	})
+}
+
 // LoadTree loads the whole hierarchical configuration from cfgdir downwards
 // using rootdir as project root.
 func LoadTree(rootdir string, cfgdir string) (*Tree, error) {
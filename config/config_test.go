@@ -16,6 +16,23 @@ import (
 	"github.com/terramate-io/terramate/test/sandbox"
 )
 
+func TestRootSetRuntimeHostDir(t *testing.T) {
+	t.Parallel()
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{"s:/stack"})
+
+	root, err := config.LoadRoot(s.RootDir())
+	assert.NoError(t, err)
+
+	hostdir := filepath.Join(t.TempDir(), "project")
+	root.SetRuntimeHostDir(hostdir)
+
+	rootfs := root.Runtime()["root"].GetAttr("path").GetAttr("fs")
+	assert.EqualStrings(t, hostdir, rootfs.GetAttr("absolute").AsString())
+	assert.EqualStrings(t, "project", rootfs.GetAttr("basename").AsString())
+	assert.EqualStrings(t, s.RootDir(), root.HostDir())
+}
+
 func TestIsStack(t *testing.T) {
 	t.Parallel()
 	s := sandbox.NoGit(t, true)
@@ -81,6 +98,40 @@ func TestValidStackIDs(t *testing.T) {
 	}
 }
 
+func TestStackVariantIDValidation(t *testing.T) {
+	t.Parallel()
+
+	const id = "stack_id_with_sixty_one_bytes_which_leaves_room_for_two_bytes"
+
+	for _, tc := range []struct {
+		variant string
+		valid   bool
+	}{
+		{variant: "eu", valid: true},
+		{variant: "eu-west", valid: false},
+	} {
+		tc := tc
+		t.Run(tc.variant, func(t *testing.T) {
+			t.Parallel()
+			s := sandbox.NoGit(t, true)
+			s.BuildTree([]string{
+				fmt.Sprintf(`f:stack/stack.tm:stack {
+				  id = %q
+				  variant %q {}
+				}`, id, tc.variant),
+			})
+			root, err := config.LoadRoot(s.RootDir())
+			assert.NoError(t, err)
+			_, err = config.LoadStack(root, project.NewPath("/stack"))
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.IsError(t, err, errors.E(config.ErrStackValidation))
+			}
+		})
+	}
+}
+
 func TestConfigLookup(t *testing.T) {
 	t.Parallel()
 	s := sandbox.NoGit(t, true)
@@ -9,7 +9,9 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
+	"github.com/bmatcuk/doublestar"
 	"github.com/rs/zerolog/log"
 	"github.com/terramate-io/terramate/config/tag"
 	"github.com/terramate-io/terramate/errors"
@@ -51,11 +53,27 @@ type (
 		// whenever they are selected.
 		WantedBy []string
 
-		// Watch is the list of files to be watched for changes.
+		// Watch is the list of files, directories and glob patterns to be
+		// watched for changes.
 		Watch []project.Path
 
+		// Timeout is the maximum duration of the commands executed in the
+		// stack. Zero means it's not set.
+		Timeout time.Duration
+
 		// IsChanged tells if this is a changed stack.
 		IsChanged bool
+
+		// Variants are the variants of the stack.
+		Variants []hcl.StackVariant
+
+		// Variant is the variant selected for the execution of the stack.
+		// It's nil if no variant is selected.
+		Variant *hcl.StackVariant
+
+		// Disabled tells if the stack is excluded from the executions and
+		// from the changed stacks.
+		Disabled bool
 	}
 
 	// SortableStack is a wrapper for the Stack which implements the [DirElem] type.
@@ -106,6 +124,9 @@ func NewStackFromHCL(root string, cfg hcl.Config) (*Stack, error) {
 		Wants:       cfg.Stack.Wants,
 		WantedBy:    cfg.Stack.WantedBy,
 		Watch:       watchFiles,
+		Timeout:     cfg.Stack.Timeout,
+		Variants:    cfg.Stack.Variants,
+		Disabled:    cfg.Stack.Disabled,
 		Dir:         project.PrjAbsPath(root, cfg.AbsDir()),
 	}
 	err = stack.Validate()
@@ -141,7 +162,10 @@ func (s Stack) validateTagsField() error {
 	return nil
 }
 
-const stackIDRegexPattern = "^[a-zA-Z0-9_-]{1,64}$"
+const (
+	stackIDRegexPattern = "^[a-zA-Z0-9_-]{1,64}$"
+	stackIDMaxLen       = 64
+)
 
 var _ = regexp.MustCompile(stackIDRegexPattern)
 
@@ -153,6 +177,14 @@ func (s Stack) validateID() error {
 	if !stackIDRegex.MatchString(s.ID) {
 		return errors.E("stack ID %q doesn't match %q", s.ID, stackIDRegexPattern)
 	}
+	// The ID of each variant is also the meta_id used in the cloud, which has
+	// the same length limit of the stack ID.
+	for _, variant := range s.Variants {
+		if id := s.ID + "@" + variant.Name; len(id) > stackIDMaxLen {
+			return errors.E("stack ID %q with variant %q has more than %d characters",
+				s.ID, variant.Name, stackIDMaxLen)
+		}
+	}
 	return nil
 }
 
@@ -198,6 +230,39 @@ func (s *Stack) AppendBefore(path string) {
 // String representation of the stack.
 func (s *Stack) String() string { return s.Dir.String() }
 
+// VariantPath returns the path of the stack suffixed by "@<variant>" when a
+// variant is selected, which identifies each variant as a distinct unit.
+func (s *Stack) VariantPath() string {
+	if s.Variant == nil {
+		return s.Dir.String()
+	}
+	return s.Dir.String() + "@" + s.Variant.Name
+}
+
+// VariantID returns the ID of the stack suffixed by "@<variant>" when a
+// variant is selected. It's empty if the stack has no ID.
+func (s *Stack) VariantID() string {
+	if s.ID == "" || s.Variant == nil {
+		return s.ID
+	}
+	return s.ID + "@" + s.Variant.Name
+}
+
+// ExpandVariants returns a copy of the stack for each of its variants, with
+// the variant selected, or the stack itself if it has no variants.
+func (s *Stack) ExpandVariants() []*Stack {
+	if len(s.Variants) == 0 {
+		return []*Stack{s}
+	}
+	stacks := make([]*Stack, len(s.Variants))
+	for i := range s.Variants {
+		variant := *s
+		variant.Variant = &s.Variants[i]
+		stacks[i] = &variant
+	}
+	return stacks
+}
+
 // PathBase returns the base name of the stack path.
 func (s *Stack) PathBase() string { return filepath.Base(s.Dir.String()) }
 
@@ -233,6 +298,9 @@ func (s *Stack) RuntimeValues(root *Root) map[string]cty.Value {
 	if s.ID != "" {
 		stackMapVals["id"] = cty.StringVal(s.ID)
 	}
+	if s.Variant != nil {
+		stackMapVals["variant"] = cty.StringVal(s.Variant.Name)
+	}
 	stack := cty.ObjectVal(stackMapVals)
 	return map[string]cty.Value{
 		"name":        cty.StringVal(s.Name),         // DEPRECATED
@@ -249,6 +317,21 @@ func (s *Stack) Sortable() *SortableStack {
 	}
 }
 
+// WatchMatches tells if the file, given as a path relative to the project
+// root, matches the watch path. A watched directory matches all the files
+// inside it and a glob pattern matches the files as documented in
+// [doublestar.Match].
+func WatchMatches(watch project.Path, file string) bool {
+	if project.NewPath("/" + file).HasDirPrefix(watch.String()) {
+		return true
+	}
+	if !isGlobPattern(watch.String()) {
+		return false
+	}
+	matched, _ := doublestar.Match(watch.String()[1:], file)
+	return matched
+}
+
 func validateWatchPaths(rootdir string, stackpath string, paths []string) (project.Paths, error) {
 	var projectPaths project.Paths
 	for _, pathstr := range paths {
@@ -261,23 +344,31 @@ func validateWatchPaths(rootdir string, stackpath string, paths []string) (proje
 		if !strings.HasPrefix(abspath, rootdir) {
 			return nil, errors.E("path %s is outside project root", pathstr)
 		}
-		st, err := os.Stat(abspath)
-		if err == nil {
-			if st.IsDir() {
-				return nil, errors.E("stack.watch must be a list of regular files "+
-					"but directory %q was provided", pathstr)
-			}
-
-			if !st.Mode().IsRegular() {
-				return nil, errors.E("stack.watch must be a list of regular files "+
-					"but file %q has mode %s", pathstr, st.Mode())
+		prjpath := project.PrjAbsPath(rootdir, abspath)
+		if isGlobPattern(pathstr) {
+			// matching the pattern against itself detects syntax errors.
+			pattern := prjpath.String()
+			if _, err := doublestar.Match(pattern, pattern); err != nil {
+				return nil, errors.E(err, "invalid glob pattern %q", pathstr)
 			}
+			projectPaths = append(projectPaths, prjpath)
+			continue
 		}
-		projectPaths = append(projectPaths, project.PrjAbsPath(rootdir, abspath))
+		st, err := os.Stat(abspath)
+		if err == nil && !st.IsDir() && !st.Mode().IsRegular() {
+			return nil, errors.E("stack.watch must be a list of regular files, "+
+				"directories or glob patterns but file %q has mode %s", pathstr, st.Mode())
+		}
+		projectPaths = append(projectPaths, prjpath)
 	}
 	return projectPaths, nil
 }
 
+// isGlobPattern tells if the path has any of the glob pattern meta characters.
+func isGlobPattern(pathstr string) bool {
+	return strings.ContainsAny(pathstr, "*?[{")
+}
+
 // StacksFromTrees converts a List[*Tree] into a List[*Stack].
 func StacksFromTrees(root string, trees List[*Tree]) (List[*SortableStack], error) {
 	var stacks List[*SortableStack]
@@ -145,6 +145,75 @@ func Load(root *config.Root, vendorDir project.Path) ([]LoadResult, error) {
 	return results, nil
 }
 
+// LoadFileReads evaluates the globals and the generate blocks of the given
+// stack and returns the files read by the filesystem functions, like tm_file,
+// tm_templatefile and tm_fileset, during their evaluation. The files outside
+// the project are ignored.
+//
+// The given vendorDir is used when calculating the vendor path using tm_vendor
+// on the generate blocks.
+func LoadFileReads(root *config.Root, st *config.Stack, vendorDir project.Path) ([]stack.FileRead, error) {
+	var reads []stack.FileRead
+	addRead := func(by, path string) {
+		relpath, err := filepath.Rel(root.HostDir(), path)
+		if err != nil || relpath == ".." || strings.HasPrefix(relpath, ".."+string(filepath.Separator)) {
+			return
+		}
+		reads = append(reads, stack.FileRead{
+			Path: project.PrjAbsPath(root.HostDir(), path),
+			By:   by,
+		})
+	}
+
+	report := globals.ForStackWithFileReads(root, st, func(path string) {
+		addRead("globals", path)
+	})
+	if err := report.AsError(); err != nil {
+		return nil, errors.E(ErrLoadingGlobals, err)
+	}
+
+	_, err := genfile.Load(root, st, report.Globals, vendorDir, nil, func(label, path string) {
+		addRead(fmt.Sprintf("generate_file %q", label), path)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = genhcl.Load(root, st, report.Globals, vendorDir, nil, func(label, path string) {
+		addRead(fmt.Sprintf("generate_hcl %q", label), path)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reads, nil
+}
+
+// LoadStackCode loads the code generated for the given stack, mapping the name
+// of each generated file to its content. The files of blocks with a false
+// condition are not included.
+//
+// The given vendorDir is used when calculating the vendor path using tm_vendor
+// on the generate blocks.
+func LoadStackCode(root *config.Root, st *config.Stack, vendorDir project.Path) (map[string]string, error) {
+	report := globals.ForStack(root, st)
+	if err := report.AsError(); err != nil {
+		return nil, errors.E(ErrLoadingGlobals, err)
+	}
+
+	generated, err := loadStackCodeCfgs(root, st, report.Globals, vendorDir, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	code := map[string]string{}
+	for _, file := range generated {
+		if file.Condition() {
+			code[file.Label()] = file.Header() + file.Body()
+		}
+	}
+	return code, nil
+}
+
 // Do will generate code for the entire configuration.
 //
 // There generation mechanism depend on the generate_* block context attribute:
@@ -1195,12 +1264,12 @@ func loadStackCodeCfgs(
 
 	var genfilesConfigs []GenFile
 
-	genfiles, err := genfile.Load(root, st, globals, vendorDir, vendorRequests)
+	genfiles, err := genfile.Load(root, st, globals, vendorDir, vendorRequests, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	genhcls, err := genhcl.Load(root, st, globals, vendorDir, vendorRequests)
+	genhcls, err := genhcl.Load(root, st, globals, vendorDir, vendorRequests, nil)
 	if err != nil {
 		return nil, err
 	}
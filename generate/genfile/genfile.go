@@ -116,6 +116,10 @@ func (f File) String() string {
 // Metadata and globals for the stack are used on the evaluation of the
 // generate_file blocks.
 //
+// If onFileRead is not nil, it's called with the label of the block and the
+// absolute path of each file read by the filesystem functions during the
+// evaluation of the generate_file block.
+//
 // The rootdir MUST be an absolute path.
 func Load(
 	root *config.Root,
@@ -123,6 +127,7 @@ func Load(
 	globals *eval.Object,
 	vendorDir project.Path,
 	vendorRequests chan<- event.VendorRequest,
+	onFileRead func(label, path string),
 ) ([]File, error) {
 	genFileBlocks, err := loadGenFileBlocks(root, st.Dir)
 	if err != nil {
@@ -143,6 +148,11 @@ func Load(
 			path.Dir(name)))
 
 		evalctx.SetFunction(stdlib.Name("vendor"), stdlib.VendorFunc(vendorTargetDir, vendorDir, vendorRequests))
+		if onFileRead != nil {
+			stdlib.TrackFileReads(evalctx.Context, st.HostDir(root), func(path string) {
+				onFileRead(name, path)
+			})
+		}
 
 		file, err := Eval(genFileBlock, evalctx.Context)
 		if err != nil {
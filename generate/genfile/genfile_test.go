@@ -975,7 +975,7 @@ func testGenfile(t *testing.T, tcase testcase) {
 
 		globals := s.LoadStackGlobals(root, stack)
 		vendorDir := project.NewPath("/modules")
-		got, err := genfile.Load(root, stack, globals, vendorDir, nil)
+		got, err := genfile.Load(root, stack, globals, vendorDir, nil, nil)
 		errtest.Assert(t, err, tcase.wantErr)
 
 		if len(got) != len(tcase.want) {
@@ -131,6 +131,10 @@ func (h HCL) String() string {
 // Metadata and globals for the stack are used on the evaluation of the
 // generate_hcl blocks.
 //
+// If onFileRead is not nil, it's called with the label of the block and the
+// absolute path of each file read by the filesystem functions during the
+// evaluation of the generate_hcl block.
+//
 // The rootdir MUST be an absolute path.
 func Load(
 	root *config.Root,
@@ -138,6 +142,7 @@ func Load(
 	globals *eval.Object,
 	vendorDir project.Path,
 	vendorRequests chan<- event.VendorRequest,
+	onFileRead func(label, path string),
 ) ([]HCL, error) {
 	hclBlocks, err := loadGenHCLBlocks(root, st.Dir)
 	if err != nil {
@@ -157,6 +162,11 @@ func Load(
 			stdlib.Name("vendor"),
 			stdlib.VendorFunc(vendorTargetDir, vendorDir, vendorRequests),
 		)
+		if onFileRead != nil {
+			stdlib.TrackFileReads(evalctx.Context, st.HostDir(root), func(path string) {
+				onFileRead(name, path)
+			})
+		}
 
 		err := lets.Load(hclBlock.Lets, evalctx.Context)
 		if err != nil {
@@ -1739,7 +1739,7 @@ func (tcase testcase) run(t *testing.T) {
 
 		globals := s.LoadStackGlobals(cfg, stack)
 		vendorDir := project.NewPath("/modules")
-		got, err := genhcl.Load(cfg, stack, globals, vendorDir, nil)
+		got, err := genhcl.Load(cfg, stack, globals, vendorDir, nil, nil)
 		errtest.Assert(t, err, tcase.wantErr)
 
 		if len(got) != len(tcase.want) {
@@ -1743,7 +1743,7 @@ EOT
 
 			globals := s.LoadStackGlobals(root, stack)
 			vendorDir := project.NewPath("/modules")
-			got, err := genhcl.Load(root, stack, globals, vendorDir, nil)
+			got, err := genhcl.Load(root, stack, globals, vendorDir, nil, nil)
 			errtest.Assert(t, err, tcase.wantErr)
 			if err != nil {
 				return
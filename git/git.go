@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -435,6 +436,45 @@ func (git *Git) MergeBase(commit1, commit2 string) (string, error) {
 	return git.exec("merge-base", commit1, commit2)
 }
 
+// ExportTree writes the files of the given revision into the dir directory.
+// It uses a temporary index, so the index and the working tree of the
+// repository are not changed.
+func (git *Git) ExportTree(rev, dir string) error {
+	tmpdir, err := os.MkdirTemp("", "git-export-tree")
+	if err != nil {
+		return fmt.Errorf("creating temporary index dir: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(tmpdir) }()
+
+	log.Debug().
+		Str("action", "ExportTree()").
+		Str("workingDir", git.config.WorkingDir).
+		Str("rev", rev).
+		Str("dir", dir).
+		Msg("Export tree.")
+
+	indexGit := *git
+	indexGit.config.Env = append(
+		append([]string{}, git.config.Env...),
+		"GIT_INDEX_FILE="+filepath.Join(tmpdir, "index"),
+	)
+
+	if _, err := indexGit.exec("read-tree", rev); err != nil {
+		return fmt.Errorf("read-tree: %w", err)
+	}
+
+	absdir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("computing absolute path of %s: %w", dir, err)
+	}
+
+	_, err = indexGit.exec("checkout-index", "--all", "--prefix="+absdir+string(filepath.Separator))
+	if err != nil {
+		return fmt.Errorf("checkout-index: %w", err)
+	}
+	return nil
+}
+
 // Status returns the git status of the current branch.
 // Beware: Status is a porcelain method.
 func (git *Git) Status() (string, error) {
@@ -629,6 +669,30 @@ func (git *Git) ListUncommitted(dirs ...string) ([]string, error) {
 	return removeEmptyLines(strings.Split(out, "\n")), nil
 }
 
+// ListStaged lists files staged for commit in the directories provided in dirs.
+// The file names are relative to the configuration WorkingDir.
+func (git *Git) ListStaged(dirs ...string) ([]string, error) {
+	args := []string{
+		"--cached", "--name-only", "--relative",
+	}
+
+	if len(dirs) > 0 {
+		args = append(args, "--")
+		args = append(args, dirs...)
+	}
+
+	log.Debug().
+		Str("action", "ListStaged()").
+		Str("workingDir", git.config.WorkingDir).
+		Msg("List staged files.")
+	out, err := git.exec("diff", args...)
+	if err != nil {
+		return nil, fmt.Errorf("diff: %w", err)
+	}
+
+	return removeEmptyLines(strings.Split(out, "\n")), nil
+}
+
 // ShowCommitMetadata returns common metadata associated with the given object.
 // An object name can be a commit SHA or a symbolic name, i.e. HEAD, branch-name, etc.
 func (git *Git) ShowCommitMetadata(objectName string) (*CommitMetadata, error) {
@@ -155,6 +155,33 @@ func TestClone(t *testing.T) {
 	assert.EqualStrings(t, content, string(got))
 }
 
+func TestExportTree(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.RootEntry().CreateFile("file.txt", "v1")
+	s.RootEntry().CreateDir("dir").CreateFile("nested.txt", "nested")
+	git := s.Git()
+	git.CommitAll("first commit")
+
+	s.RootEntry().CreateFile("file.txt", "v2")
+	git.CommitAll("second commit")
+	s.RootEntry().CreateFile("file.txt", "uncommitted")
+
+	g := test.NewGitWrapper(t, s.RootDir(), []string{})
+	exportDir := test.TempDir(t)
+	assert.NoError(t, g.ExportTree("HEAD^", exportDir))
+
+	assert.EqualStrings(t, "v1", string(test.ReadFile(t, exportDir, "file.txt")))
+	assert.EqualStrings(t, "nested", string(test.ReadFile(t, exportDir, "dir/nested.txt")))
+
+	// the working tree and the index are not changed.
+	assert.EqualStrings(t, "uncommitted", string(test.ReadFile(t, s.RootDir(), "file.txt")))
+	staged, err := g.ListStaged()
+	assert.NoError(t, err)
+	assert.EqualInts(t, 0, len(staged), "unexpected staged files: %v", staged)
+}
+
 func TestCurrentBranch(t *testing.T) {
 	t.Parallel()
 	s := sandbox.New(t)
@@ -14,6 +14,7 @@ import (
 	"github.com/terramate-io/terramate/globals"
 	"github.com/terramate-io/terramate/hcl"
 	"github.com/terramate-io/terramate/hcl/eval"
+	"github.com/terramate-io/terramate/project"
 	"github.com/terramate-io/terramate/stack"
 
 	"github.com/terramate-io/terramate/test"
@@ -4086,6 +4087,76 @@ func TestLoadGlobalsErrors(t *testing.T) {
 	}
 }
 
+func TestLoadGlobalsForStackVariants(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`f:globals.tm:
+		  globals {
+		    region = "us-east-1"
+		    bucket = "bucket-${global.region}"
+		  }`,
+		`f:stack/stack.tm:
+		  stack {
+		    variant "eu" {
+		      globals {
+		        region  = "eu-west-1"
+		        variant = terramate.stack.variant
+		      }
+		    }
+		    variant "us" {}
+		  }`,
+	})
+
+	st, err := config.LoadStack(s.Config(), project.NewPath("/stack"))
+	assert.NoError(t, err)
+
+	variants := st.ExpandVariants()
+	assert.EqualInts(t, 2, len(variants))
+
+	for _, tc := range []struct {
+		stack *config.Stack
+		want  *hclwrite.Block
+	}{
+		{
+			stack: st,
+			want: Globals(
+				Str("region", "us-east-1"),
+				Str("bucket", "bucket-us-east-1"),
+			),
+		},
+		{
+			stack: variants[0],
+			want: Globals(
+				Str("region", "eu-west-1"),
+				Str("bucket", "bucket-eu-west-1"),
+				Str("variant", "eu"),
+			),
+		},
+		{
+			stack: variants[1],
+			want: Globals(
+				Str("region", "us-east-1"),
+				Str("bucket", "bucket-us-east-1"),
+			),
+		},
+	} {
+		report := globals.ForStack(s.Config(), tc.stack)
+		assert.NoError(t, report.AsError())
+
+		got := report.Globals.AsValueMap()
+		want := tc.want.AttributesValues()
+		assert.EqualInts(t, len(want), len(got), "globals of %s", tc.stack.VariantPath())
+		for name, wantVal := range want {
+			if diff := ctydebug.DiffValues(wantVal, got[name]); diff != "" {
+				t.Errorf("global.%s of %s doesn't match expectation:\n%s",
+					name, tc.stack.VariantPath(), diff)
+			}
+		}
+	}
+}
+
 func testGlobals(t *testing.T, tcase testcase) {
 	t.Run(tcase.name, func(t *testing.T) {
 		t.Parallel()
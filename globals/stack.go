@@ -10,12 +10,61 @@ import (
 )
 
 // ForStack loads from the config tree all globals defined for a given stack.
+// If a variant of the stack is selected, its globals override the ones
+// defined in the stack directory.
 func ForStack(root *config.Root, stack *config.Stack) EvalReport {
 	ctx := eval.NewContext(
 		stdlib.Functions(stack.HostDir(root)),
 	)
+	return forStack(root, stack, ctx)
+}
+
+// ForStackWithFileReads is like ForStack but also reports the files read by
+// the filesystem functions during the evaluation of the globals to onRead.
+func ForStackWithFileReads(root *config.Root, stack *config.Stack, onRead stdlib.FileReadFunc) EvalReport {
+	ctx := eval.NewContext(
+		stdlib.Functions(stack.HostDir(root)),
+	)
+	stdlib.TrackFileReads(ctx, stack.HostDir(root), onRead)
+	return forStack(root, stack, ctx)
+}
+
+func forStack(root *config.Root, stack *config.Stack, ctx *eval.Context) EvalReport {
 	runtime := root.Runtime()
 	runtime.Merge(stack.RuntimeValues(root))
 	ctx.SetNamespace("terramate", runtime)
-	return ForDir(root, stack.Dir, ctx)
+	if stack.Variant == nil {
+		return ForDir(root, stack.Dir, ctx)
+	}
+
+	tree, ok := root.Lookup(stack.Dir)
+	if !ok {
+		return NewEvalReport()
+	}
+
+	exprs, err := LoadExprs(tree)
+	if err != nil {
+		report := NewEvalReport()
+		report.BootstrapErr = err
+		return report
+	}
+	exprs.SetVariantOverrides(stack)
+	return exprs.Eval(ctx)
+}
+
+// SetVariantOverrides sets the globals of the selected variant of the stack,
+// if any, as overrides at the stack directory. Globals depending on the
+// overridden ones are evaluated with the values of the variant.
+func (dirExprs HierarchicalExprs) SetVariantOverrides(stack *config.Stack) {
+	if stack.Variant == nil {
+		return
+	}
+	for _, attr := range stack.Variant.Globals.SortedList() {
+		dirExprs.SetOverride(
+			stack.Dir,
+			NewGlobalAttrPath(nil, attr.Name),
+			attr.Expr,
+			attr.Range,
+		)
+	}
 }
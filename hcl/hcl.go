@@ -8,8 +8,10 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclparse"
@@ -47,6 +49,7 @@ type Config struct {
 	Asserts   []AssertConfig
 	Generate  GenerateConfig
 	Scripts   []*Script
+	Run       *Run
 
 	Imported RawConfig
 
@@ -74,8 +77,71 @@ type RunConfig struct {
 	// CheckGenCode enables generated code is up-to-date check on run.
 	CheckGenCode bool
 
+	// Timeout is the maximum duration of the command in each stack.
+	// Zero means no timeout.
+	Timeout time.Duration
+
 	// Env contains environment definitions for run.
 	Env *RunEnv
+
+	// InheritEnv selects the variables of the host environment which are
+	// inherited by the commands.
+	InheritEnv *RunInheritEnv
+
+	// EnvFiles is the expression of the list of dotenv files loaded into the
+	// environment of the stacks. It's evaluated for each stack.
+	EnvFiles *ast.Attribute
+
+	// SensitiveEnv is the list of environment variables whose values are
+	// masked in the output of the commands.
+	SensitiveEnv []string
+
+	// SensitiveGlobals is the list of globals, in the form of dot separated
+	// paths, whose values are masked in the output of the commands.
+	SensitiveGlobals []string
+
+	// MaskPatterns is the list of regular expressions whose matches are
+	// masked in the output of the commands.
+	MaskPatterns []string
+
+	// Before is the hook executed before the command of each stack.
+	Before *RunHook
+
+	// After is the hook executed after the command of each stack.
+	After *RunHook
+}
+
+// RunInheritEnv represents the terramate.config.run.inherit_env block.
+type RunInheritEnv struct {
+	// Allow is the list of glob patterns of the inherited variables. A nil
+	// list allows all variables, while an empty list allows none.
+	Allow []string
+
+	// Deny is the list of glob patterns of the variables which are not
+	// inherited, even if allowed.
+	Deny []string
+}
+
+// RunHook represents a command executed before or after the command of each
+// stack.
+type RunHook struct {
+	// Command is the command of the hook. It's evaluated for each stack.
+	Command *Command
+}
+
+// Run represents the `run` block, which configures the execution of commands
+// in the stacks of the directory where it's defined and its child directories.
+type Run struct {
+	// Condition is the expression which decides if the stacks must be
+	// executed, if any.
+	Condition *ast.Attribute
+
+	// Env contains environment definitions for the stacks.
+	Env *RunEnv
+
+	// SensitiveEnv is the list of environment variables whose values are
+	// masked in the output of the commands of the stacks.
+	SensitiveEnv []string
 }
 
 // RunEnv represents Terramate run environment.
@@ -105,6 +171,17 @@ type GitConfig struct {
 	CheckRemote bool
 }
 
+// ChangeDetectionConfig represents the terramate.config.change_detection block.
+type ChangeDetectionConfig struct {
+	// FileReads enables the change detection of the files read during the
+	// evaluation of the stacks.
+	FileReads bool
+
+	// Evaluation enables the change detection of the globals and of the
+	// generated code of the stacks, compared with their values at the base ref.
+	Evaluation bool
+}
+
 // CloudConfig represents Terramate cloud configuration.
 type CloudConfig struct {
 	// Organization is the name of the cloud organization
@@ -113,10 +190,11 @@ type CloudConfig struct {
 
 // RootConfig represents the root config block of a Terramate configuration.
 type RootConfig struct {
-	Git         *GitConfig
-	Run         *RunConfig
-	Cloud       *CloudConfig
-	Experiments []string
+	Git             *GitConfig
+	Run             *RunConfig
+	Cloud           *CloudConfig
+	ChangeDetection *ChangeDetectionConfig
+	Experiments     []string
 }
 
 // ManifestDesc represents a parsed manifest description.
@@ -186,6 +264,32 @@ type Stack struct {
 
 	// Watch is a list of files to be watched for changes.
 	Watch []string
+
+	// Timeout is the maximum duration of the commands executed in the stack.
+	// Zero means that it's not set.
+	Timeout time.Duration
+
+	// Variants are the variants of the stack, each one executed as a distinct
+	// unit by terramate run.
+	Variants []StackVariant
+
+	// Disabled tells if the stack is excluded from the executions and from
+	// the changed stacks.
+	Disabled bool
+}
+
+// StackVariant is the parsed "stack.variant" HCL block.
+type StackVariant struct {
+	// Name of the variant.
+	Name string
+
+	// Globals are the globals overridden by the variant, evaluated in the
+	// context of the stack.
+	Globals ast.Attributes
+
+	// Env are the environment variables set by the variant, evaluated in the
+	// context of the stack.
+	Env ast.Attributes
 }
 
 // GenHCLBlock represents a parsed generate_hcl block.
@@ -638,13 +742,29 @@ func (p *TerramateParser) parseStack(stackblock *ast.Block) (*Stack, error) {
 		Logger()
 
 	errs := errors.L()
-	for _, block := range stackblock.Body.Blocks {
-		errs.Append(
-			errors.E(block.TypeRange, "unrecognized block %q", block.Type),
-		)
-	}
-
 	stack := &Stack{}
+	variants := map[string]struct{}{}
+	for _, block := range stackblock.Blocks {
+		if block.Type != "variant" {
+			errs.Append(
+				errors.E(block.TypeRange, "unrecognized block %q", block.Type),
+			)
+			continue
+		}
+
+		variant, err := parseStackVariant(block)
+		if err != nil {
+			errs.Append(err)
+			continue
+		}
+		if _, ok := variants[variant.Name]; ok {
+			errs.Append(errors.E(block.LabelRanges(),
+				"duplicated stack.variant %q", variant.Name))
+			continue
+		}
+		variants[variant.Name] = struct{}{}
+		stack.Variants = append(stack.Variants, variant)
+	}
 
 	logger.Debug().Msg("Get stack attributes.")
 	attrs := ast.AsHCLAttributes(stackblock.Body.Attributes)
@@ -715,6 +835,24 @@ func (p *TerramateParser) parseStack(stackblock *ast.Block) (*Stack, error) {
 		case "watch":
 			errs.Append(assignSet(attr, &stack.Watch, attrVal))
 
+		case "timeout":
+			timeout, err := parseTimeout(attrVal)
+			if err != nil {
+				errs.Append(hclAttrErr(attr, "field stack.timeout %s", err))
+				continue
+			}
+			stack.Timeout = timeout
+
+		case "disabled":
+			if attrVal.Type() != cty.Bool {
+				errs.Append(hclAttrErr(attr,
+					"field stack.disabled must be a bool but is %q",
+					attrVal.Type().FriendlyName()),
+				)
+				continue
+			}
+			stack.Disabled = attrVal.True()
+
 		default:
 			errs.Append(errors.E(
 				attr.NameRange, "unrecognized attribute stack.%q", attr.Name,
@@ -729,6 +867,66 @@ func (p *TerramateParser) parseStack(stackblock *ast.Block) (*Stack, error) {
 	return stack, nil
 }
 
+var stackVariantNameRegex = regexp.MustCompile("^[a-zA-Z0-9_-]{1,64}$")
+
+func parseStackVariant(block *ast.Block) (StackVariant, error) {
+	errs := errors.L()
+	if len(block.Labels) != 1 {
+		return StackVariant{}, errors.E(block.LabelRanges(),
+			"stack.variant must have a single label but has %d", len(block.Labels))
+	}
+
+	variant := StackVariant{
+		Name: block.Labels[0],
+	}
+	if !stackVariantNameRegex.MatchString(variant.Name) {
+		errs.Append(errors.E(block.LabelRanges(),
+			"stack.variant name %q doesn't match %q", variant.Name, stackVariantNameRegex))
+	}
+
+	for _, attr := range block.Attributes.SortedList() {
+		errs.Append(attrErr(attr, "unrecognized attribute stack.variant.%s", attr.Name))
+	}
+
+	var foundGlobals, foundEnv bool
+	for _, sub := range block.Blocks {
+		var found *bool
+		var target *ast.Attributes
+		switch sub.Type {
+		case "globals":
+			found, target = &foundGlobals, &variant.Globals
+		case "env":
+			found, target = &foundEnv, &variant.Env
+		default:
+			errs.Append(errors.E(sub.TypeRange,
+				"unrecognized block stack.variant.%s", sub.Type))
+			continue
+		}
+
+		if *found {
+			errs.Append(errors.E(sub.TypeRange,
+				"duplicated stack.variant.%s block", sub.Type))
+			continue
+		}
+		*found = true
+
+		if len(sub.Labels) > 0 {
+			errs.Append(errors.E(sub.LabelRanges(),
+				"stack.variant.%s block must have no labels", sub.Type))
+		}
+		for _, subsub := range sub.Blocks {
+			errs.Append(errors.E(subsub.TypeRange,
+				"unrecognized block stack.variant.%s.%s", sub.Type, subsub.Type))
+		}
+		*target = sub.Attributes
+	}
+
+	if err := errs.AsError(); err != nil {
+		return StackVariant{}, err
+	}
+	return variant, nil
+}
+
 // NewConfig creates a new HCL config with dir as config directory path.
 func NewConfig(dir string) (Config, error) {
 	st, err := os.Stat(dir)
@@ -754,6 +952,38 @@ func (c Config) HasRunEnv() bool {
 		c.Terramate.Config.Run.Env != nil
 }
 
+// HasStackRunEnv returns true if the config has a run.env block defined.
+func (c Config) HasStackRunEnv() bool {
+	return c.Run != nil && c.Run.Env != nil
+}
+
+// HasRunEnvFiles returns true if the config has the
+// terramate.config.run.env_files attribute defined.
+func (c Config) HasRunEnvFiles() bool {
+	return c.Terramate != nil &&
+		c.Terramate.Config != nil &&
+		c.Terramate.Config.Run != nil &&
+		c.Terramate.Config.Run.EnvFiles != nil
+}
+
+// HasRunInheritEnv returns true if the config has a
+// terramate.config.run.inherit_env block defined.
+func (c Config) HasRunInheritEnv() bool {
+	return c.Terramate != nil &&
+		c.Terramate.Config != nil &&
+		c.Terramate.Config.Run != nil &&
+		c.Terramate.Config.Run.InheritEnv != nil
+}
+
+// HasRunHooks returns true if the config has a terramate.config.run.before or
+// terramate.config.run.after block defined
+func (c Config) HasRunHooks() bool {
+	return c.Terramate != nil &&
+		c.Terramate.Config != nil &&
+		c.Terramate.Config.Run != nil &&
+		(c.Terramate.Config.Run.Before != nil || c.Terramate.Config.Run.After != nil)
+}
+
 // Experiments returns the config enabled experiments, if any.
 func (c Config) Experiments() []string {
 	if c.Terramate != nil &&
@@ -770,7 +1000,7 @@ func (c Config) AbsDir() string { return c.absdir }
 func (c Config) IsEmpty() bool {
 	return c.Stack == nil && c.Terramate == nil &&
 		c.Vendor == nil && len(c.Asserts) == 0 &&
-		len(c.Globals) == 0 &&
+		len(c.Globals) == 0 && c.Run == nil &&
 		len(c.Generate.Files) == 0 && len(c.Generate.HCLs) == 0
 }
 
@@ -1437,7 +1667,7 @@ func (p *TerramateParser) parseRootConfig(cfg *RootConfig, block *ast.MergedBloc
 		p.Experiments = cfg.Experiments
 	}
 
-	errs.AppendWrap(ErrTerramateSchema, block.ValidateSubBlocks("git", "run", "cloud"))
+	errs.AppendWrap(ErrTerramateSchema, block.ValidateSubBlocks("git", "run", "cloud", "change_detection"))
 
 	gitBlock, ok := block.Blocks[ast.NewEmptyLabelBlockType("git")]
 	if ok {
@@ -1462,12 +1692,26 @@ func (p *TerramateParser) parseRootConfig(cfg *RootConfig, block *ast.MergedBloc
 		errs.Append(parseCloudConfig(cfg.Cloud, cloudBlock))
 	}
 
+	changeDetectionBlock, ok := block.Blocks[ast.NewEmptyLabelBlockType("change_detection")]
+	if ok {
+		cfg.ChangeDetection = &ChangeDetectionConfig{}
+
+		errs.Append(parseChangeDetectionConfig(cfg.ChangeDetection, changeDetectionBlock))
+	}
+
 	return errs.AsError()
 }
 
 func parseRunConfig(runCfg *RunConfig, runBlock *ast.MergedBlock) error {
 	errs := errors.L()
 	for _, attr := range runBlock.Attributes.SortedList() {
+		if attr.Name == "env_files" {
+			// evaluated for each stack, with globals and metadata.
+			attr := attr
+			runCfg.EnvFiles = &attr
+			continue
+		}
+
 		value, diags := attr.Expr.Value(nil)
 		if diags.HasErrors() {
 			errs.Append(errors.E(diags,
@@ -1488,13 +1732,36 @@ func parseRunConfig(runCfg *RunConfig, runBlock *ast.MergedBlock) error {
 				continue
 			}
 			runCfg.CheckGenCode = value.True()
+		case "timeout":
+			timeout, err := parseTimeout(value)
+			if err != nil {
+				errs.Append(attrErr(attr, "terramate.config.run.timeout %s", err))
+				continue
+			}
+			runCfg.Timeout = timeout
+		case "sensitive_env":
+			errs.Append(assignSet(attr.Attribute, &runCfg.SensitiveEnv, value))
+		case "sensitive_globals":
+			errs.Append(assignSet(attr.Attribute, &runCfg.SensitiveGlobals, value))
+		case "mask_patterns":
+			if err := assignSet(attr.Attribute, &runCfg.MaskPatterns, value); err != nil {
+				errs.Append(err)
+				continue
+			}
+			for _, pattern := range runCfg.MaskPatterns {
+				if _, err := regexp.Compile(pattern); err != nil {
+					errs.Append(attrErr(attr,
+						"terramate.config.run.mask_patterns has invalid regex %q: %v",
+						pattern, err))
+				}
+			}
 		default:
 			errs.Append(errors.E("unrecognized attribute terramate.config.run.env.%s",
 				attr.Name))
 		}
 	}
 
-	errs.AppendWrap(ErrTerramateSchema, runBlock.ValidateSubBlocks("env"))
+	errs.AppendWrap(ErrTerramateSchema, runBlock.ValidateSubBlocks("env", "inherit_env", "before", "after"))
 
 	block, ok := runBlock.Blocks[ast.NewEmptyLabelBlockType("env")]
 	if ok {
@@ -1502,6 +1769,124 @@ func parseRunConfig(runCfg *RunConfig, runBlock *ast.MergedBlock) error {
 		errs.Append(parseRunEnv(runCfg.Env, block))
 	}
 
+	block, ok = runBlock.Blocks[ast.NewEmptyLabelBlockType("inherit_env")]
+	if ok {
+		runCfg.InheritEnv = &RunInheritEnv{}
+		errs.Append(parseRunInheritEnv(runCfg.InheritEnv, block))
+	}
+
+	block, ok = runBlock.Blocks[ast.NewEmptyLabelBlockType("before")]
+	if ok {
+		runCfg.Before = &RunHook{}
+		errs.Append(parseRunHook(runCfg.Before, block))
+	}
+
+	block, ok = runBlock.Blocks[ast.NewEmptyLabelBlockType("after")]
+	if ok {
+		runCfg.After = &RunHook{}
+		errs.Append(parseRunHook(runCfg.After, block))
+	}
+
+	return errs.AsError()
+}
+
+func parseRunInheritEnv(inheritEnv *RunInheritEnv, block *ast.MergedBlock) error {
+	errs := errors.L()
+	errs.AppendWrap(ErrTerramateSchema, block.ValidateSubBlocks())
+
+	for _, attr := range block.Attributes.SortedList() {
+		value, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			errs.Append(errors.E(diags,
+				"failed to evaluate terramate.config.run.inherit_env.%s attribute", attr.Name,
+			))
+			continue
+		}
+
+		var patterns *[]string
+		switch attr.Name {
+		case "allow":
+			patterns = &inheritEnv.Allow
+		case "deny":
+			patterns = &inheritEnv.Deny
+		default:
+			errs.Append(attrErr(attr,
+				"unrecognized attribute terramate.config.run.inherit_env.%s", attr.Name,
+			))
+			continue
+		}
+
+		if err := assignSet(attr.Attribute, patterns, value); err != nil {
+			errs.Append(err)
+			continue
+		}
+		if *patterns == nil {
+			// an empty list must be kept distinct from an undefined one.
+			*patterns = []string{}
+		}
+		for _, pattern := range *patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				errs.Append(attrErr(attr,
+					"terramate.config.run.inherit_env.%s has invalid glob pattern %q",
+					attr.Name, pattern))
+			}
+		}
+	}
+	return errs.AsError()
+}
+
+func parseRunHook(hook *RunHook, hookBlock *ast.MergedBlock) error {
+	errs := errors.L()
+	errs.AppendWrap(ErrTerramateSchema, hookBlock.ValidateSubBlocks())
+
+	for _, attr := range hookBlock.Attributes.SortedList() {
+		switch attr.Name {
+		case "command":
+			hook.Command = NewScriptCommand(attr)
+		default:
+			errs.Append(attrErr(attr,
+				"unrecognized attribute terramate.config.run.%s.%s",
+				hookBlock.Type, attr.Name,
+			))
+		}
+	}
+
+	if hook.Command == nil {
+		errs.Append(errors.E(ErrTerramateSchema,
+			hookBlock.RawOrigins[0].Range,
+			"terramate.config.run.%s.command is required", hookBlock.Type,
+		))
+	}
+
+	return errs.AsError()
+}
+
+func parseRunBlock(run *Run, runBlock *ast.MergedBlock) error {
+	errs := errors.L()
+	for _, attr := range runBlock.Attributes.SortedList() {
+		switch attr.Name {
+		case "condition":
+			attr := attr
+			run.Condition = &attr
+		case "sensitive_env":
+			value, diags := attr.Expr.Value(nil)
+			if diags.HasErrors() {
+				errs.Append(errors.E(diags, "failed to evaluate run.%s attribute", attr.Name))
+				continue
+			}
+			errs.Append(assignSet(attr.Attribute, &run.SensitiveEnv, value))
+		default:
+			errs.Append(attrErr(attr, "unrecognized attribute run.%s", attr.Name))
+		}
+	}
+
+	errs.AppendWrap(ErrTerramateSchema, runBlock.ValidateSubBlocks("env"))
+
+	block, ok := runBlock.Blocks[ast.NewEmptyLabelBlockType("env")]
+	if ok {
+		run.Env = &RunEnv{}
+		errs.Append(parseRunEnv(run.Env, block))
+	}
 	return errs.AsError()
 }
 
@@ -1641,6 +2026,51 @@ func parseCloudConfig(cloud *CloudConfig, cloudBlock *ast.MergedBlock) error {
 	return errs.AsError()
 }
 
+func parseChangeDetectionConfig(cfg *ChangeDetectionConfig, block *ast.MergedBlock) error {
+	errs := errors.L()
+
+	errs.AppendWrap(ErrTerramateSchema, block.ValidateSubBlocks())
+
+	for _, attr := range block.Attributes.SortedList() {
+		value, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			errs.Append(errors.E(diags,
+				"failed to evaluate terramate.config.change_detection.%s attribute", attr.Name,
+			))
+			continue
+		}
+
+		switch attr.Name {
+		case "file_reads":
+			if value.Type() != cty.Bool {
+				errs.Append(attrErr(attr,
+					"terramate.config.change_detection.file_reads is not a boolean but %q",
+					value.Type().FriendlyName(),
+				))
+				continue
+			}
+			cfg.FileReads = value.True()
+		case "evaluation":
+			if value.Type() != cty.Bool {
+				errs.Append(attrErr(attr,
+					"terramate.config.change_detection.evaluation is not a boolean but %q",
+					value.Type().FriendlyName(),
+				))
+				continue
+			}
+			cfg.Evaluation = value.True()
+
+		default:
+			errs.Append(errors.E(
+				attr.NameRange,
+				"unrecognized attribute terramate.config.change_detection.%s",
+				attr.Name,
+			))
+		}
+	}
+	return errs.AsError()
+}
+
 func (p *TerramateParser) parseTerramateSchema() (Config, error) {
 	logger := log.With().
 		Str("action", "parseTerramateSchema()").
@@ -1676,6 +2106,12 @@ func (p *TerramateParser) parseTerramateSchema() (Config, error) {
 		}
 	}
 
+	runBlock, ok := rawconfig.MergedBlocks["run"]
+	if ok {
+		config.Run = &Run{}
+		errs.Append(parseRunBlock(config.Run, runBlock))
+	}
+
 	var foundstack, foundVendor bool
 	var stackblock, vendorBlock *ast.Block
 
@@ -1963,6 +2399,22 @@ func (p *TerramateParser) parseTerramateBlock(block *ast.MergedBlock) (Terramate
 	return tm, nil
 }
 
+// parseTimeout parses a duration string, like "10m" or "1h30m".
+// The returned error is meant to be prefixed with the attribute name.
+func parseTimeout(val cty.Value) (time.Duration, error) {
+	if val.Type() != cty.String {
+		return 0, errors.E("must be a string but given %q", val.Type().FriendlyName())
+	}
+	timeout, err := time.ParseDuration(val.AsString())
+	if err != nil {
+		return 0, errors.E(err, "must be a valid duration (e.g. \"30m\")")
+	}
+	if timeout <= 0 {
+		return 0, errors.E("must be a positive duration but given %q", val.AsString())
+	}
+	return timeout, nil
+}
+
 func hclAttrErr(attr *hcl.Attribute, msg string, args ...interface{}) error {
 	return errors.E(ErrTerramateSchema, attr.Expr.Range(), fmt.Sprintf(msg, args...))
 }
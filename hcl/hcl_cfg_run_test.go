@@ -7,7 +7,9 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	hhcl "github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclparse"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/madlambda/spells/assert"
@@ -62,6 +64,16 @@ func TestHCLParserConfigRun(t *testing.T) {
 		}
 	}
 
+	hookCommand := func(expr string) *hcl.Command {
+		cmd := hcl.Command(ast.Attribute{
+			Attribute: &hhcl.Attribute{
+				Name: "command",
+				Expr: test.NewExpr(t, expr),
+			},
+		})
+		return &cmd
+	}
+
 	for _, tc := range []testcase{
 		{
 			name: "empty run",
@@ -116,6 +128,377 @@ func TestHCLParserConfigRun(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "run with timeout",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `terramate {
+					  config {
+					    run {
+					      timeout = "30s"
+					    }
+					  }
+					}`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Terramate: &hcl.Terramate{
+						Config: &hcl.RootConfig{
+							Run: &hcl.RunConfig{
+								CheckGenCode: true,
+								Timeout:      30 * time.Second,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "invalid timeout on run",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      timeout = "-1m"
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "run with masking configuration",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `terramate {
+					  config {
+					    run {
+					      sensitive_env     = ["TOKEN", "PASSWORD"]
+					      sensitive_globals = ["db.password"]
+					      mask_patterns     = ["ghp_[a-zA-Z0-9]+"]
+					    }
+					  }
+					}`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Terramate: &hcl.Terramate{
+						Config: &hcl.RootConfig{
+							Run: &hcl.RunConfig{
+								CheckGenCode:     true,
+								SensitiveEnv:     []string{"TOKEN", "PASSWORD"},
+								SensitiveGlobals: []string{"db.password"},
+								MaskPatterns:     []string{"ghp_[a-zA-Z0-9]+"},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "invalid mask pattern on run",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `terramate {
+					  config {
+					    run {
+					      mask_patterns = ["secret-("]
+					    }
+					  }
+					}`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "invalid sensitive_env type on run",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `terramate {
+					  config {
+					    run {
+					      sensitive_env = "TOKEN"
+					    }
+					  }
+					}`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "run with inherit_env",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `terramate {
+					  config {
+					    run {
+					      inherit_env {
+					        allow = ["PATH", "AWS_*"]
+					        deny  = ["AWS_SECRET_*"]
+					      }
+					    }
+					  }
+					}`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Terramate: &hcl.Terramate{
+						Config: &hcl.RootConfig{
+							Run: &hcl.RunConfig{
+								CheckGenCode: true,
+								InheritEnv: &hcl.RunInheritEnv{
+									Allow: []string{"PATH", "AWS_*"},
+									Deny:  []string{"AWS_SECRET_*"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "run with empty inherit_env allow list",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `terramate {
+					  config {
+					    run {
+					      inherit_env {
+					        allow = []
+					      }
+					    }
+					  }
+					}`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Terramate: &hcl.Terramate{
+						Config: &hcl.RootConfig{
+							Run: &hcl.RunConfig{
+								CheckGenCode: true,
+								InheritEnv: &hcl.RunInheritEnv{
+									Allow: []string{},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "invalid inherit_env pattern",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `terramate {
+					  config {
+					    run {
+					      inherit_env {
+					        deny = ["AWS_[*"]
+					      }
+					    }
+					  }
+					}`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "unrecognized inherit_env attribute",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `terramate {
+					  config {
+					    run {
+					      inherit_env {
+					        only = ["PATH"]
+					      }
+					    }
+					  }
+					}`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "run with env_files",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `terramate {
+					  config {
+					    run {
+					      env_files = [".env", ".env.${global.environment}"]
+					    }
+					  }
+					}`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Terramate: &hcl.Terramate{
+						Config: &hcl.RootConfig{
+							Run: &hcl.RunConfig{
+								CheckGenCode: true,
+								EnvFiles: &ast.Attribute{
+									Attribute: &hhcl.Attribute{
+										Name: "env_files",
+										Expr: test.NewExpr(t, `[".env", ".env.${global.environment}"]`),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "run with before and after hooks",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `terramate {
+					  config {
+					    run {
+					      before {
+					        command = ["echo", global.msg]
+					      }
+					      after {
+					        command = ["echo", terramate.stack.name]
+					      }
+					    }
+					  }
+					}`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Terramate: &hcl.Terramate{
+						Config: &hcl.RootConfig{
+							Run: &hcl.RunConfig{
+								CheckGenCode: true,
+								Before: &hcl.RunHook{
+									Command: hookCommand(`["echo", global.msg]`),
+								},
+								After: &hcl.RunHook{
+									Command: hookCommand(`["echo", terramate.stack.name]`),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "run hook without command fails",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      before {
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "unrecognized attribute on run hook",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      after {
+						        command = ["echo"]
+						        something = "bleh"
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "unrecognized block on run hook",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      after {
+						        command = ["echo"]
+						        something {
+						        }
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
 		{
 			name: "unrecognized attribute on run",
 			input: []cfgfile{
@@ -0,0 +1,279 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package hcl_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	hhcl "github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/madlambda/spells/assert"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/hcl"
+	"github.com/terramate-io/terramate/hcl/ast"
+	"github.com/terramate-io/terramate/test"
+)
+
+func TestHCLParserRunBlock(t *testing.T) {
+	runEnvCfg := func(rawattributes string) hcl.Config {
+		// see TestHCLParserConfigRun for why the attributes are parsed
+		// from a file.
+		rootdir := test.TempDir(t)
+		filepath := filepath.Join(rootdir, "test_file.hcl")
+		assert.NoError(t, os.WriteFile(filepath, []byte(rawattributes), 0700))
+
+		parser := hclparse.NewParser()
+		res, diags := parser.ParseHCLFile(filepath)
+		if diags.HasErrors() {
+			t.Fatalf("test case provided invalid hcl, error: %v hcl:\n%s", diags, rawattributes)
+		}
+
+		body := res.Body.(*hclsyntax.Body)
+		attrs := make(ast.Attributes)
+
+		for name, attr := range body.Attributes {
+			attrs[name] = ast.NewAttribute(rootdir, attr.AsHCLAttribute())
+		}
+
+		return hcl.Config{
+			Run: &hcl.Run{
+				Env: &hcl.RunEnv{
+					Attributes: attrs,
+				},
+			},
+		}
+	}
+
+	for _, tc := range []testcase{
+		{
+			name: "empty run",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body:     `run {}`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Run: &hcl.Run{},
+				},
+			},
+		},
+		{
+			name: "run with condition",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						run {
+						  condition = global.enabled
+						}
+					`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Run: &hcl.Run{
+						Condition: &ast.Attribute{
+							Attribute: &hhcl.Attribute{
+								Name: "condition",
+								Expr: test.NewExpr(t, "global.enabled"),
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "run with sensitive_env",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						run {
+						  sensitive_env = ["TOKEN"]
+						}
+					`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Run: &hcl.Run{
+						SensitiveEnv: []string{"TOKEN"},
+					},
+				},
+			},
+		},
+		{
+			name: "run with invalid sensitive_env",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						run {
+						  sensitive_env = [1]
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "run.env at the root",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						run {
+						  env {
+						    AWS_PROFILE = "prod"
+						    TF_WORKSPACE = global.workspace
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				config: runEnvCfg(`
+					AWS_PROFILE = "prod"
+					TF_WORKSPACE = global.workspace
+				`),
+			},
+		},
+		{
+			name:     "run.env inside a stack",
+			parsedir: "stack",
+			input: []cfgfile{
+				{
+					filename: "stack/cfg.tm",
+					body: `
+						stack {}
+
+						run {
+						  env {
+						    AWS_PROFILE = "prod"
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				config: func() hcl.Config {
+					cfg := runEnvCfg(`
+						AWS_PROFILE = "prod"
+					`)
+					cfg.Stack = &hcl.Stack{}
+					return cfg
+				}(),
+			},
+		},
+		{
+			name: "run.env blocks in multiple files are merged",
+			input: []cfgfile{
+				{
+					filename: "env1.tm",
+					body: `
+						run {
+						  env {
+						    AWS_PROFILE = "prod"
+						  }
+						}
+					`,
+				},
+				{
+					filename: "env2.tm",
+					body: `
+						run {
+						  env {
+						    TF_WORKSPACE = "default"
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				config: runEnvCfg(`
+					AWS_PROFILE = "prod"
+					TF_WORKSPACE = "default"
+				`),
+			},
+		},
+		{
+			name: "redefined env var on the same directory fails",
+			input: []cfgfile{
+				{
+					filename: "env1.tm",
+					body: `
+						run {
+						  env {
+						    AWS_PROFILE = "prod"
+						  }
+						}
+					`,
+				},
+				{
+					filename: "env2.tm",
+					body: `
+						run {
+						  env {
+						    AWS_PROFILE = "dev"
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "unrecognized attribute on run",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						run {
+						  something = "bleh"
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "unrecognized block on run",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						run {
+						  something {
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+	} {
+		testParser(t, tc)
+	}
+}
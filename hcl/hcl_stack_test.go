@@ -4,11 +4,19 @@
 package hcl_test
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/madlambda/spells/assert"
 	"github.com/terramate-io/terramate/errors"
 	"github.com/terramate-io/terramate/hcl"
+	"github.com/terramate-io/terramate/hcl/ast"
 	"github.com/terramate-io/terramate/hcl/eval"
+	"github.com/terramate-io/terramate/test"
 	. "github.com/terramate-io/terramate/test/hclutils"
 )
 
@@ -173,6 +181,237 @@ func TestHCLParserStack(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "stack with timeout",
+			input: []cfgfile{
+				{
+					filename: "stack.tm",
+					body: `
+						stack {
+							timeout = "1h30m"
+						}
+					`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Stack: &hcl.Stack{
+						Timeout: 90 * time.Minute,
+					},
+				},
+			},
+		},
+		{
+			name: "disabled stack",
+			input: []cfgfile{
+				{
+					filename: "stack.tm",
+					body: `
+						stack {
+							disabled = true
+						}
+					`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Stack: &hcl.Stack{
+						Disabled: true,
+					},
+				},
+			},
+		},
+		{
+			name: "disabled is not a bool - fails",
+			input: []cfgfile{
+				{
+					filename: "stack.tm",
+					body: `
+						stack {
+							disabled = "true"
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema,
+						Mkrange("stack.tm", Start(3, 19, 33), End(3, 25, 39)),
+					),
+				},
+			},
+		},
+		{
+			name: "stack with variants",
+			input: []cfgfile{
+				{
+					filename: "stack.tm",
+					body: `
+						stack {
+							variant "us-east-1" {
+								globals {
+									region = "us-east-1"
+								}
+								env {
+									AWS_REGION = global.region
+								}
+							}
+							variant "eu_west_1" {}
+						}
+					`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Stack: &hcl.Stack{
+						Variants: []hcl.StackVariant{
+							{
+								Name:    "us-east-1",
+								Globals: parseAttributes(t, `region = "us-east-1"`),
+								Env:     parseAttributes(t, `AWS_REGION = global.region`),
+							},
+							{
+								Name: "eu_west_1",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "duplicated variant - fails",
+			input: []cfgfile{
+				{
+					filename: "stack.tm",
+					body: `
+						stack {
+							variant "a" {}
+							variant "a" {}
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema,
+						Mkrange("stack.tm", Start(4, 16, 52), End(4, 19, 55)),
+					),
+				},
+			},
+		},
+		{
+			name: "variant with invalid name - fails",
+			input: []cfgfile{
+				{
+					filename: "stack.tm",
+					body: `
+						stack {
+							variant "a b" {}
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema,
+						Mkrange("stack.tm", Start(3, 16, 30), End(3, 21, 35)),
+					),
+				},
+			},
+		},
+		{
+			name: "variant without label - fails",
+			input: []cfgfile{
+				{
+					filename: "stack.tm",
+					body: `
+						stack {
+							variant {}
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "variant with unrecognized attributes and blocks - fails",
+			input: []cfgfile{
+				{
+					filename: "stack.tm",
+					body: `
+						stack {
+							variant "a" {
+								name = "a"
+								generate_hcl "file" {}
+								env {
+									A = "a"
+								}
+								env {
+									B = "b"
+								}
+							}
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema,
+						Mkrange("stack.tm", Start(4, 16, 51), End(4, 19, 54)),
+					),
+					errors.E(hcl.ErrTerramateSchema,
+						Mkrange("stack.tm", Start(5, 9, 63), End(5, 21, 75)),
+					),
+					errors.E(hcl.ErrTerramateSchema,
+						Mkrange("stack.tm", Start(9, 9, 135), End(9, 12, 138)),
+					),
+				},
+			},
+		},
+		{
+			name: "timeout is not a string - fails",
+			input: []cfgfile{
+				{
+					filename: "stack.tm",
+					body: `
+						stack {
+							timeout = 10
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema,
+						Mkrange("stack.tm", Start(3, 18, 32), End(3, 20, 34)),
+					),
+				},
+			},
+		},
+		{
+			name: "timeout is not a valid duration - fails",
+			input: []cfgfile{
+				{
+					filename: "stack.tm",
+					body: `
+						stack {
+							timeout = "10 minutes"
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema,
+						Mkrange("stack.tm", Start(3, 18, 32), End(3, 30, 44)),
+					),
+				},
+			},
+		},
 		{
 			name: "name is not a string - fails",
 			input: []cfgfile{
@@ -585,3 +824,26 @@ func TestHCLParserStack(t *testing.T) {
 		testParser(t, tc)
 	}
 }
+
+// parseAttributes parses the given attributes definition in the same way as
+// the parser does.
+func parseAttributes(t *testing.T, rawattrs string) ast.Attributes {
+	t.Helper()
+
+	rootdir := test.TempDir(t)
+	filepath := filepath.Join(rootdir, "attrs.hcl")
+	assert.NoError(t, os.WriteFile(filepath, []byte(rawattrs), 0700))
+
+	parser := hclparse.NewParser()
+	res, diags := parser.ParseHCLFile(filepath)
+	if diags.HasErrors() {
+		t.Fatalf("invalid attributes definition %q: %v", rawattrs, diags)
+	}
+
+	body := res.Body.(*hclsyntax.Body)
+	attrs := make(ast.Attributes)
+	for name, attr := range body.Attributes {
+		attrs[name] = ast.NewAttribute(rootdir, attr.AsHCLAttribute())
+	}
+	return attrs
+}
@@ -692,6 +692,59 @@ func TestHCLParserRootConfig(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "config.change_detection fields",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+							config {
+								change_detection {
+									file_reads = true
+									evaluation = true
+								}
+							}
+						}
+					`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Terramate: &hcl.Terramate{
+						Config: &hcl.RootConfig{
+							ChangeDetection: &hcl.ChangeDetectionConfig{
+								FileReads:  true,
+								Evaluation: true,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "config.change_detection fields must be boolean",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+							config {
+								change_detection {
+									file_reads = "yes"
+								}
+							}
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema,
+						Mkrange("cfg.tm", Start(5, 23, 84), End(5, 28, 89))),
+				},
+			},
+		},
 		{
 			name: "empty config.cloud block",
 			input: []cfgfile{
@@ -90,6 +90,10 @@ func PrintConfig(w io.Writer, cfg Config) error {
 		if stack.ID != "" {
 			stackBody.SetAttributeValue("id", cty.StringVal(stack.ID))
 		}
+
+		if stack.Timeout > 0 {
+			stackBody.SetAttributeValue("timeout", cty.StringVal(stack.Timeout.String()))
+		}
 	}
 
 	logger.Debug().Msg("write to output")
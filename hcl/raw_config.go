@@ -40,6 +40,7 @@ func NewTopLevelRawConfig() RawConfig {
 	return NewCustomRawConfig(map[string]mergeHandler{
 		"terramate":     (*RawConfig).mergeBlock,
 		"globals":       (*RawConfig).mergeLabeledBlock,
+		"run":           (*RawConfig).mergeBlock,
 		"script":        (*RawConfig).addBlock,
 		"stack":         (*RawConfig).addBlock,
 		"vendor":        (*RawConfig).addBlock,
@@ -0,0 +1,75 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package run
+
+import (
+	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const (
+	// ErrConditionEval indicates the failure to evaluate the run.condition
+	// attribute.
+	ErrConditionEval errors.Kind = "evaluating run.condition attribute"
+
+	// ErrInvalidConditionType indicates the run.condition attribute has an
+	// invalid type.
+	ErrInvalidConditionType errors.Kind = "invalid run.condition type"
+)
+
+// EvalCondition evaluates the run.condition attributes which apply to the given
+// stack and tells if the stack must be executed.
+// The conditions defined in the stack directory and in all its parent
+// directories must be true for the stack to be executed.
+func EvalCondition(root *config.Root, st *config.Stack) (bool, error) {
+	tree, ok := root.Lookup(st.Dir)
+	if !ok {
+		return true, nil
+	}
+
+	var conditions []*config.Tree
+	for node := tree; node != nil; node = node.Parent {
+		if node.Node.Run != nil && node.Node.Run.Condition != nil {
+			conditions = append(conditions, node)
+		}
+	}
+
+	if len(conditions) == 0 {
+		return true, nil
+	}
+
+	evalctx, err := newStackEvalContext(root, st)
+	if err != nil {
+		return false, errors.E(ErrConditionEval, err)
+	}
+
+	// parent conditions are evaluated first.
+	for i := len(conditions) - 1; i >= 0; i-- {
+		attr := conditions[i].Node.Run.Condition
+		val, err := evalctx.Eval(attr.Expr)
+		if err != nil {
+			return false, errors.E(ErrConditionEval, err)
+		}
+
+		if val.Type() != cty.Bool {
+			return false, errors.E(
+				ErrInvalidConditionType,
+				attr.Range,
+				"condition has type %s but must be boolean",
+				val.Type().FriendlyName(),
+			)
+		}
+
+		if val.IsNull() {
+			return false, errors.E(ErrInvalidConditionType, attr.Range,
+				"condition must not be null")
+		}
+
+		if val.False() {
+			return false, nil
+		}
+	}
+	return true, nil
+}
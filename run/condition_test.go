@@ -0,0 +1,181 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package run_test
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/project"
+	"github.com/terramate-io/terramate/run"
+	"github.com/terramate-io/terramate/test"
+	errorstest "github.com/terramate-io/terramate/test/errors"
+	. "github.com/terramate-io/terramate/test/hclwrite/hclutils"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestEvalRunCondition(t *testing.T) {
+	t.Parallel()
+
+	type (
+		hclconfig struct {
+			path string
+			add  fmt.Stringer
+		}
+		result struct {
+			run bool
+			err error
+		}
+		testcase struct {
+			name    string
+			layout  []string
+			configs []hclconfig
+			want    map[string]result
+		}
+	)
+
+	for _, tc := range []testcase{
+		{
+			name: "no condition",
+			layout: []string{
+				"s:stack",
+			},
+			want: map[string]result{
+				"stack": {run: true},
+			},
+		},
+		{
+			name: "condition evaluated with globals and metadata",
+			layout: []string{
+				"s:stacks/stack-1",
+				"s:stacks/stack-2",
+				"s:stacks/stack-3",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					add: Run(
+						Expr("condition", `global.enabled && terramate.stack.name != "stack-3"`),
+					),
+				},
+				{
+					path: "/",
+					add: Globals(
+						Bool("enabled", true),
+					),
+				},
+				{
+					path: "/stacks/stack-2",
+					add: Globals(
+						Bool("enabled", false),
+					),
+				},
+			},
+			want: map[string]result{
+				"stacks/stack-1": {run: true},
+				"stacks/stack-2": {run: false},
+				"stacks/stack-3": {run: false},
+			},
+		},
+		{
+			name: "all conditions in the hierarchy must be true",
+			layout: []string{
+				"s:stacks/stack-1",
+				"s:stacks/stack-2",
+				"s:other",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					add: Run(
+						Expr("condition", "true"),
+					),
+				},
+				{
+					path: "/stacks",
+					add: Run(
+						Expr("condition", `terramate.stack.name == "stack-1"`),
+					),
+				},
+				{
+					path: "/stacks/stack-1",
+					add: Run(
+						Expr("condition", "false"),
+					),
+				},
+			},
+			want: map[string]result{
+				"stacks/stack-1": {run: false},
+				"stacks/stack-2": {run: false},
+				"other":          {run: true},
+			},
+		},
+		{
+			name: "fails evaluating undefined global",
+			layout: []string{
+				"s:stack",
+			},
+			configs: []hclconfig{
+				{
+					path: "/stack",
+					add: Run(
+						Expr("condition", "global.undefined"),
+					),
+				},
+			},
+			want: map[string]result{
+				"stack": {err: errors.E(run.ErrConditionEval)},
+			},
+		},
+		{
+			name: "fails if condition is not boolean",
+			layout: []string{
+				"s:stack",
+			},
+			configs: []hclconfig{
+				{
+					path: "/stack",
+					add: Run(
+						Str("condition", "true"),
+					),
+				},
+			},
+			want: map[string]result{
+				"stack": {err: errors.E(run.ErrInvalidConditionType)},
+			},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := sandbox.NoGit(t, true)
+			s.BuildTree(tc.layout)
+			for _, cfg := range tc.configs {
+				path := filepath.Join(s.RootDir(), cfg.path)
+				test.AppendFile(t, path, "run_condition_test_cfg.tm", cfg.add.String())
+			}
+
+			root, err := config.LoadRoot(s.RootDir())
+			assert.NoError(t, err)
+
+			for stackRelPath, want := range tc.want {
+				st, err := config.LoadStack(root, project.NewPath(path.Join("/", stackRelPath)))
+				assert.NoError(t, err)
+
+				got, err := run.EvalCondition(root, st)
+				errorstest.Assert(t, err, want.err)
+				if want.err == nil {
+					assert.IsTrue(t, got == want.run,
+						"stack %s: got run=%t but want %t", stackRelPath, got, want.run)
+				}
+			}
+		})
+	}
+}
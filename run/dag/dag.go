@@ -25,6 +25,10 @@ type (
 		values map[ID]interface{}
 		cycles map[ID]bool
 
+		// descendants is a map of ancestorID -> []descendantID, the inverse
+		// of dag, computed once when needed.
+		descendants map[ID][]ID
+
 		validated bool
 	}
 
@@ -74,6 +78,7 @@ func (d *DAG) AddNode(id ID, value interface{}, descendants, ancestors []ID) err
 	d.addAncestors(id, ancestors)
 	d.values[id] = value
 	d.validated = false
+	d.descendants = nil
 	return nil
 }
 
@@ -167,6 +172,50 @@ func (d *DAG) AncestorsOf(id ID) []ID {
 	return d.dag[id]
 }
 
+// TransitiveAncestorsOf returns the sorted list of all node ids reachable by
+// following the ancestors of the given id, recursively.
+func (d *DAG) TransitiveAncestorsOf(id ID) []ID {
+	visited := Visited{}
+	d.walkAncestors(id, visited)
+	return visited.sortedIds(id)
+}
+
+// TransitiveDescendantsOf returns the sorted list of all node ids which have
+// the given id as a direct or indirect ancestor.
+func (d *DAG) TransitiveDescendantsOf(id ID) []ID {
+	if d.descendants == nil {
+		d.descendants = make(map[ID][]ID)
+		for descendant, ancestors := range d.dag {
+			for _, ancestor := range ancestors {
+				d.descendants[ancestor] = append(d.descendants[ancestor], descendant)
+			}
+		}
+	}
+	visited := Visited{}
+	d.walkDescendants(id, visited)
+	return visited.sortedIds(id)
+}
+
+func (d *DAG) walkDescendants(id ID, visited Visited) {
+	for _, descendant := range d.descendants[id] {
+		if _, ok := visited[descendant]; ok {
+			continue
+		}
+		visited[descendant] = struct{}{}
+		d.walkDescendants(descendant, visited)
+	}
+}
+
+func (d *DAG) walkAncestors(id ID, visited Visited) {
+	for _, ancestor := range d.dag[id] {
+		if _, ok := visited[ancestor]; ok {
+			continue
+		}
+		visited[ancestor] = struct{}{}
+		d.walkAncestors(ancestor, visited)
+	}
+}
+
 // HasCycle returns true if the DAG has a cycle.
 func (d *DAG) HasCycle(id ID) bool {
 	if !d.validated {
@@ -220,6 +269,18 @@ func sortedIds(ids []ID) idList {
 	return idlist
 }
 
+func (v Visited) sortedIds(except ID) idList {
+	idlist := make(idList, 0, len(v))
+	for id := range v {
+		if id != except {
+			idlist = append(idlist, id)
+		}
+	}
+
+	sort.Sort(idlist)
+	return idlist
+}
+
 type idList []ID
 
 func (ids idList) contains(other ID) bool {
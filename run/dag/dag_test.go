@@ -299,6 +299,32 @@ func TestValidatedDAG(t *testing.T) {
 	}
 }
 
+func TestTransitiveRelations(t *testing.T) {
+	// A -> (B, E), B -> (C, D), D -> E
+	d := dag.New()
+	assert.NoError(t, d.AddNode("A", nil, nil, []dag.ID{"B", "E"}))
+	assert.NoError(t, d.AddNode("B", nil, nil, []dag.ID{"C", "D"}))
+	assert.NoError(t, d.AddNode("C", nil, nil, nil))
+	assert.NoError(t, d.AddNode("D", nil, nil, []dag.ID{"E"}))
+	assert.NoError(t, d.AddNode("E", nil, nil, nil))
+	assert.NoError(t, d.AddNode("F", nil, nil, nil))
+
+	_, err := d.Validate()
+	assert.NoError(t, err)
+
+	assertOrder(t, []dag.ID{"B", "C", "D", "E"}, d.TransitiveAncestorsOf("A"))
+	assertOrder(t, []dag.ID{"E"}, d.TransitiveAncestorsOf("D"))
+	assertOrder(t, []dag.ID{}, d.TransitiveAncestorsOf("F"))
+
+	assertOrder(t, []dag.ID{"A", "B", "D"}, d.TransitiveDescendantsOf("E"))
+	assertOrder(t, []dag.ID{"A", "B"}, d.TransitiveDescendantsOf("C"))
+	assertOrder(t, []dag.ID{}, d.TransitiveDescendantsOf("A"))
+
+	// the descendants are recomputed after adding nodes.
+	assert.NoError(t, d.AddNode("G", nil, nil, []dag.ID{"A"}))
+	assertOrder(t, []dag.ID{"A", "B", "D", "G"}, d.TransitiveDescendantsOf("E"))
+}
+
 func assertOrder(t *testing.T, want, got []dag.ID) {
 	t.Helper()
 	assert.EqualInts(t, len(want), len(got), "length mismatch")
@@ -0,0 +1,258 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package run
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/hcl/ast"
+	"github.com/terramate-io/terramate/hcl/eval"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const (
+	// ErrEnvFilesEval indicates that an error happened while evaluating the
+	// terramate.config.run.env_files attribute.
+	ErrEnvFilesEval errors.Kind = "evaluating terramate.config.run.env_files attribute"
+
+	// ErrInvalidEnvFile indicates a dotenv file could not be parsed.
+	ErrInvalidEnvFile errors.Kind = "invalid dotenv file"
+)
+
+// loadEnvFiles loads the variables of the dotenv files configured in the
+// terramate.config.run.env_files attribute for the given stack.
+// Relative file names are looked up in every directory from the project root
+// down to the stack directory, while names starting with "/" are relative to
+// the project root. Missing files are ignored. The variables of files in child
+// directories override the ones in parent directories and, in the same
+// directory, the files later in the list override the earlier ones.
+func loadEnvFiles(root *config.Root, st *config.Stack, evalctx *eval.Context) (map[string]string, error) {
+	cfg := root.Tree().Node
+	if !cfg.HasRunEnvFiles() {
+		return nil, nil
+	}
+
+	names, err := evalEnvFiles(evalctx, cfg.Terramate.Config.Run.EnvFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	var rootFiles []string
+	for _, name := range names {
+		if path.IsAbs(name) {
+			rootFiles = append(rootFiles, name)
+		} else {
+			files = append(files, name)
+		}
+	}
+
+	dirs := []string{"/"}
+	stackDir := st.Dir.String()
+	if stackDir != "/" {
+		parts := strings.Split(strings.TrimPrefix(stackDir, "/"), "/")
+		for i := range parts {
+			dirs = append(dirs, "/"+path.Join(parts[:i+1]...))
+		}
+	}
+
+	paths := rootFiles
+	for _, dir := range dirs {
+		for _, name := range files {
+			paths = append(paths, path.Join(dir, name))
+		}
+	}
+
+	values := map[string]string{}
+	for _, p := range paths {
+		hostpath := filepath.Join(root.HostDir(), filepath.FromSlash(p))
+		data, err := os.ReadFile(hostpath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, errors.E(ErrInvalidEnvFile, err, "reading %s", p)
+		}
+
+		log.Trace().
+			Stringer("stack", st).
+			Str("file", p).
+			Msg("loading dotenv file")
+
+		vars, err := ParseDotEnv(data)
+		if err != nil {
+			return nil, errors.E(err, "parsing %s", p)
+		}
+		for name, value := range vars {
+			values[name] = value
+		}
+	}
+	return values, nil
+}
+
+func evalEnvFiles(evalctx *eval.Context, attr *ast.Attribute) ([]string, error) {
+	val, err := evalctx.Eval(attr.Expr)
+	if err != nil {
+		return nil, errors.E(ErrEnvFilesEval, err)
+	}
+
+	if !val.Type().IsTupleType() && !val.Type().IsListType() {
+		return nil, errors.E(ErrEnvFilesEval, attr.Range,
+			"env_files must be a list(string) but has type %s", val.Type().FriendlyName())
+	}
+
+	var names []string
+	index := -1
+	it := val.ElementIterator()
+	for it.Next() {
+		index++
+		_, elem := it.Element()
+		if elem.Type() != cty.String || elem.IsNull() {
+			return nil, errors.E(ErrEnvFilesEval, attr.Range,
+				"env_files must be a list(string) but element %d has type %s",
+				index, elem.Type().FriendlyName())
+		}
+
+		name := elem.AsString()
+		if name == "" || isOutsideDir(name) {
+			return nil, errors.E(ErrEnvFilesEval, attr.Range,
+				"env_files element %d has invalid file name %q", index, name)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// isOutsideDir tells if the file name references a parent directory.
+func isOutsideDir(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseDotEnv parses the contents of a dotenv file.
+// Each line defines a variable as NAME=value, optionally prefixed by "export".
+// Blank lines and lines starting with # are ignored. Unquoted values are
+// trimmed and can have trailing comments, single quoted values are taken
+// literally and double quoted values support the \n, \t, \" and \\ escapes.
+// Variables are not expanded.
+func ParseDotEnv(data []byte) (map[string]string, error) {
+	vars := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	linenum := 0
+	for scanner.Scan() {
+		linenum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "export ")
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, errors.E(ErrInvalidEnvFile, "line %d: expected NAME=value", linenum)
+		}
+
+		name = strings.TrimSpace(name)
+		if !isValidEnvName(name) {
+			return nil, errors.E(ErrInvalidEnvFile, "line %d: invalid variable name %q", linenum, name)
+		}
+
+		value, err := parseDotEnvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, errors.E(ErrInvalidEnvFile, err, "line %d", linenum)
+		}
+		vars[name] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.E(ErrInvalidEnvFile, err)
+	}
+	return vars, nil
+}
+
+func parseDotEnvValue(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	switch quote := value[0]; quote {
+	case '\'':
+		end := strings.IndexByte(value[1:], '\'')
+		if end < 0 {
+			return "", errors.E("unterminated single quoted value")
+		}
+		if err := checkTrailing(value[end+2:]); err != nil {
+			return "", err
+		}
+		return value[1 : end+1], nil
+	case '"':
+		var b strings.Builder
+		for i := 1; i < len(value); i++ {
+			c := value[i]
+			switch {
+			case c == '"':
+				if err := checkTrailing(value[i+1:]); err != nil {
+					return "", err
+				}
+				return b.String(), nil
+			case c == '\\' && i+1 < len(value):
+				i++
+				switch value[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				case '"', '\\':
+					b.WriteByte(value[i])
+				default:
+					b.WriteByte('\\')
+					b.WriteByte(value[i])
+				}
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return "", errors.E("unterminated double quoted value")
+	}
+
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = value[:i]
+	}
+	return strings.TrimSpace(value), nil
+}
+
+// checkTrailing checks that only a comment follows a quoted value.
+func checkTrailing(rest string) error {
+	rest = strings.TrimSpace(rest)
+	if rest != "" && !strings.HasPrefix(rest, "#") {
+		return errors.E("unexpected %q after quoted value", rest)
+	}
+	return nil
+}
+
+func isValidEnvName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package run_test
+
+import (
+	"testing"
+
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/run"
+	"github.com/terramate-io/terramate/test"
+	errorstest "github.com/terramate-io/terramate/test/errors"
+)
+
+func TestParseDotEnv(t *testing.T) {
+	t.Parallel()
+
+	type testcase struct {
+		name  string
+		input string
+		want  map[string]string
+		err   error
+	}
+
+	for _, tc := range []testcase{
+		{
+			name:  "empty",
+			input: "",
+			want:  map[string]string{},
+		},
+		{
+			name: "comments, blank lines and export",
+			input: `
+# comment
+A=1
+
+export B=2
+  C = 3
+`,
+			want: map[string]string{"A": "1", "B": "2", "C": "3"},
+		},
+		{
+			name: "unquoted values",
+			input: `A=some value # comment
+B=value#not-a-comment
+C=
+D=a=b`,
+			want: map[string]string{
+				"A": "some value",
+				"B": "value#not-a-comment",
+				"C": "",
+				"D": "a=b",
+			},
+		},
+		{
+			name: "quoted values",
+			input: `A='single $HOME \n # not a comment'
+B="double\n\t\"quoted\" \\ \x" # comment
+C=""`,
+			want: map[string]string{
+				"A": `single $HOME \n # not a comment`,
+				"B": "double\n\t\"quoted\" \\ \\x",
+				"C": "",
+			},
+		},
+		{
+			name:  "fails on line without assignment",
+			input: "A=1\nINVALID\n",
+			err:   errors.E(run.ErrInvalidEnvFile),
+		},
+		{
+			name:  "fails on invalid name",
+			input: "1A=1\n",
+			err:   errors.E(run.ErrInvalidEnvFile),
+		},
+		{
+			name:  "fails on unterminated quote",
+			input: `A="value`,
+			err:   errors.E(run.ErrInvalidEnvFile),
+		},
+		{
+			name:  "fails on text after quoted value",
+			input: `A='value' other`,
+			err:   errors.E(run.ErrInvalidEnvFile),
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := run.ParseDotEnv([]byte(tc.input))
+			errorstest.Assert(t, err, tc.err)
+			if tc.err == nil {
+				test.AssertDiff(t, got, tc.want)
+			}
+		})
+	}
+}
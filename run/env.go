@@ -5,11 +5,14 @@ package run
 
 import (
 	"os"
+	"path"
+	"sort"
 	"strings"
 
 	"github.com/terramate-io/terramate/config"
 	"github.com/terramate-io/terramate/errors"
 	"github.com/terramate-io/terramate/globals"
+	"github.com/terramate-io/terramate/hcl/ast"
 	"github.com/terramate-io/terramate/hcl/eval"
 	"github.com/terramate-io/terramate/stdlib"
 
@@ -38,6 +41,13 @@ type EnvVars []string
 // LoadEnv will load environment variables to be exported when running any command
 // inside the given stack. The order of the env vars is guaranteed to be the same
 // and is ordered lexicographically.
+// The environment is defined by the terramate.config.run.env block plus the
+// run.env blocks of the stack directory and all its parent directories, with
+// child directories overriding the variables defined by their parents.
+// The variables of the dotenv files of terramate.config.run.env_files are
+// loaded first, so they are overridden by the env blocks.
+// If a variant of the stack is selected, the variables of its env block
+// override all the others.
 func LoadEnv(root *config.Root, st *config.Stack) (EnvVars, error) {
 	logger := log.With().
 		Str("action", "run.Env()").
@@ -45,49 +55,145 @@ func LoadEnv(root *config.Root, st *config.Stack) (EnvVars, error) {
 		Stringer("stack", st).
 		Logger()
 
-	if !root.Tree().Node.HasRunEnv() {
+	envs := loadEnvAttributes(root, st)
+	if len(envs) == 0 && !root.Tree().Node.HasRunEnvFiles() {
 		return nil, nil
 	}
 
-	globalsReport := globals.ForStack(root, st)
-	if err := globalsReport.AsError(); err != nil {
+	evalctx, err := newStackEvalContext(root, st)
+	if err != nil {
 		return nil, errors.E(ErrLoadingGlobals, err)
 	}
 
-	evalctx := eval.NewContext(stdlib.Functions(st.HostDir(root)))
-	runtime := root.Runtime()
-	runtime.Merge(st.RuntimeValues(root))
-	evalctx.SetNamespace("terramate", runtime)
-	evalctx.SetNamespace("global", globalsReport.Globals.AsValueMap())
-	evalctx.SetEnv(os.Environ())
+	values, err := loadEnvFiles(root, st, evalctx)
+	if err != nil {
+		return nil, err
+	}
+	if values == nil {
+		values = map[string]string{}
+	}
+
+	for _, attrs := range envs {
+		for _, attr := range attrs.SortedList() {
+			logger := logger.With().
+				Str("attribute", attr.Name).
+				Stringer("origin", attr.Range).
+				Logger()
+
+			val, err := evalctx.Eval(attr.Expr)
+			if err != nil {
+				return nil, errors.E(ErrEval, err)
+			}
+
+			if val.Type() != cty.String {
+				return nil, errors.E(
+					ErrInvalidEnvVarType,
+					attr.Range,
+					"attr has type %s but must be string",
+					val.Type().FriendlyName(),
+				)
+			}
+
+			if _, ok := values[attr.Name]; ok {
+				logger.Trace().Msg("overriding env var defined by parent directory")
+			}
+			values[attr.Name] = val.AsString()
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
 	envVars := EnvVars{}
+	for _, name := range names {
+		envVars = append(envVars, name+"="+values[name])
+	}
+	return envVars, nil
+}
 
-	attrs := root.Tree().Node.Terramate.Config.Run.Env.Attributes.SortedList()
+// InheritEnv returns the variables of the given host environment which are
+// inherited by the stack commands, as selected by the
+// terramate.config.run.inherit_env block. A variable is inherited if its name
+// matches any of the allow patterns, or no allow list is defined, and it
+// doesn't match any of the deny patterns.
+// If the block is not defined, the whole environment is inherited.
+func InheritEnv(root *config.Root, environ []string) []string {
+	cfg := root.Tree().Node
+	if !cfg.HasRunInheritEnv() {
+		return environ
+	}
 
-	for _, attr := range attrs {
-		logger = logger.With().
-			Str("attribute", attr.Name).
-			Logger()
+	inherit := cfg.Terramate.Config.Run.InheritEnv
+	var inherited []string
+	for _, env := range environ {
+		name, _, _ := strings.Cut(env, "=")
+		if inherit.Allow != nil && !matchAny(inherit.Allow, name) {
+			continue
+		}
+		if matchAny(inherit.Deny, name) {
+			continue
+		}
+		inherited = append(inherited, env)
+	}
+	return inherited
+}
 
-		val, err := evalctx.Eval(attr.Expr)
-		if err != nil {
-			return nil, errors.E(ErrEval, err)
+// matchAny tells if the name matches any of the glob patterns. The patterns
+// are validated when the configuration is parsed.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
 		}
+	}
+	return false
+}
 
-		if val.Type() != cty.String {
-			return nil, errors.E(
-				ErrInvalidEnvVarType,
-				attr.Range,
-				"attr has type %s but must be string",
-				val.Type().FriendlyName(),
-			)
+// loadEnvAttributes returns the env attributes which apply to the given stack,
+// ordered by precedence (lowest first).
+func loadEnvAttributes(root *config.Root, st *config.Stack) []ast.Attributes {
+	var envs []ast.Attributes
+	tree, ok := root.Lookup(st.Dir)
+	for ok && tree != nil {
+		if tree.Node.HasStackRunEnv() {
+			envs = append(envs, tree.Node.Run.Env.Attributes)
 		}
-		envVars = append(envVars, attr.Name+"="+val.AsString())
+		tree = tree.Parent
+	}
 
+	if root.Tree().Node.HasRunEnv() {
+		envs = append(envs, root.Tree().Node.Terramate.Config.Run.Env.Attributes)
 	}
 
-	return envVars, nil
+	for i, j := 0, len(envs)-1; i < j; i, j = i+1, j-1 {
+		envs[i], envs[j] = envs[j], envs[i]
+	}
+
+	if st.Variant != nil && len(st.Variant.Env) > 0 {
+		envs = append(envs, st.Variant.Env)
+	}
+	return envs
+}
+
+// newStackEvalContext creates an evaluation context for the run configuration
+// of the given stack, with the globals, the terramate metadata of the stack and
+// the host environment available.
+func newStackEvalContext(root *config.Root, st *config.Stack) (*eval.Context, error) {
+	globalsReport := globals.ForStack(root, st)
+	if err := globalsReport.AsError(); err != nil {
+		return nil, err
+	}
+
+	evalctx := eval.NewContext(stdlib.Functions(st.HostDir(root)))
+	runtime := root.Runtime()
+	runtime.Merge(st.RuntimeValues(root))
+	evalctx.SetNamespace("terramate", runtime)
+	evalctx.SetNamespace("global", globalsReport.Globals.AsValueMap())
+	evalctx.SetEnv(os.Environ())
+	return evalctx, nil
 }
 
 func getEnv(key string, environ []string) (string, bool) {
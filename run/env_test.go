@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"path"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/madlambda/spells/assert"
@@ -132,6 +133,254 @@ func TestLoadRunEnv(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "stacks with hierarchical run.env",
+			layout: []string{
+				"s:stacks/stack-1",
+				"s:stacks/stack-2",
+				"s:other",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					add: runEnvCfg(
+						Str("AWS_PROFILE", "default"),
+						Str("TF_WORKSPACE", "default"),
+					),
+				},
+				{
+					path: "/",
+					add: Run(Env(
+						Str("REGION", "us-east-1"),
+					)),
+				},
+				{
+					path: "/stacks",
+					add: Run(Env(
+						Str("AWS_PROFILE", "stacks"),
+						Str("REGION", "eu-west-1"),
+					)),
+				},
+				{
+					path: "/stacks/stack-1",
+					add: Run(Env(
+						Expr("TF_WORKSPACE", "terramate.stack.name"),
+						Expr("STACK_ENV", "global.env"),
+					)),
+				},
+				{
+					path: "/stacks/stack-1",
+					add: Globals(
+						Str("env", "stack-1 global"),
+					),
+				},
+			},
+			want: map[string]result{
+				"stacks/stack-1": {
+					env: run.EnvVars{
+						"AWS_PROFILE=stacks",
+						"REGION=eu-west-1",
+						"STACK_ENV=stack-1 global",
+						"TF_WORKSPACE=stack-1",
+					},
+				},
+				"stacks/stack-2": {
+					env: run.EnvVars{
+						"AWS_PROFILE=stacks",
+						"REGION=eu-west-1",
+						"TF_WORKSPACE=default",
+					},
+				},
+				"other": {
+					env: run.EnvVars{
+						"AWS_PROFILE=default",
+						"REGION=us-east-1",
+						"TF_WORKSPACE=default",
+					},
+				},
+			},
+		},
+		{
+			name: "stacks with env loaded from dotenv files",
+			layout: []string{
+				"s:stacks/stack-1",
+				"s:stacks/stack-2",
+				"f:.env:SHARED=root\nOVERRIDDEN=root\n",
+				"f:.env.prod:export PROD=\"yes\" # from .env.prod\n",
+				"f:.env.dev:DEV=yes\n",
+				"f:stacks/stack-1/.env:OVERRIDDEN=stack-1\nFROM_BLOCK=dotenv\n",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					add: Terramate(Config(Run(
+						Expr("env_files", `[".env", ".env.${global.environment}"]`),
+						Env(
+							Str("FROM_BLOCK", "block"),
+						),
+					))),
+				},
+				{
+					path: "/",
+					add: Globals(
+						Str("environment", "prod"),
+					),
+				},
+			},
+			want: map[string]result{
+				"stacks/stack-1": {
+					env: run.EnvVars{
+						"FROM_BLOCK=block",
+						"OVERRIDDEN=stack-1",
+						"PROD=yes",
+						"SHARED=root",
+					},
+				},
+				"stacks/stack-2": {
+					env: run.EnvVars{
+						"FROM_BLOCK=block",
+						"OVERRIDDEN=root",
+						"PROD=yes",
+						"SHARED=root",
+					},
+				},
+			},
+		},
+		{
+			name: "stack variants override globals and env",
+			layout: []string{
+				`f:stack/stack.tm:
+				  stack {
+				    variant "eu" {
+				      globals {
+				        region = "eu-west-1"
+				      }
+				      env {
+				        FROM_VARIANT = "eu"
+				        OVERRIDDEN   = "variant"
+				      }
+				    }
+				    variant "us" {}
+				  }`,
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					add: Globals(
+						Str("region", "us-east-1"),
+					),
+				},
+				{
+					path: "/",
+					add: runEnvCfg(
+						Expr("REGION", "global.region"),
+						Str("OVERRIDDEN", "config"),
+					),
+				},
+			},
+			want: map[string]result{
+				"stack": {
+					env: run.EnvVars{
+						"OVERRIDDEN=config",
+						"REGION=us-east-1",
+					},
+				},
+				"stack@eu": {
+					env: run.EnvVars{
+						"FROM_VARIANT=eu",
+						"OVERRIDDEN=variant",
+						"REGION=eu-west-1",
+					},
+				},
+				"stack@us": {
+					env: run.EnvVars{
+						"OVERRIDDEN=config",
+						"REGION=us-east-1",
+					},
+				},
+			},
+		},
+		{
+			name: "fails on invalid dotenv file",
+			layout: []string{
+				"s:stack",
+				"f:stack/.env:INVALID LINE\n",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					add: Terramate(Config(Run(
+						Expr("env_files", `[".env"]`),
+					))),
+				},
+			},
+			want: map[string]result{
+				"stack": {
+					enverr: errors.E(run.ErrInvalidEnvFile),
+				},
+			},
+		},
+		{
+			name: "fails if env_files is not a list of strings",
+			layout: []string{
+				"s:stack",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					add: Terramate(Config(Run(
+						Expr("env_files", `".env"`),
+					))),
+				},
+			},
+			want: map[string]result{
+				"stack": {
+					enverr: errors.E(run.ErrEnvFilesEval),
+				},
+			},
+		},
+		{
+			name: "stack with run.env and no root config",
+			layout: []string{
+				"s:stack",
+				"s:other",
+			},
+			configs: []hclconfig{
+				{
+					path: "/stack",
+					add: Run(Env(
+						Str("AWS_PROFILE", "stack"),
+					)),
+				},
+			},
+			want: map[string]result{
+				"stack": {
+					env: run.EnvVars{
+						"AWS_PROFILE=stack",
+					},
+				},
+				"other": {},
+			},
+		},
+		{
+			name: "fails if stack run.env attribute is not string",
+			layout: []string{
+				"s:stack",
+			},
+			configs: []hclconfig{
+				{
+					path: "/stack",
+					add: Run(Env(
+						Expr("env", "[]"),
+					)),
+				},
+			},
+			want: map[string]result{
+				"stack": {
+					enverr: errors.E(run.ErrInvalidEnvVarType),
+				},
+			},
+		},
 		{
 			name: "fails on invalid root config",
 			layout: []string{
@@ -231,16 +480,22 @@ func TestLoadRunEnv(t *testing.T) {
 				t.Setenv(name, value)
 			}
 
-			for stackRelPath, wantres := range tcase.want {
+			for stackKey, wantres := range tcase.want {
 				root, err := config.LoadRoot(s.RootDir())
 				if wantres.cfgerr != nil {
 					errorstest.Assert(t, err, wantres.cfgerr)
 					return
 				}
 
+				// stacks are referenced as <path>@<variant> to select a variant.
+				stackRelPath, variantName, _ := strings.Cut(stackKey, "@")
 				stack, err := config.LoadStack(root, project.NewPath(path.Join("/", stackRelPath)))
 				assert.NoError(t, err)
 
+				if variantName != "" {
+					stack = selectVariant(t, stack, variantName)
+				}
+
 				gotvars, err := run.LoadEnv(root, stack)
 				errorstest.Assert(t, err, wantres.enverr)
 				test.AssertDiff(t, gotvars, wantres.env)
@@ -249,6 +504,108 @@ func TestLoadRunEnv(t *testing.T) {
 	}
 }
 
+func selectVariant(t *testing.T, st *config.Stack, name string) *config.Stack {
+	t.Helper()
+
+	for _, variant := range st.ExpandVariants() {
+		if variant.Variant != nil && variant.Variant.Name == name {
+			return variant
+		}
+	}
+	t.Fatalf("stack %s has no variant %q", st.Dir, name)
+	return nil
+}
+
 func init() {
 	zerolog.SetGlobalLevel(zerolog.Disabled)
 }
+
+func TestInheritEnv(t *testing.T) {
+	t.Parallel()
+
+	type testcase struct {
+		name    string
+		config  fmt.Stringer
+		environ []string
+		want    []string
+	}
+
+	environ := []string{
+		"PATH=/bin",
+		"HOME=/home/user",
+		"AWS_REGION=eu-west-1",
+		"AWS_SECRET_ACCESS_KEY=secret",
+		"GITHUB_TOKEN=token",
+	}
+
+	inheritEnvCfg := func(builders ...hclwrite.BlockBuilder) fmt.Stringer {
+		return Terramate(Config(Run(Block("inherit_env", builders...))))
+	}
+
+	for _, tc := range []testcase{
+		{
+			name:    "no inherit_env config inherits everything",
+			environ: environ,
+			want:    environ,
+		},
+		{
+			name: "allow list",
+			config: inheritEnvCfg(
+				Expr("allow", `["PATH", "AWS_*"]`),
+			),
+			environ: environ,
+			want: []string{
+				"PATH=/bin",
+				"AWS_REGION=eu-west-1",
+				"AWS_SECRET_ACCESS_KEY=secret",
+			},
+		},
+		{
+			name: "deny list",
+			config: inheritEnvCfg(
+				Expr("deny", `["*_TOKEN", "*SECRET*"]`),
+			),
+			environ: environ,
+			want: []string{
+				"PATH=/bin",
+				"HOME=/home/user",
+				"AWS_REGION=eu-west-1",
+			},
+		},
+		{
+			name: "deny takes precedence over allow",
+			config: inheritEnvCfg(
+				Expr("allow", `["AWS_*"]`),
+				Expr("deny", `["AWS_SECRET_*"]`),
+			),
+			environ: environ,
+			want: []string{
+				"AWS_REGION=eu-west-1",
+			},
+		},
+		{
+			name: "empty allow list inherits nothing",
+			config: inheritEnvCfg(
+				Expr("allow", `[]`),
+			),
+			environ: environ,
+			want:    nil,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := sandbox.NoGit(t, true)
+			s.BuildTree([]string{"s:stack"})
+			if tc.config != nil {
+				test.AppendFile(t, s.RootDir(), "inherit_env_test_cfg.tm", tc.config.String())
+			}
+
+			root, err := config.LoadRoot(s.RootDir())
+			assert.NoError(t, err)
+
+			test.AssertDiff(t, run.InheritEnv(root, tc.environ), tc.want)
+		})
+	}
+}
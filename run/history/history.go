@@ -0,0 +1,127 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+// Package history implements the local history of the stacks execution.
+// The history keeps the duration of the last commands executed in each stack,
+// so the duration of future runs can be estimated.
+package history
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/run/state"
+	"golang.org/x/exp/slices"
+)
+
+const filename = "history.json"
+
+// MaxEntries is the maximum number of durations kept for each stack.
+const MaxEntries = 10
+
+type (
+	// History is the duration history of the stacks commands, by stack path.
+	History struct {
+		Stacks map[string][]Entry `json:"stacks"`
+	}
+
+	// Entry is the duration of a single command executed in a stack.
+	Entry struct {
+		Command    []string      `json:"command"`
+		Duration   time.Duration `json:"duration"`
+		FinishedAt time.Time     `json:"finished_at"`
+	}
+)
+
+// Load the history of the project rooted at rootdir.
+// An empty history is returned if no history is found.
+func Load(rootdir string) (History, error) {
+	path := filepath.Join(state.Dir(rootdir), filename)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return History{}, nil
+		}
+		return History{}, errors.E(err, "reading run history %s", path)
+	}
+
+	var h History
+	if err := json.Unmarshal(data, &h); err != nil {
+		return History{}, errors.E(err, "parsing run history %s", path)
+	}
+	return h, nil
+}
+
+// Save the history for the project rooted at rootdir.
+func Save(rootdir string, h History) error {
+	dir := state.Dir(rootdir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.E(err, "creating run history dir %s", dir)
+	}
+
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return errors.E(err, "marshaling run history")
+	}
+
+	path := filepath.Join(dir, filename)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return errors.E(err, "writing run history %s", tmpPath)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return errors.E(err, "writing run history %s", path)
+	}
+	return nil
+}
+
+// Add the duration of the command executed in the stack at path.
+// Only the last MaxEntries durations of each stack are kept.
+func (h *History) Add(path string, cmd []string, d time.Duration, finishedAt time.Time) {
+	if h.Stacks == nil {
+		h.Stacks = map[string][]Entry{}
+	}
+	entries := append(h.Stacks[path], Entry{
+		Command:    cmd,
+		Duration:   d,
+		FinishedAt: finishedAt,
+	})
+	if len(entries) > MaxEntries {
+		entries = entries[len(entries)-MaxEntries:]
+	}
+	h.Stacks[path] = entries
+}
+
+// Estimate the duration of the command in the stack at path as the average of
+// the recorded durations of the same command. If the command was never
+// recorded, or if cmd is nil, the average of all the recorded commands of the
+// stack is used. It returns false if the stack has no history.
+func (h History) Estimate(path string, cmd []string) (time.Duration, bool) {
+	entries := h.Stacks[path]
+	if len(entries) == 0 {
+		return 0, false
+	}
+
+	if cmd != nil {
+		var total time.Duration
+		var count int
+		for _, e := range entries {
+			if slices.Equal(e.Command, cmd) {
+				total += e.Duration
+				count++
+			}
+		}
+		if count > 0 {
+			return total / time.Duration(count), true
+		}
+	}
+
+	var total time.Duration
+	for _, e := range entries {
+		total += e.Duration
+	}
+	return total / time.Duration(len(entries)), true
+}
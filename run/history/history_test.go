@@ -0,0 +1,74 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package history_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/terramate-io/terramate/run/history"
+	"github.com/terramate-io/terramate/test"
+)
+
+func TestHistoryLoadNotFound(t *testing.T) {
+	t.Parallel()
+
+	h, err := history.Load(test.TempDir(t))
+	assert.NoError(t, err)
+
+	_, ok := h.Estimate("/stack", nil)
+	assert.IsTrue(t, !ok, "empty history must not have estimates")
+}
+
+func TestHistorySaveAndLoad(t *testing.T) {
+	t.Parallel()
+
+	rootdir := test.TempDir(t)
+	now := time.Now().UTC()
+
+	var h history.History
+	h.Add("/stack-a", []string{"plan"}, 10*time.Second, now)
+	h.Add("/stack-a", []string{"plan"}, 20*time.Second, now)
+	h.Add("/stack-a", []string{"apply"}, 60*time.Second, now)
+	h.Add("/stack-b", []string{"plan"}, 5*time.Second, now)
+
+	assert.NoError(t, history.Save(rootdir, h))
+
+	got, err := history.Load(rootdir)
+	assert.NoError(t, err)
+
+	assertEstimate(t, got, "/stack-a", []string{"plan"}, 15*time.Second)
+	assertEstimate(t, got, "/stack-a", []string{"apply"}, 60*time.Second)
+	assertEstimate(t, got, "/stack-a", []string{"destroy"}, 30*time.Second)
+	assertEstimate(t, got, "/stack-a", nil, 30*time.Second)
+	assertEstimate(t, got, "/stack-b", nil, 5*time.Second)
+
+	_, ok := got.Estimate("/stack-c", nil)
+	assert.IsTrue(t, !ok, "unknown stack must not have estimates")
+}
+
+func TestHistoryKeepsLastEntries(t *testing.T) {
+	t.Parallel()
+
+	var h history.History
+	for i := 1; i <= history.MaxEntries+5; i++ {
+		h.Add("/stack", nil, time.Duration(i)*time.Second, time.Now())
+	}
+
+	assert.EqualInts(t, history.MaxEntries, len(h.Stacks["/stack"]))
+
+	// only the durations from 6s to 15s are kept.
+	assertEstimate(t, h, "/stack", nil, 10500*time.Millisecond)
+}
+
+func assertEstimate(t *testing.T, h history.History, path string, cmd []string, want time.Duration) {
+	t.Helper()
+
+	got, ok := h.Estimate(path, cmd)
+	assert.IsTrue(t, ok, "stack %s must have an estimate", path)
+	if got != want {
+		t.Fatalf("stack %s estimate: want %s, got %s", path, want, got)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package run
+
+import (
+	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/hcl"
+	"github.com/terramate-io/terramate/hcl/eval"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const (
+	// ErrHookEval indicates that an error happened while evaluating the
+	// command of a terramate.config.run hook.
+	ErrHookEval errors.Kind = "evaluating terramate.config.run hook"
+
+	// ErrInvalidHookCommand indicates the hook command has an invalid type.
+	ErrInvalidHookCommand errors.Kind = "invalid hook command"
+)
+
+// ExitCodeEnv is the name of the environment variable which holds the exit
+// code of the stack command when executing the after hook.
+const ExitCodeEnv = "TM_RUN_EXIT_CODE"
+
+// Hooks are the commands executed before and after the command of a stack.
+// A nil command means the hook is not defined.
+type Hooks struct {
+	Before []string
+	After  []string
+}
+
+// LoadHooks evaluates the terramate.config.run.before and
+// terramate.config.run.after hooks for the given stack. The hook commands are
+// evaluated with the globals and the metadata of the stack.
+func LoadHooks(root *config.Root, st *config.Stack) (Hooks, error) {
+	cfg := root.Tree().Node
+	if !cfg.HasRunHooks() {
+		return Hooks{}, nil
+	}
+
+	evalctx, err := newStackEvalContext(root, st)
+	if err != nil {
+		return Hooks{}, errors.E(ErrHookEval, err)
+	}
+
+	var hooks Hooks
+
+	errs := errors.L()
+	runCfg := cfg.Terramate.Config.Run
+	if runCfg.Before != nil {
+		hooks.Before, err = evalHookCommand(evalctx, runCfg.Before, "before")
+		errs.Append(err)
+	}
+	if runCfg.After != nil {
+		hooks.After, err = evalHookCommand(evalctx, runCfg.After, "after")
+		errs.Append(err)
+	}
+
+	if err := errs.AsError(); err != nil {
+		return Hooks{}, err
+	}
+	return hooks, nil
+}
+
+func evalHookCommand(evalctx *eval.Context, hook *hcl.RunHook, name string) ([]string, error) {
+	expr := hook.Command.Expr
+	val, err := evalctx.Eval(expr)
+	if err != nil {
+		return nil, errors.E(ErrHookEval, err, "evaluating terramate.config.run.%s.command", name)
+	}
+
+	if !val.Type().IsTupleType() && !val.Type().IsListType() {
+		return nil, errors.E(ErrInvalidHookCommand, expr.Range(),
+			"terramate.config.run.%s.command must be a list(string) but has type %s",
+			name, val.Type().FriendlyName())
+	}
+
+	if val.LengthInt() == 0 {
+		return nil, errors.E(ErrInvalidHookCommand, expr.Range(),
+			"terramate.config.run.%s.command must not be empty", name)
+	}
+
+	var command []string
+	index := -1
+	it := val.ElementIterator()
+	for it.Next() {
+		index++
+		_, elem := it.Element()
+		if elem.Type() != cty.String {
+			return nil, errors.E(ErrInvalidHookCommand, expr.Range(),
+				"terramate.config.run.%s.command must be a list(string) but element %d has type %s",
+				name, index, elem.Type().FriendlyName())
+		}
+		command = append(command, elem.AsString())
+	}
+	return command, nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package run_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/project"
+	"github.com/terramate-io/terramate/run"
+	"github.com/terramate-io/terramate/test"
+	errorstest "github.com/terramate-io/terramate/test/errors"
+	"github.com/terramate-io/terramate/test/hclwrite"
+	. "github.com/terramate-io/terramate/test/hclwrite/hclutils"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestLoadRunHooks(t *testing.T) {
+	t.Parallel()
+
+	type testcase struct {
+		name    string
+		config  *hclwrite.Block
+		globals *hclwrite.Block
+		want    run.Hooks
+		wantErr error
+	}
+
+	runHooksCfg := func(builders ...hclwrite.BlockBuilder) *hclwrite.Block {
+		return Terramate(Config(Run(builders...)))
+	}
+
+	for _, tc := range []testcase{
+		{
+			name:   "no hooks",
+			config: runHooksCfg(),
+		},
+		{
+			name: "before and after hooks",
+			config: runHooksCfg(
+				Block("before",
+					Expr("command", `["echo", "before", global.msg]`),
+				),
+				Block("after",
+					Expr("command", `["echo", "after", terramate.stack.name]`),
+				),
+			),
+			globals: Globals(
+				Str("msg", "hello"),
+			),
+			want: run.Hooks{
+				Before: []string{"echo", "before", "hello"},
+				After:  []string{"echo", "after", "stack"},
+			},
+		},
+		{
+			name: "only after hook",
+			config: runHooksCfg(
+				Block("after",
+					Expr("command", `["echo", terramate.stack.path.absolute]`),
+				),
+			),
+			want: run.Hooks{
+				After: []string{"echo", "/stack"},
+			},
+		},
+		{
+			name: "fails evaluating undefined global",
+			config: runHooksCfg(
+				Block("before",
+					Expr("command", `["echo", global.undefined]`),
+				),
+			),
+			wantErr: errors.E(run.ErrHookEval),
+		},
+		{
+			name: "fails if command is not a list",
+			config: runHooksCfg(
+				Block("before",
+					Str("command", "echo"),
+				),
+			),
+			wantErr: errors.E(run.ErrInvalidHookCommand),
+		},
+		{
+			name: "fails if command is empty",
+			config: runHooksCfg(
+				Block("after",
+					Expr("command", `[]`),
+				),
+			),
+			wantErr: errors.E(run.ErrInvalidHookCommand),
+		},
+		{
+			name: "fails if command has non string elements",
+			config: runHooksCfg(
+				Block("after",
+					Expr("command", `["echo", 1]`),
+				),
+			),
+			wantErr: errors.E(run.ErrInvalidHookCommand),
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := sandbox.NoGit(t, true)
+			s.BuildTree([]string{"s:stack"})
+			test.AppendFile(t, s.RootDir(), "run_hooks_test_cfg.tm", tc.config.String())
+			if tc.globals != nil {
+				test.AppendFile(t, filepath.Join(s.RootDir(), "stack"),
+					"globals.tm", tc.globals.String())
+			}
+
+			root, err := config.LoadRoot(s.RootDir())
+			assert.NoError(t, err)
+
+			st, err := config.LoadStack(root, project.NewPath("/stack"))
+			assert.NoError(t, err)
+
+			got, err := run.LoadHooks(root, st)
+			errorstest.Assert(t, err, tc.wantErr)
+			test.AssertDiff(t, got, tc.want)
+		})
+	}
+}
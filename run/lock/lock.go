@@ -0,0 +1,160 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+// Package lock implements the advisory lock which prevents concurrent runs in
+// the same project checkout.
+// The lock is an exclusive file lock (flock on Unix and LockFileEx on Windows)
+// on a file, kept in the local run directory, holding the PID and the hostname
+// of the process owning it. The file lock is released by the operating system
+// when the owner process exits, even if it crashes, so a lock is never left
+// behind and no stale lock detection is needed.
+package lock
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/run/state"
+)
+
+// ErrLocked indicates the lock is held by another process.
+const ErrLocked errors.Kind = "project run is locked"
+
+const filename = "run.lock"
+
+// pollInterval is the interval between attempts to acquire a held lock.
+const pollInterval = 200 * time.Millisecond
+
+type (
+	// Lock is an acquired run lock.
+	Lock struct {
+		path string
+		file *os.File
+	}
+
+	// Info is the information about the owner of the lock.
+	Info struct {
+		PID       int       `json:"pid"`
+		Hostname  string    `json:"hostname"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+)
+
+// Acquire the run lock of the project rooted at rootdir, waiting up to the
+// given timeout for the lock to be released by its current owner.
+// It returns an error of kind ErrLocked if the lock can't be acquired.
+func Acquire(rootdir string, timeout time.Duration) (*Lock, error) {
+	dir := state.Dir(rootdir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.E(err, "creating run lock dir %s", dir)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, errors.E(err, "getting hostname for the run lock")
+	}
+
+	path := filepath.Join(dir, filename)
+
+	// the lock file is never removed, otherwise a process waiting for the
+	// lock of the removed file and a process locking a new file could both
+	// own the lock.
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, errors.E(err, "opening run lock %s", path)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		locked, err := tryLock(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, errors.E(err, "locking run lock %s", path)
+		}
+		if locked {
+			break
+		}
+
+		if !time.Now().Before(deadline) {
+			_ = f.Close()
+			owner, err := readInfo(path)
+			if err != nil {
+				return nil, errors.E(ErrLocked, "locked by another process (lock file %s)", path)
+			}
+			return nil, errors.E(ErrLocked,
+				"locked by PID %d on host %s since %s (lock file %s)",
+				owner.PID, owner.Hostname, owner.CreatedAt.Format(time.RFC3339), path)
+		}
+		time.Sleep(pollInterval)
+	}
+
+	l := &Lock{path: path, file: f}
+	info := Info{
+		PID:       os.Getpid(),
+		Hostname:  hostname,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := l.write(info); err != nil {
+		_ = l.Release()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Read the information of the current owner of the run lock of the project
+// rooted at rootdir.
+func Read(rootdir string) (Info, error) {
+	path := filepath.Join(state.Dir(rootdir), filename)
+	info, err := readInfo(path)
+	if err != nil {
+		return Info{}, errors.E(err, "reading run lock %s", path)
+	}
+	return info, nil
+}
+
+func readInfo(path string) (Info, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Info{}, err
+	}
+
+	var info Info
+	if err := json.Unmarshal(data, &info); err != nil {
+		return Info{}, err
+	}
+	return info, nil
+}
+
+// Release the lock. The owner information is cleared from the lock file,
+// which is kept for the next runs.
+func (l *Lock) Release() error {
+	errs := errors.L()
+	if err := l.file.Truncate(0); err != nil {
+		errs.Append(errors.E(err, "clearing run lock %s", l.path))
+	}
+	if err := unlock(l.file); err != nil {
+		errs.Append(errors.E(err, "unlocking run lock %s", l.path))
+	}
+	if err := l.file.Close(); err != nil {
+		errs.Append(errors.E(err, "closing run lock %s", l.path))
+	}
+	return errs.AsError()
+}
+
+// write the owner information into the locked file.
+func (l *Lock) write(info Info) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return errors.E(err, "marshaling run lock")
+	}
+	if err := l.file.Truncate(0); err != nil {
+		return errors.E(err, "writing run lock %s", l.path)
+	}
+	if _, err := l.file.WriteAt(data, 0); err != nil {
+		return errors.E(err, "writing run lock %s", l.path)
+	}
+	return nil
+}
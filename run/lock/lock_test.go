@@ -0,0 +1,137 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package lock_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/run/lock"
+	"github.com/terramate-io/terramate/run/state"
+	"github.com/terramate-io/terramate/test"
+)
+
+func TestLockAcquireAndRelease(t *testing.T) {
+	t.Parallel()
+
+	rootdir := test.TempDir(t)
+
+	l, err := lock.Acquire(rootdir, 0)
+	assert.NoError(t, err)
+
+	info, err := lock.Read(rootdir)
+	assert.NoError(t, err)
+	assert.EqualInts(t, os.Getpid(), info.PID)
+
+	hostname, err := os.Hostname()
+	assert.NoError(t, err)
+	assert.EqualStrings(t, hostname, info.Hostname)
+
+	_, err = lock.Acquire(rootdir, 0)
+	assert.IsError(t, err, errors.E(lock.ErrLocked))
+
+	assert.NoError(t, l.Release())
+
+	l, err = lock.Acquire(rootdir, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Release())
+}
+
+func TestLockWaitsForRelease(t *testing.T) {
+	t.Parallel()
+
+	rootdir := test.TempDir(t)
+
+	l, err := lock.Acquire(rootdir, 0)
+	assert.NoError(t, err)
+
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		_ = l.Release()
+	}()
+
+	l2, err := lock.Acquire(rootdir, 10*time.Second)
+	assert.NoError(t, err)
+	assert.NoError(t, l2.Release())
+}
+
+func TestLockTakesOverStaleLock(t *testing.T) {
+	t.Parallel()
+
+	rootdir := test.TempDir(t)
+	hostname, err := os.Hostname()
+	assert.NoError(t, err)
+
+	// a PID which can't exist on Linux and BSDs.
+	writeLockFile(t, rootdir, lock.Info{PID: 1 << 30, Hostname: hostname})
+
+	l, err := lock.Acquire(rootdir, 0)
+	assert.NoError(t, err)
+
+	info, err := lock.Read(rootdir)
+	assert.NoError(t, err)
+	assert.EqualInts(t, os.Getpid(), info.PID)
+	assert.NoError(t, l.Release())
+}
+
+func TestLockFileLeftByOtherHostIsTakenOver(t *testing.T) {
+	t.Parallel()
+
+	// the lock file of a crashed process in another host (eg.: a CI
+	// container) is not locked by any process anymore.
+	rootdir := test.TempDir(t)
+	writeLockFile(t, rootdir, lock.Info{PID: 1 << 30, Hostname: "other-host"})
+
+	l, err := lock.Acquire(rootdir, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Release())
+}
+
+func TestLockConcurrentAcquireHasSingleOwner(t *testing.T) {
+	t.Parallel()
+
+	rootdir := test.TempDir(t)
+	writeLockFile(t, rootdir, lock.Info{PID: 1 << 30, Hostname: "other-host"})
+
+	const attempts = 10
+
+	var wg sync.WaitGroup
+	locks := make(chan *lock.Lock, attempts)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l, err := lock.Acquire(rootdir, 0)
+			if err == nil {
+				locks <- l
+			}
+		}()
+	}
+	wg.Wait()
+	close(locks)
+
+	var owners int
+	for l := range locks {
+		owners++
+		assert.NoError(t, l.Release())
+	}
+	assert.EqualInts(t, 1, owners, "lock must have a single owner")
+}
+
+func writeLockFile(t *testing.T, rootdir string, info lock.Info) {
+	t.Helper()
+
+	data, err := json.Marshal(info)
+	assert.NoError(t, err)
+
+	dir := state.Dir(rootdir)
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "run.lock"), data, 0644))
+}
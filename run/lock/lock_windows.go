@@ -0,0 +1,39 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build windows
+
+package lock
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockRange returns the locked region of the file. It's beyond the owner
+// information, as the locked regions can't be read by other processes.
+func lockRange() *windows.Overlapped {
+	return &windows.Overlapped{
+		Offset:     ^uint32(0),
+		OffsetHigh: ^uint32(0) >> 1,
+	}
+}
+
+// tryLock takes the exclusive lock of the file without blocking.
+// It returns false if the lock is held by another process.
+func tryLock(f *os.File) (bool, error) {
+	err := windows.LockFileEx(
+		windows.Handle(f.Fd()),
+		windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY,
+		0, 1, 0, lockRange(),
+	)
+	if err == windows.ERROR_LOCK_VIOLATION {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func unlock(f *os.File) error {
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, lockRange())
+}
@@ -0,0 +1,313 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package run
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/globals"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// ErrMaskLoad indicates the failure to load the values masked in the output
+// of the commands.
+const ErrMaskLoad errors.Kind = "loading masked values"
+
+// MaskReplacement is the text which replaces the masked values.
+const MaskReplacement = "***"
+
+// DefaultMaskIdleFlush is the default time a line without a line terminator
+// waits for the rest of the line before being masked and written.
+const DefaultMaskIdleFlush = 100 * time.Millisecond
+
+// Masker masks secret values in the output of the commands of a stack.
+type Masker struct {
+	values   [][]byte
+	patterns []*regexp.Regexp
+}
+
+// LoadMasker creates the masker for the commands of the given stack.
+// The masked values are:
+//   - the values of the environment variables listed in the sensitive_env
+//     attribute of terramate.config.run and of the run blocks of the stack
+//     directory and its parent directories, looked up in the given environ.
+//   - the values of the globals listed in terramate.config.run.sensitive_globals.
+//   - the matches of the regexes in terramate.config.run.mask_patterns.
+func LoadMasker(root *config.Root, st *config.Stack, environ []string) (*Masker, error) {
+	logger := log.With().
+		Str("action", "run.LoadMasker()").
+		Stringer("stack", st).
+		Logger()
+
+	m := &Masker{}
+	for _, name := range sensitiveEnvNames(root, st) {
+		if val, ok := getEnv(name, environ); ok {
+			m.addValue(val)
+		}
+	}
+
+	cfg := root.Tree().Node
+	if cfg.Terramate == nil || cfg.Terramate.Config == nil || cfg.Terramate.Config.Run == nil {
+		m.sortValues()
+		return m, nil
+	}
+
+	runCfg := cfg.Terramate.Config.Run
+	if len(runCfg.SensitiveGlobals) > 0 {
+		report := globals.ForStack(root, st)
+		if err := report.AsError(); err != nil {
+			return nil, errors.E(ErrMaskLoad, err)
+		}
+
+		globalValues := cty.ObjectVal(report.Globals.AsValueMap())
+		for _, path := range runCfg.SensitiveGlobals {
+			val, ok := lookupGlobal(globalValues, path)
+			if !ok {
+				// globals can be defined only for some of the stacks.
+				logger.Debug().Str("global", path).Msg("sensitive global not defined")
+				continue
+			}
+			if err := m.addCtyValue(val); err != nil {
+				return nil, errors.E(ErrMaskLoad, err, "global.%s", path)
+			}
+		}
+	}
+
+	for _, pattern := range runCfg.MaskPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.E(ErrMaskLoad, err, "compiling mask pattern %q", pattern)
+		}
+		m.patterns = append(m.patterns, re)
+	}
+
+	m.sortValues()
+	return m, nil
+}
+
+// Empty tells if the masker has nothing to mask. A nil masker is empty.
+func (m *Masker) Empty() bool {
+	return m == nil || (len(m.values) == 0 && len(m.patterns) == 0)
+}
+
+// Mask returns the data with all the secret values and pattern matches
+// replaced by MaskReplacement.
+func (m *Masker) Mask(data []byte) []byte {
+	if m.Empty() {
+		return data
+	}
+	replacement := []byte(MaskReplacement)
+	for _, val := range m.values {
+		data = bytes.ReplaceAll(data, val, replacement)
+	}
+	for _, re := range m.patterns {
+		data = re.ReplaceAllLiteral(data, replacement)
+	}
+	return data
+}
+
+// addValue adds the value to be masked. The output is masked line by line, so
+// each line of a multi-line value is masked on its own.
+func (m *Masker) addValue(val string) {
+	for _, line := range strings.Split(val, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		m.values = append(m.values, []byte(line))
+	}
+}
+
+func (m *Masker) addCtyValue(val cty.Value) error {
+	if val.IsNull() || !val.IsKnown() {
+		return nil
+	}
+
+	typ := val.Type()
+	if typ.IsObjectType() || typ.IsMapType() || typ.IsListType() ||
+		typ.IsTupleType() || typ.IsSetType() {
+		it := val.ElementIterator()
+		for it.Next() {
+			_, elem := it.Element()
+			if err := m.addCtyValue(elem); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	strVal, err := convert.Convert(val, cty.String)
+	if err != nil {
+		return errors.E(err, "converting value of type %s to string", typ.FriendlyName())
+	}
+	m.addValue(strVal.AsString())
+	return nil
+}
+
+// MaskWriter is a writer which masks the secrets of each line written into it
+// before writing the line into the underlying writer. A line without a line
+// terminator (eg.: a prompt) is masked and written if no more data is written
+// within the idle flush time.
+type MaskWriter struct {
+	masker    *Masker
+	out       io.Writer
+	idleFlush time.Duration
+
+	mu      sync.Mutex
+	pending []byte
+	timer   *time.Timer
+	err     error
+}
+
+// NewMaskWriter creates a writer which masks the secrets of the masker before
+// writing into out. The lines without a line terminator are flushed after the
+// given idle flush time.
+func NewMaskWriter(masker *Masker, out io.Writer, idleFlush time.Duration) *MaskWriter {
+	return &MaskWriter{
+		masker:    masker,
+		out:       out,
+		idleFlush: idleFlush,
+	}
+}
+
+// Write masks and writes the complete lines of the data, keeping the last
+// line until its line terminator is written, the idle flush time expires or
+// the writer is closed.
+func (w *MaskWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	w.stopTimerLocked()
+	w.pending = append(w.pending, p...)
+	for {
+		pos := bytes.IndexByte(w.pending, '\n')
+		if pos < 0 {
+			break
+		}
+		if err := w.writeLocked(w.pending[:pos+1]); err != nil {
+			return 0, err
+		}
+		w.pending = w.pending[pos+1:]
+	}
+
+	if len(w.pending) > 0 {
+		var timer *time.Timer
+		timer = time.AfterFunc(w.idleFlush, func() {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+
+			// the timer may fire concurrently with a write which replaced it.
+			if w.timer == timer {
+				w.flushLocked()
+			}
+		})
+		w.timer = timer
+	}
+	return len(p), nil
+}
+
+// Close masks and writes the pending line, if any. The writer must not be
+// used after calling this method.
+func (w *MaskWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.stopTimerLocked()
+	w.flushLocked()
+	return w.err
+}
+
+func (w *MaskWriter) flushLocked() {
+	w.timer = nil
+	if len(w.pending) == 0 {
+		return
+	}
+	_ = w.writeLocked(w.pending)
+	w.pending = nil
+}
+
+func (w *MaskWriter) writeLocked(line []byte) error {
+	if w.err != nil {
+		return w.err
+	}
+	if _, err := w.out.Write(w.masker.Mask(line)); err != nil {
+		w.err = err
+	}
+	return w.err
+}
+
+func (w *MaskWriter) stopTimerLocked() {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+}
+
+// sortValues sorts the values by length, longest first, so a secret which
+// contains another one is masked as a whole.
+func (m *Masker) sortValues() {
+	sort.SliceStable(m.values, func(i, j int) bool {
+		return len(m.values[i]) > len(m.values[j])
+	})
+}
+
+// sensitiveEnvNames returns the names of the sensitive environment variables
+// of the given stack.
+func sensitiveEnvNames(root *config.Root, st *config.Stack) []string {
+	var names []string
+	cfg := root.Tree().Node
+	if cfg.Terramate != nil && cfg.Terramate.Config != nil && cfg.Terramate.Config.Run != nil {
+		names = append(names, cfg.Terramate.Config.Run.SensitiveEnv...)
+	}
+
+	tree, ok := root.Lookup(st.Dir)
+	for ok && tree != nil {
+		if tree.Node.Run != nil {
+			names = append(names, tree.Node.Run.SensitiveEnv...)
+		}
+		tree = tree.Parent
+	}
+	return names
+}
+
+// lookupGlobal returns the value of the global at the given dot separated
+// path, if it's defined.
+func lookupGlobal(val cty.Value, path string) (cty.Value, bool) {
+	for _, name := range strings.Split(path, ".") {
+		if val.IsNull() || !val.IsKnown() {
+			return cty.NilVal, false
+		}
+		typ := val.Type()
+		switch {
+		case typ.IsObjectType():
+			if !typ.HasAttribute(name) {
+				return cty.NilVal, false
+			}
+			val = val.GetAttr(name)
+		case typ.IsMapType():
+			key := cty.StringVal(name)
+			if !val.HasIndex(key).True() {
+				return cty.NilVal, false
+			}
+			val = val.Index(key)
+		default:
+			return cty.NilVal, false
+		}
+	}
+	return val, true
+}
@@ -0,0 +1,258 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package run_test
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/project"
+	"github.com/terramate-io/terramate/run"
+	"github.com/terramate-io/terramate/test"
+	. "github.com/terramate-io/terramate/test/hclwrite/hclutils"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunMasker(t *testing.T) {
+	t.Parallel()
+
+	type (
+		hclconfig struct {
+			path string
+			add  fmt.Stringer
+		}
+		testcase struct {
+			name    string
+			layout  []string
+			configs []hclconfig
+			environ []string
+			input   string
+			want    map[string]string
+		}
+	)
+
+	for _, tc := range []testcase{
+		{
+			name: "nothing to mask",
+			layout: []string{
+				"s:stack",
+			},
+			environ: []string{"TOKEN=secret"},
+			input:   "token is secret",
+			want: map[string]string{
+				"stack": "token is secret",
+			},
+		},
+		{
+			name: "sensitive env from terramate.config.run and run blocks",
+			layout: []string{
+				"s:stacks/stack-1",
+				"s:stack-2",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					add: Terramate(Config(Run(
+						Expr("sensitive_env", `["TOKEN"]`),
+					))),
+				},
+				{
+					path: "/stacks",
+					add: Run(
+						Expr("sensitive_env", `["PASSWORD", "UNDEFINED"]`),
+					),
+				},
+			},
+			environ: []string{"TOKEN=tok3n", "PASSWORD=passw0rd", "OTHER=visible"},
+			input:   "tok3n passw0rd visible",
+			want: map[string]string{
+				"stacks/stack-1": "*** *** visible",
+				"stack-2":        "*** passw0rd visible",
+			},
+		},
+		{
+			name: "sensitive globals",
+			layout: []string{
+				"s:stack-1",
+				"s:stack-2",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					add: Terramate(Config(Run(
+						Expr("sensitive_globals", `["db.password", "keys", "undefined.path"]`),
+					))),
+				},
+				{
+					path: "/",
+					add: Globals(
+						Expr("db", `{ user = "admin", password = "hunter2" }`),
+						Expr("keys", `["key-a", 1234]`),
+					),
+				},
+				{
+					path: "/stack-2",
+					add: Globals(
+						Expr("db", `{ user = "admin", password = "hunter2-long" }`),
+					),
+				},
+			},
+			input: "admin:hunter2-long key-a 1234",
+			want: map[string]string{
+				"stack-1": "admin:***-long *** ***",
+				"stack-2": "admin:*** *** ***",
+			},
+		},
+		{
+			name: "multi-line secrets are masked line by line",
+			layout: []string{
+				"s:stack",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					add: Terramate(Config(Run(
+						Expr("sensitive_env", `["CERT"]`),
+					))),
+				},
+			},
+			environ: []string{"CERT=-----BEGIN KEY-----\r\nc2VjcmV0\n\n-----END KEY-----\n"},
+			input:   "-----BEGIN KEY-----\r\nc2VjcmV0\n\n-----END KEY-----\nvisible",
+			want: map[string]string{
+				"stack": "***\r\n***\n\n***\nvisible",
+			},
+		},
+		{
+			name: "mask patterns",
+			layout: []string{
+				"s:stack",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					add: Terramate(Config(Run(
+						Expr("mask_patterns", `["ghp_[a-zA-Z0-9]+", "password=\\S+"]`),
+					))),
+				},
+			},
+			input: "token ghp_abc123 and password=hunter2 end",
+			want: map[string]string{
+				"stack": "token *** and *** end",
+			},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := sandbox.NoGit(t, true)
+			s.BuildTree(tc.layout)
+			for _, cfg := range tc.configs {
+				path := filepath.Join(s.RootDir(), cfg.path)
+				test.AppendFile(t, path, "run_mask_test_cfg.tm", cfg.add.String())
+			}
+
+			root, err := config.LoadRoot(s.RootDir())
+			assert.NoError(t, err)
+
+			for stackRelPath, want := range tc.want {
+				st, err := config.LoadStack(root, project.NewPath(path.Join("/", stackRelPath)))
+				assert.NoError(t, err)
+
+				masker, err := run.LoadMasker(root, st, tc.environ)
+				assert.NoError(t, err)
+
+				got := string(masker.Mask([]byte(tc.input)))
+				assert.EqualStrings(t, want, got, "stack %s", stackRelPath)
+			}
+		})
+	}
+}
+
+func TestRunMaskWriter(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		"s:stack",
+		`f:terramate.tm:
+		  terramate {
+		    config {
+		      run {
+		        sensitive_env = ["TOKEN"]
+		      }
+		    }
+		  }`,
+	})
+	root, err := config.LoadRoot(s.RootDir())
+	assert.NoError(t, err)
+	st, err := config.LoadStack(root, project.NewPath("/stack"))
+	assert.NoError(t, err)
+	masker, err := run.LoadMasker(root, st, []string{"TOKEN=s3cr3t"})
+	assert.NoError(t, err)
+
+	t.Run("complete lines are masked as they are written", func(t *testing.T) {
+		t.Parallel()
+
+		out := &syncBuffer{}
+		w := run.NewMaskWriter(masker, out, time.Hour)
+		write(t, w, "token: s3c")
+		assert.EqualStrings(t, "", out.String())
+		write(t, w, "r3t\nnext: s3cr3t")
+		assert.EqualStrings(t, "token: ***\n", out.String())
+		assert.NoError(t, w.Close())
+		assert.EqualStrings(t, "token: ***\nnext: ***", out.String())
+	})
+
+	t.Run("partial lines are written after the idle flush time", func(t *testing.T) {
+		t.Parallel()
+
+		out := &syncBuffer{}
+		w := run.NewMaskWriter(masker, out, 10*time.Millisecond)
+		write(t, w, "s3cr3t\nEnter a value: ")
+
+		want := "***\nEnter a value: "
+		deadline := time.Now().Add(5 * time.Second)
+		for out.String() != want && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.EqualStrings(t, want, out.String())
+
+		write(t, w, "s3cr3t\n")
+		assert.NoError(t, w.Close())
+		assert.EqualStrings(t, want+"***\n", out.String())
+	})
+}
+
+func write(t *testing.T, w *run.MaskWriter, data string) {
+	t.Helper()
+	_, err := w.Write([]byte(data))
+	assert.NoError(t, err)
+}
+
+// syncBuffer is a buffer safe for concurrent use, as the mask writer flushes
+// partial lines from a timer.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -10,10 +10,12 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/terramate-io/terramate/config"
 	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/project"
 	"github.com/terramate-io/terramate/run/dag"
 )
 
@@ -21,10 +23,55 @@ import (
 // In the case of multiple possible orders, it returns the lexicographic sorted
 // path.
 func Sort(root *config.Root, stacks config.List[*config.SortableStack]) (config.List[*config.SortableStack], string, error) {
+	d, reason, err := BuildStacksDAG(root, stacks)
+	if err != nil {
+		return nil, reason, err
+	}
+
+	order := d.Order()
+
+	orderedStacks := make(config.List[*config.SortableStack], 0, len(order))
+
+	isSelectedStack := func(s *config.Stack) bool {
+		// Stacks may be added on the DAG from after/before references
+		// but they should not be on the final order if they are not part
+		// of the previously selected stacks passed as a parameter.
+		// This is important for change detection to work on ordering and
+		// also for filtering by working dir.
+		for _, stack := range stacks {
+			if s.Dir == stack.Dir() {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, id := range order {
+		val, err := d.Node(id)
+		if err != nil {
+			return nil, "", fmt.Errorf("calculating run-order: %w", err)
+		}
+		s := val.(*config.Stack)
+		if !isSelectedStack(s) {
+			continue
+		}
+		orderedStacks = append(orderedStacks, s.Sortable())
+	}
+
+	return orderedStacks, "", nil
+}
+
+// BuildStacksDAG builds and validates the run order DAG for the given list of
+// stacks. Besides the after/before clauses, parent stacks are set to run before
+// their child stacks when both are part of the list.
+// The DAG may also contain stacks outside of the given list when they are
+// referenced by the after/before clauses of the listed stacks.
+// In the case of cycles, the reason is returned together with the error.
+func BuildStacksDAG(root *config.Root, stacks config.List[*config.SortableStack]) (*dag.DAG, string, error) {
 	d := dag.New()
 
 	logger := log.With().
-		Str("action", "run.Sort()").
+		Str("action", "run.BuildStacksDAG()").
 		Str("root", root.HostDir()).
 		Logger()
 
@@ -32,6 +79,8 @@ func Sort(root *config.Root, stacks config.List[*config.SortableStack]) (config.
 		return s1.Dir.HasPrefix(s2.Dir.String() + "/")
 	}
 
+	childStacks := map[project.Path][]string{}
+
 	sort.Sort(stacks)
 	for _, stackElem := range stacks {
 		for _, otherElem := range stacks {
@@ -42,11 +91,21 @@ func Sort(root *config.Root, stacks config.List[*config.SortableStack]) (config.
 			if isParentStack(stackElem.Stack, otherElem.Stack) {
 				logger.Debug().Msgf("stack %q runs before %q since it is its parent", otherElem, stackElem)
 
-				otherElem.AppendBefore(stackElem.Dir().String())
+				childStacks[otherElem.Dir()] = append(childStacks[otherElem.Dir()], stackElem.Dir().String())
 			}
 		}
 	}
 
+	getBefore := func(s config.Stack) []string {
+		children, ok := childStacks[s.Dir]
+		if !ok {
+			return s.Before
+		}
+		before := make([]string, 0, len(s.Before)+len(children))
+		before = append(before, s.Before...)
+		return append(before, children...)
+	}
+
 	visited := dag.Visited{}
 	for _, elem := range stacks {
 		if _, ok := visited[dag.ID(elem.Dir().String())]; ok {
@@ -62,7 +121,7 @@ func Sort(root *config.Root, stacks config.List[*config.SortableStack]) (config.
 			root,
 			elem.Stack,
 			"before",
-			func(s config.Stack) []string { return s.Before },
+			getBefore,
 			"after",
 			func(s config.Stack) []string { return s.After },
 			visited,
@@ -77,38 +136,7 @@ func Sort(root *config.Root, stacks config.List[*config.SortableStack]) (config.
 	if err != nil {
 		return nil, reason, err
 	}
-
-	order := d.Order()
-
-	orderedStacks := make(config.List[*config.SortableStack], 0, len(order))
-
-	isSelectedStack := func(s *config.Stack) bool {
-		// Stacks may be added on the DAG from after/before references
-		// but they should not be on the final order if they are not part
-		// of the previously selected stacks passed as a parameter.
-		// This is important for change detection to work on ordering and
-		// also for filtering by working dir.
-		for _, stack := range stacks {
-			if s.Dir == stack.Dir() {
-				return true
-			}
-		}
-		return false
-	}
-
-	for _, id := range order {
-		val, err := d.Node(id)
-		if err != nil {
-			return nil, "", fmt.Errorf("calculating run-order: %w", err)
-		}
-		s := val.(*config.Stack)
-		if !isSelectedStack(s) {
-			continue
-		}
-		orderedStacks = append(orderedStacks, s.Sortable())
-	}
-
-	return orderedStacks, "", nil
+	return d, "", nil
 }
 
 // BuildDAG builds a run order DAG for the given stack.
@@ -240,3 +268,89 @@ func toids(values config.List[*config.SortableStack]) []dag.ID {
 	}
 	return ids
 }
+
+// CriticalPath computes the longest chain of dependent stacks among the given
+// stacks, weighting each stack by the given estimate. It returns the chain in
+// the execution order together with its total estimated duration.
+// In the case of cycles, the reason is returned together with the error.
+func CriticalPath(
+	root *config.Root,
+	stacks config.List[*config.SortableStack],
+	estimate func(s *config.Stack) time.Duration,
+) (config.List[*config.SortableStack], time.Duration, string, error) {
+	d, reason, err := BuildStacksDAG(root, stacks)
+	if err != nil {
+		return nil, 0, reason, err
+	}
+
+	selected := map[dag.ID]struct{}{}
+	for _, s := range stacks {
+		selected[dag.ID(s.Dir().String())] = struct{}{}
+	}
+
+	// longest is the estimated duration of the longest chain ending at each
+	// node, size is its number of stacks and prev is the previous node of
+	// such chain. Stacks added to the DAG only by after/before references are
+	// not executed, then they don't count for the duration.
+	longest := map[dag.ID]time.Duration{}
+	size := map[dag.ID]int{}
+	prev := map[dag.ID]dag.ID{}
+
+	// chains with the same duration are compared by their size, so the
+	// stacks without history are still part of the critical path.
+	isLonger := func(a, b dag.ID) bool {
+		return longest[a] > longest[b] || (longest[a] == longest[b] && size[a] > size[b])
+	}
+
+	var end dag.ID
+	for _, id := range d.Order() {
+		var weight time.Duration
+		_, isSelected := selected[id]
+		if isSelected {
+			val, err := d.Node(id)
+			if err != nil {
+				return nil, 0, "", fmt.Errorf("calculating critical path: %w", err)
+			}
+			weight = estimate(val.(*config.Stack))
+		}
+
+		ancestors := append([]dag.ID{}, d.AncestorsOf(id)...)
+		sort.Slice(ancestors, func(i, j int) bool { return ancestors[i] < ancestors[j] })
+		for i, ancestor := range ancestors {
+			if i == 0 || isLonger(ancestor, prev[id]) {
+				prev[id] = ancestor
+			}
+		}
+
+		longest[id] = weight
+		if isSelected {
+			size[id] = 1
+		}
+		if ancestor, ok := prev[id]; ok {
+			longest[id] += longest[ancestor]
+			size[id] += size[ancestor]
+		}
+
+		if end == "" || isLonger(id, end) {
+			end = id
+		}
+	}
+
+	if end == "" {
+		return nil, 0, "", nil
+	}
+
+	var path config.List[*config.SortableStack]
+	for id, ok := end, true; ok; id, ok = prev[id] {
+		if _, isSelected := selected[id]; !isSelected {
+			continue
+		}
+		val, err := d.Node(id)
+		if err != nil {
+			return nil, 0, "", fmt.Errorf("calculating critical path: %w", err)
+		}
+		path = append(path, val.(*config.Stack).Sortable())
+	}
+	config.ReverseStacks(path)
+	return path, longest[end], "", nil
+}
@@ -0,0 +1,183 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+// Package state implements the local state of the stacks execution.
+// The state keeps the ordered plan of the last run together with the result of
+// each stack, so a failed or interrupted run can be resumed later.
+package state
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/terramate-io/terramate/errors"
+	"golang.org/x/exp/slices"
+)
+
+// Dirname is the name of the directory, relative to the project root, where
+// the local run files are kept when the project is not inside a git repository.
+const Dirname = ".tmrun"
+
+// GitDirname is the name of the directory, relative to the git directory,
+// where the local run files are kept when the project is inside a git
+// repository, so they are never committed by mistake.
+const GitDirname = "terramate/run"
+
+const filename = "state.json"
+
+// Status of a stack in the run state.
+type Status string
+
+// Available status of the stacks.
+const (
+	Pending  Status = "pending"
+	OK       Status = "ok"
+	Failed   Status = "failed"
+	Canceled Status = "canceled"
+)
+
+type (
+	// State is the state of a run.
+	State struct {
+		// Commit is the git commit of the project when the run started.
+		Commit    string    `json:"commit"`
+		StartedAt time.Time `json:"started_at"`
+		UpdatedAt time.Time `json:"updated_at"`
+
+		// Stacks is the list of stacks in the execution order.
+		Stacks []Stack `json:"stacks"`
+	}
+
+	// Stack is the state of a single stack in a run.
+	Stack struct {
+		Path    string   `json:"path"`
+		Command []string `json:"command"`
+		Status  Status   `json:"status"`
+
+		// Commit is the git commit of the project when the stack was executed.
+		Commit string `json:"commit"`
+	}
+)
+
+// Dir returns the directory of the local run files of the project rooted at
+// rootdir. If the project is inside a git repository, the directory is inside
+// its git directory, otherwise it is the Dirname directory of the project.
+func Dir(rootdir string) string {
+	if gitdir, ok := findGitDir(rootdir); ok {
+		return filepath.Join(gitdir, filepath.FromSlash(GitDirname))
+	}
+	return filepath.Join(rootdir, Dirname)
+}
+
+// findGitDir looks up the git directory of the repository containing dir.
+// The .git file of worktrees and submodules is followed to the actual git
+// directory.
+func findGitDir(dir string) (string, bool) {
+	for {
+		dotgit := filepath.Join(dir, ".git")
+		st, err := os.Stat(dotgit)
+		if err == nil {
+			if st.IsDir() {
+				return dotgit, true
+			}
+			if gitdir, ok := readGitFile(dotgit); ok {
+				return gitdir, true
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// readGitFile reads the git directory from a .git file, which has the format:
+//
+//	gitdir: <path>
+func readGitFile(path string) (string, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	gitdir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir:")
+	if !ok {
+		return "", false
+	}
+	gitdir = strings.TrimSpace(gitdir)
+	if !filepath.IsAbs(gitdir) {
+		gitdir = filepath.Join(filepath.Dir(path), gitdir)
+	}
+	return gitdir, true
+}
+
+// Load the run state of the project rooted at rootdir.
+// It returns false if no run state is found.
+func Load(rootdir string) (State, bool, error) {
+	path := filepath.Join(Dir(rootdir), filename)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return State{}, false, nil
+		}
+		return State{}, false, errors.E(err, "reading run state %s", path)
+	}
+
+	var st State
+	if err := json.Unmarshal(data, &st); err != nil {
+		return State{}, false, errors.E(err, "parsing run state %s", path)
+	}
+	return st, true, nil
+}
+
+// Save the run state for the project rooted at rootdir.
+func Save(rootdir string, st State) error {
+	dir := Dir(rootdir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.E(err, "creating run state dir %s", dir)
+	}
+
+	st.UpdatedAt = time.Now().UTC()
+
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return errors.E(err, "marshaling run state")
+	}
+
+	// the state is written atomically so an interrupted write never leaves
+	// a corrupted state behind.
+	path := filepath.Join(dir, filename)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return errors.E(err, "writing run state %s", tmpPath)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return errors.E(err, "writing run state %s", path)
+	}
+	return nil
+}
+
+// Succeeded tells if the stack at path already succeeded with the same
+// command at the given commit.
+func (st State) Succeeded(path string, cmd []string, commit string) bool {
+	for _, s := range st.Stacks {
+		if s.Path == path {
+			return s.Status == OK && s.Commit == commit && slices.Equal(s.Command, cmd)
+		}
+	}
+	return false
+}
+
+// Set the status of the stack at path.
+func (st *State) Set(path string, status Status) {
+	for i := range st.Stacks {
+		if st.Stacks[i].Path == path {
+			st.Stacks[i].Status = status
+			return
+		}
+	}
+}
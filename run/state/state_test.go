@@ -0,0 +1,90 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package state_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/terramate-io/terramate/run/state"
+	"github.com/terramate-io/terramate/test"
+)
+
+func TestStateLoadNotFound(t *testing.T) {
+	t.Parallel()
+
+	_, found, err := state.Load(test.TempDir(t))
+	assert.NoError(t, err)
+	assert.IsTrue(t, !found, "state must not be found")
+}
+
+func TestStateSaveAndLoad(t *testing.T) {
+	t.Parallel()
+
+	rootdir := test.TempDir(t)
+	st := state.State{
+		Commit: "abc",
+		Stacks: []state.Stack{
+			{
+				Path:    "/stack-a",
+				Command: []string{"echo", "a"},
+				Status:  state.Pending,
+				Commit:  "abc",
+			},
+			{
+				Path:    "/stack-b",
+				Command: []string{"echo", "b"},
+				Status:  state.Pending,
+				Commit:  "abc",
+			},
+		},
+	}
+	st.Set("/stack-a", state.OK)
+	st.Set("/stack-b", state.Failed)
+
+	assert.NoError(t, state.Save(rootdir, st))
+
+	got, found, err := state.Load(rootdir)
+	assert.NoError(t, err)
+	assert.IsTrue(t, found, "state must be found")
+	assert.EqualInts(t, 2, len(got.Stacks))
+
+	assert.IsTrue(t, got.Succeeded("/stack-a", []string{"echo", "a"}, "abc"))
+	assert.IsTrue(t, !got.Succeeded("/stack-a", []string{"echo", "other"}, "abc"),
+		"different command must not be considered succeeded")
+	assert.IsTrue(t, !got.Succeeded("/stack-a", []string{"echo", "a"}, "def"),
+		"different commit must not be considered succeeded")
+	assert.IsTrue(t, !got.Succeeded("/stack-b", []string{"echo", "b"}, "abc"),
+		"failed stack must not be considered succeeded")
+	assert.IsTrue(t, !got.Succeeded("/stack-c", []string{"echo", "c"}, "abc"),
+		"unknown stack must not be considered succeeded")
+}
+
+func TestDirInsideGitRepository(t *testing.T) {
+	t.Parallel()
+
+	repodir := test.TempDir(t)
+	assert.NoError(t, os.MkdirAll(filepath.Join(repodir, ".git"), 0755))
+
+	rootdir := filepath.Join(repodir, "project")
+	assert.NoError(t, os.MkdirAll(rootdir, 0755))
+
+	assert.EqualStrings(t,
+		filepath.Join(repodir, ".git", "terramate", "run"),
+		state.Dir(rootdir))
+}
+
+func TestDirInsideGitWorktree(t *testing.T) {
+	t.Parallel()
+
+	rootdir := test.TempDir(t)
+	gitdir := filepath.Join(test.TempDir(t), "worktrees", "project")
+	test.WriteFile(t, rootdir, ".git", "gitdir: "+gitdir+"\n")
+
+	assert.EqualStrings(t,
+		filepath.Join(gitdir, "terramate", "run"),
+		state.Dir(rootdir))
+}
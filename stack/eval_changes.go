@@ -0,0 +1,250 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package stack
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/git"
+	"github.com/terramate-io/terramate/globals"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// GeneratedCodeLoader loads the code generated for a stack of the given
+// configuration, mapping the name of each generated file to its content.
+type GeneratedCodeLoader func(root *config.Root, st *config.Stack) (map[string]string, error)
+
+// TrackEvaluationChanges makes ListChanged also consider a stack changed when
+// its globals, or the code generated for it as loaded by loadCode, differ
+// between the gitBaseRef and the current configuration. The stacks are only
+// evaluated if any Terramate configuration file changed. The loadCode is
+// optional.
+func (m *Manager) TrackEvaluationChanges(loadCode GeneratedCodeLoader) {
+	m.evalChanges = true
+	m.generatedCode = loadCode
+}
+
+// loadBaseRoot loads the configuration of the project at the gitBaseRef into a
+// temporary directory. The returned cleanup function removes the directory.
+// If the configuration at the gitBaseRef is invalid, it returns a nil root.
+func (m *Manager) loadBaseRoot() (root *config.Root, cleanup func(), err error) {
+	logger := log.With().
+		Str("action", "loadBaseRoot()").
+		Str("baseRef", m.gitBaseRef).
+		Logger()
+
+	gOuter, err := m.globalGit()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	g, err := git.WithConfig(git.Config{
+		WorkingDir: m.root.HostDir(),
+		GlobalArgs: setupInheritedGitConfigArgs(gOuter),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	toplevel, err := g.Root()
+	if err != nil {
+		return nil, nil, errors.E(err, "getting the repository root")
+	}
+
+	prjdir, err := filepath.Rel(toplevel, m.root.HostDir())
+	if err != nil {
+		return nil, nil, errors.E(err, "computing project dir inside the repository")
+	}
+
+	tmpdir, err := os.MkdirTemp("", "terramate-base-ref")
+	if err != nil {
+		return nil, nil, errors.E(err, "creating directory for the base ref")
+	}
+	cleanup = func() {
+		if err := os.RemoveAll(tmpdir); err != nil {
+			logger.Warn().Err(err).Msg("removing base ref directory")
+		}
+	}
+
+	if err := g.ExportTree(m.gitBaseRef, tmpdir); err != nil {
+		cleanup()
+		return nil, nil, errors.E(err, "exporting the files of %s", m.gitBaseRef)
+	}
+
+	// the temporary directory may be a symlink, as in macOS.
+	basedir, err := filepath.EvalSymlinks(filepath.Join(tmpdir, prjdir))
+	if err != nil {
+		logger.Debug().Err(err).Msg("project dir does not exist at base ref")
+		return nil, cleanup, nil
+	}
+
+	root, err = config.LoadRoot(basedir)
+	if err != nil {
+		logger.Warn().Err(err).Msg("ignoring the changes of globals and generated code " +
+			"because the configuration at the base ref is invalid")
+		return nil, cleanup, nil
+	}
+
+	// the base configuration is evaluated as if it was at the project dir, so
+	// the values derived from the project path can be compared.
+	root.SetRuntimeHostDir(m.root.HostDir())
+	return root, cleanup, nil
+}
+
+// evaluationChanged tells if the globals or the generated code of the stack
+// changed since the base configuration, returning the reason of the change.
+// Stacks failing evaluation, at the gitBaseRef or currently, are not
+// considered changed.
+func (m *Manager) evaluationChanged(base *config.Root, st *config.Stack) (string, bool) {
+	logger := log.With().
+		Str("action", "evaluationChanged()").
+		Stringer("stack", st).
+		Logger()
+
+	baseTree, ok := base.Lookup(st.Dir)
+	if !ok || !baseTree.IsStack() {
+		// new stacks are detected by their changed files.
+		return "", false
+	}
+
+	baseStack, err := config.NewStackFromHCL(base.HostDir(), baseTree.Node)
+	if err != nil {
+		logger.Debug().Err(err).Msg("ignoring invalid stack at base ref")
+		return "", false
+	}
+
+	headGlobals := globals.ForStack(m.root, st)
+	if err := headGlobals.AsError(); err != nil {
+		logger.Warn().Err(err).Msg("ignoring the changes of globals and generated code " +
+			"because the globals of the stack failed to evaluate")
+		return "", false
+	}
+
+	baseGlobals := globals.ForStack(base, baseStack)
+	if err := baseGlobals.AsError(); err != nil {
+		logger.Debug().Err(err).Msg("ignoring globals failing at base ref")
+		return "", false
+	}
+
+	globalPath, changed := diffGlobals("",
+		baseGlobals.Globals.AsValueMap(),
+		headGlobals.Globals.AsValueMap(),
+	)
+	if changed {
+		return fmt.Sprintf("stack changed because global %q changed", globalPath), true
+	}
+
+	if m.generatedCode == nil {
+		return "", false
+	}
+
+	headCode, err := m.generatedCode(m.root, st)
+	if err != nil {
+		logger.Warn().Err(err).Msg("ignoring the changes of generated code " +
+			"because the code of the stack failed to generate")
+		return "", false
+	}
+
+	baseCode, err := m.generatedCode(base, baseStack)
+	if err != nil {
+		logger.Debug().Err(err).Msg("ignoring generated code failing at base ref")
+		return "", false
+	}
+
+	if name, ok := diffGeneratedCode(baseCode, headCode); ok {
+		return fmt.Sprintf("stack changed because generated file %q changed", name), true
+	}
+	return "", false
+}
+
+// diffGlobals returns the path of the first global, in lexicographic order,
+// which differs between base and head.
+func diffGlobals(prefix string, base, head map[string]cty.Value) (string, bool) {
+	for _, name := range sortedKeys(base, head) {
+		globalPath := name
+		if prefix != "" {
+			globalPath = prefix + "." + name
+		}
+
+		baseVal, baseOK := base[name]
+		headVal, headOK := head[name]
+		if !baseOK || !headOK {
+			return globalPath, true
+		}
+
+		if isObject(baseVal) && isObject(headVal) {
+			changedPath, changed := diffGlobals(globalPath,
+				baseVal.AsValueMap(), headVal.AsValueMap())
+			if changed {
+				return changedPath, true
+			}
+			continue
+		}
+
+		if !baseVal.RawEquals(headVal) {
+			return globalPath, true
+		}
+	}
+	return "", false
+}
+
+// diffGeneratedCode returns the name of the first generated file, in
+// lexicographic order, which differs between base and head.
+func diffGeneratedCode(base, head map[string]string) (string, bool) {
+	names := make([]string, 0, len(base)+len(head))
+	for name := range base {
+		names = append(names, name)
+	}
+	for name := range head {
+		if _, ok := base[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		baseCode, baseOK := base[name]
+		headCode, headOK := head[name]
+		if baseOK != headOK || baseCode != headCode {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// hasChangedConfigFiles tells if any of the changed files is a Terramate
+// configuration file.
+func hasChangedConfigFiles(changedFiles []string) bool {
+	for _, file := range changedFiles {
+		if strings.HasSuffix(file, ".tm") || strings.HasSuffix(file, ".tm.hcl") {
+			return true
+		}
+	}
+	return false
+}
+
+func isObject(val cty.Value) bool {
+	return val.Type().IsObjectType() && val.IsKnown() && !val.IsNull()
+}
+
+func sortedKeys(base, head map[string]cty.Value) []string {
+	keys := make([]string, 0, len(base)+len(head))
+	for key := range base {
+		keys = append(keys, key)
+	}
+	for key := range head {
+		if _, ok := base[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/terramate-io/terramate/config"
 	"github.com/terramate-io/terramate/errors"
 	"github.com/terramate-io/terramate/git"
+	"github.com/terramate-io/terramate/modvendor"
 	"github.com/terramate-io/terramate/project"
 	"github.com/terramate-io/terramate/run"
 	"github.com/terramate-io/terramate/run/dag"
@@ -29,6 +30,24 @@ type (
 		root       *config.Root // whole config
 		gitBaseRef string       // gitBaseRef is the git ref where we compare changes.
 
+		// includeWorktree tells if the uncommitted changes of the working
+		// tree are also considered changes.
+		includeWorktree bool
+
+		// fileReads loads the files read during the evaluation of a stack,
+		// if the files read are tracked.
+		fileReads FileReadsLoader
+
+		// evalChanges tells if the changes of the globals and of the
+		// generated code, loaded by generatedCode, are tracked.
+		evalChanges   bool
+		generatedCode GeneratedCodeLoader
+
+		// vendorDir is the project directory of the vendored modules, used
+		// to follow remote module sources. If empty, the remote module
+		// sources are not followed.
+		vendorDir project.Path
+
 		outerGit *git.Git
 	}
 
@@ -36,6 +55,10 @@ type (
 	Report struct {
 		Stacks []Entry
 
+		// Disabled are the changed stacks which are not in Stacks because
+		// they are disabled. Only set when listing changed stacks.
+		Disabled []Entry
+
 		// Checks contains the result info of default checks.
 		Checks RepoChecks
 	}
@@ -46,6 +69,19 @@ type (
 		UntrackedFiles   []string
 	}
 
+	// FileRead is a file read during the evaluation of a stack.
+	FileRead struct {
+		// Path is the file read, or the glob pattern of the files read by
+		// tm_fileset.
+		Path project.Path
+
+		// By describes what read the file, like `generate_file "main.tf"`.
+		By string
+	}
+
+	// FileReadsLoader loads the files read during the evaluation of a stack.
+	FileReadsLoader func(st *config.Stack) ([]FileRead, error)
+
 	// Entry is a stack entry result.
 	Entry struct {
 		Stack  *config.Stack
@@ -65,6 +101,27 @@ func NewManager(root *config.Root, gitBaseRef string) *Manager {
 	}
 }
 
+// IncludeWorktree sets if ListChanged also considers the staged, unstaged and
+// untracked files of the git working tree as changed, besides the changes
+// committed since the gitBaseRef.
+func (m *Manager) IncludeWorktree(include bool) {
+	m.includeWorktree = include
+}
+
+// TrackFileReads makes ListChanged also consider a stack changed when any of
+// the files read during its evaluation, as loaded by the given loader, changed.
+func (m *Manager) TrackFileReads(loader FileReadsLoader) {
+	m.fileReads = loader
+}
+
+// FollowVendoredModules makes ListChanged also follow the remote module
+// sources vendored inside the vendorDir, so a stack is considered changed
+// when the vendored copy of any module it uses, directly or indirectly,
+// changed. The remote sources not vendored are still assumed unchanged.
+func (m *Manager) FollowVendoredModules(vendorDir project.Path) {
+	m.vendorDir = vendorDir
+}
+
 // List walks the basedir directory looking for terraform stacks.
 // It returns a lexicographic sorted list of stack directories.
 func (m *Manager) List() (*Report, error) {
@@ -135,7 +192,7 @@ func (m *Manager) ListChanged() (*Report, error) {
 		return nil, errors.E(errListChanged, err)
 	}
 
-	changedFiles, err := m.listChangedFiles(m.root.HostDir(), m.gitBaseRef)
+	changedFiles, uncommitted, err := m.listChangedFiles(m.root.HostDir(), m.gitBaseRef)
 	if err != nil {
 		return nil, errors.E(errListChanged, err)
 	}
@@ -215,9 +272,18 @@ func (m *Manager) ListChanged() (*Report, error) {
 			return nil, errors.E(errListChanged, err)
 		}
 
+		reason := "stack has unmerged changes"
+		if uncommitted[path] {
+			reason = "stack has uncommitted changes"
+			if _, ok := stackSet[s.Dir]; ok {
+				// committed changes take precedence over uncommitted ones.
+				continue
+			}
+		}
+
 		stackSet[s.Dir] = Entry{
 			Stack:  s,
-			Reason: "stack has unmerged changes",
+			Reason: reason,
 		}
 	}
 
@@ -226,6 +292,18 @@ func (m *Manager) ListChanged() (*Report, error) {
 		return nil, errors.E(errListChanged, "searching for stacks", err)
 	}
 
+	var baseRoot *config.Root
+	if m.evalChanges && hasChangedConfigFiles(changedFiles) {
+		var cleanup func()
+		baseRoot, cleanup, err = m.loadBaseRoot()
+		if err != nil {
+			logger.Warn().Err(err).Msg("ignoring the changes of globals and generated code " +
+				"because the configuration at the base ref failed to load")
+		} else {
+			defer cleanup()
+		}
+	}
+
 rangeStacks:
 	for _, stackEntry := range allstacks {
 		stack := stackEntry.Stack
@@ -250,6 +328,52 @@ rangeStacks:
 			continue rangeStacks
 		}
 
+		if m.fileReads != nil && len(changedFiles) > 0 {
+			reads, err := m.fileReads(stack)
+			if err != nil {
+				// the evaluation errors of the stack are reported by the
+				// commands which need it, like generate.
+				logger.Warn().
+					Err(err).
+					Stringer("stack", stack).
+					Msg("ignoring the files read by the stack because its evaluation failed")
+			}
+
+			if read, file, ok := hasChangedFileReads(reads, changedFiles); ok {
+				logger.Debug().
+					Stringer("stack", stack).
+					Str("file", file).
+					Str("readBy", read.By).
+					Msg("changed.")
+
+				stack.IsChanged = true
+				stackSet[stack.Dir] = Entry{
+					Stack: stack,
+					Reason: fmt.Sprintf(
+						"stack changed because %s read by %s changed",
+						file, read.By,
+					),
+				}
+				continue rangeStacks
+			}
+		}
+
+		if baseRoot != nil {
+			if reason, changed := m.evaluationChanged(baseRoot, stack); changed {
+				logger.Debug().
+					Stringer("stack", stack).
+					Str("reason", reason).
+					Msg("changed.")
+
+				stack.IsChanged = true
+				stackSet[stack.Dir] = Entry{
+					Stack:  stack,
+					Reason: reason,
+				}
+				continue rangeStacks
+			}
+		}
+
 		err := m.filesApply(stack.HostDir(m.root), func(file fs.DirEntry) error {
 			if path.Ext(file.Name()) != ".tf" {
 				return nil
@@ -294,15 +418,28 @@ rangeStacks:
 	}
 
 	changedStacks := make([]Entry, 0, len(stackSet))
-	for _, stack := range stackSet {
-		changedStacks = append(changedStacks, stack)
+	var disabledStacks []Entry
+	for _, entry := range stackSet {
+		if entry.Stack.Disabled {
+			log.Debug().
+				Str("action", "ListChanged()").
+				Stringer("stack", entry.Stack).
+				Msg("ignoring changed stack because it is disabled")
+
+			entry.Reason = "disabled: " + entry.Reason
+			disabledStacks = append(disabledStacks, entry)
+			continue
+		}
+		changedStacks = append(changedStacks, entry)
 	}
 
 	sort.Sort(EntrySlice(changedStacks))
+	sort.Sort(EntrySlice(disabledStacks))
 
 	return &Report{
-		Checks: checks,
-		Stacks: changedStacks,
+		Checks:   checks,
+		Stacks:   changedStacks,
+		Disabled: disabledStacks,
 	}, nil
 }
 
@@ -385,6 +522,78 @@ func (m *Manager) AddWantedOf(scopeStacks config.List[*config.SortableStack]) (c
 	return selectedStacks, nil
 }
 
+// AddDependenciesOf returns the given stacks together with all the stacks
+// which must run before them, directly or transitively, as defined by the
+// after/before clauses.
+func (m *Manager) AddDependenciesOf(scopeStacks config.List[*config.SortableStack]) (config.List[*config.SortableStack], error) {
+	return m.addOrderRelated(scopeStacks, (*dag.DAG).TransitiveAncestorsOf)
+}
+
+// AddDependentsOf returns the given stacks together with all the stacks
+// which must run after them, directly or transitively, as defined by the
+// after/before clauses.
+func (m *Manager) AddDependentsOf(scopeStacks config.List[*config.SortableStack]) (config.List[*config.SortableStack], error) {
+	return m.addOrderRelated(scopeStacks, (*dag.DAG).TransitiveDescendantsOf)
+}
+
+func (m *Manager) addOrderRelated(
+	scopeStacks config.List[*config.SortableStack],
+	related func(d *dag.DAG, id dag.ID) []dag.ID,
+) (config.List[*config.SortableStack], error) {
+	orderDag := dag.New()
+	allstacks, err := config.LoadAllStacks(m.root.Tree())
+	if err != nil {
+		return nil, errors.E(err, "loading all stacks")
+	}
+
+	visited := dag.Visited{}
+	sort.Sort(allstacks)
+	for _, elem := range allstacks {
+		err := run.BuildDAG(
+			orderDag,
+			m.root,
+			elem.Stack,
+			"before",
+			func(s config.Stack) []string { return s.Before },
+			"after",
+			func(s config.Stack) []string { return s.After },
+			visited,
+		)
+
+		if err != nil {
+			return nil, errors.E(err, "building run order DAG")
+		}
+	}
+
+	reason, err := orderDag.Validate()
+	if err != nil {
+		return nil, errors.E(err, "validating run order DAG: %s", reason)
+	}
+
+	selectedStacks := make(config.List[*config.SortableStack], 0, len(scopeStacks))
+	visited = dag.Visited{}
+	for _, s := range scopeStacks {
+		visited[dag.ID(s.Dir().String())] = struct{}{}
+		selectedStacks = append(selectedStacks, s)
+	}
+
+	for _, s := range scopeStacks {
+		for _, id := range related(orderDag, dag.ID(s.Dir().String())) {
+			if _, ok := visited[id]; ok {
+				continue
+			}
+			visited[id] = struct{}{}
+
+			node, err := orderDag.Node(id)
+			if err != nil {
+				return nil, errors.E(err, "stack %s not found in the run order DAG", id)
+			}
+			selectedStacks = append(selectedStacks, node.(*config.Stack).Sortable())
+		}
+	}
+	return selectedStacks, nil
+}
+
 func (m *Manager) filesApply(dir string, apply func(file fs.DirEntry) error) (err error) {
 	f, err := os.Open(dir)
 	if err != nil {
@@ -425,23 +634,12 @@ func (m *Manager) moduleChanged(
 		return false, "", nil
 	}
 
-	if !mod.IsLocal() {
-		// if the source is a remote path (URL, VCS path, S3 bucket, etc) then
-		// we assume it's not changed.
-		return false, "", nil
-	}
-
-	modPath := filepath.Join(basedir, mod.Source)
-
-	st, err := os.Stat(modPath)
-
-	// TODO(i4k): resolve symlinks
-
-	if err != nil || !st.IsDir() {
-		return false, "", errors.E("\"source\" path %q is not a directory", modPath)
+	modPath, desc, ok, err := m.modulePath(mod, basedir)
+	if err != nil || !ok {
+		return false, "", err
 	}
 
-	changedFiles, err := m.listChangedFiles(modPath, m.gitBaseRef)
+	changedFiles, uncommitted, err := m.listChangedFiles(modPath, m.gitBaseRef)
 	if err != nil {
 		return false, "", errors.E(err,
 			"listing changes in the module %q",
@@ -449,7 +647,10 @@ func (m *Manager) moduleChanged(
 	}
 
 	if len(changedFiles) > 0 {
-		return true, fmt.Sprintf("module %q has unmerged changes", mod.Source), nil
+		if len(uncommitted) == len(changedFiles) {
+			return true, fmt.Sprintf("module %s has uncommitted changes", desc), nil
+		}
+		return true, fmt.Sprintf("module %s has unmerged changes", desc), nil
 	}
 
 	visited[mod.Source] = true
@@ -488,23 +689,80 @@ func (m *Manager) moduleChanged(
 		return false, "", err
 	}
 
-	return changed, fmt.Sprintf("module %q changed because %s", mod.Source, why), nil
+	return changed, fmt.Sprintf("module %s changed because %s", desc, why), nil
+}
+
+// modulePath returns the host path of the module source and its description
+// for the change reasons. The local sources are relative to basedir and the
+// remote sources are looked up in the vendor directory. It returns false if
+// the module is not a local source nor a vendored one.
+func (m *Manager) modulePath(mod tf.Module, basedir string) (modPath string, desc string, ok bool, err error) {
+	if mod.IsLocal() {
+		modPath = filepath.Join(basedir, mod.Source)
+
+		st, err := os.Stat(modPath)
+
+		// TODO(i4k): resolve symlinks
+
+		if err != nil || !st.IsDir() {
+			return "", "", false, errors.E("\"source\" path %q is not a directory", modPath)
+		}
+		return modPath, fmt.Sprintf("%q", mod.Source), true, nil
+	}
+
+	if m.vendorDir.String() == "" {
+		// if the source is a remote path (URL, VCS path, S3 bucket, etc) then
+		// we assume it's not changed.
+		return "", "", false, nil
+	}
+
+	// only the git sources can be vendored, then the registry, S3, etc
+	// sources are assumed unchanged.
+	modsrc, err := tf.ParseSource(mod.Source)
+	if err != nil {
+		log.Debug().
+			Str("action", "modulePath()").
+			Str("source", mod.Source).
+			Err(err).
+			Msg("ignoring module source which cannot be vendored")
+		return "", "", false, nil
+	}
+
+	vendoredDir := modvendor.TargetDir(m.vendorDir, modsrc)
+	modPath = filepath.Join(
+		modvendor.AbsVendorDir(m.root.HostDir(), m.vendorDir, modsrc),
+		filepath.FromSlash(modsrc.Subdir),
+	)
+
+	st, err := os.Stat(modPath)
+	if err != nil || !st.IsDir() {
+		log.Debug().
+			Str("action", "modulePath()").
+			Str("source", mod.Source).
+			Str("vendoredDir", vendoredDir.String()).
+			Msg("ignoring remote module source which is not vendored")
+		return "", "", false, nil
+	}
+	return modPath, fmt.Sprintf("%q vendored at %s", mod.Source, vendoredDir), true, nil
 }
 
 // listChangedFiles lists all changed files in the dir directory.
-func (m *Manager) listChangedFiles(dir string, gitBaseRef string) ([]string, error) {
+// If the manager includes the working tree, the staged, unstaged and untracked
+// files are also listed, and the uncommitted set tells which of the files are
+// changed only in the working tree.
+func (m *Manager) listChangedFiles(dir string, gitBaseRef string) (files []string, uncommitted map[string]bool, err error) {
 	st, err := os.Stat(dir)
 	if err != nil {
-		return nil, errors.E(err, "stat failed on %q", dir)
+		return nil, nil, errors.E(err, "stat failed on %q", dir)
 	}
 
 	if !st.IsDir() {
-		return nil, errors.E("is not a directory")
+		return nil, nil, errors.E("is not a directory")
 	}
 
 	gOuter, err := m.globalGit()
 	if err != nil {
-		return nil, errors.E(errListChanged, err)
+		return nil, nil, errors.E(errListChanged, err)
 	}
 
 	globalArgs := setupInheritedGitConfigArgs(gOuter)
@@ -514,24 +772,69 @@ func (m *Manager) listChangedFiles(dir string, gitBaseRef string) ([]string, err
 		GlobalArgs: globalArgs,
 	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	baseRef, err := g.RevParse(gitBaseRef)
 	if err != nil {
-		return nil, errors.E(err, "getting revision %q", gitBaseRef)
+		return nil, nil, errors.E(err, "getting revision %q", gitBaseRef)
 	}
 
 	headRef, err := g.RevParse("HEAD")
 	if err != nil {
-		return nil, errors.E(err, "getting HEAD revision")
+		return nil, nil, errors.E(err, "getting HEAD revision")
+	}
+
+	files = []string{}
+	if baseRef != headRef {
+		files, err = g.DiffNames(baseRef, headRef)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if !m.includeWorktree {
+		return files, nil, nil
+	}
+
+	worktreeFiles, err := listWorktreeFiles(g)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	committed := make(map[string]bool, len(files))
+	for _, file := range files {
+		committed[file] = true
+	}
+
+	uncommitted = map[string]bool{}
+	for _, file := range worktreeFiles {
+		if committed[file] || uncommitted[file] {
+			continue
+		}
+		uncommitted[file] = true
+		files = append(files, file)
+	}
+	return files, uncommitted, nil
+}
+
+// listWorktreeFiles lists the staged, unstaged and untracked files of the
+// working tree.
+func listWorktreeFiles(g *git.Git) ([]string, error) {
+	staged, err := g.ListStaged()
+	if err != nil {
+		return nil, errors.E(err, "listing staged files")
 	}
 
-	if baseRef == headRef {
-		return []string{}, nil
+	checks, err := checkRepoIsClean(g)
+	if err != nil {
+		return nil, err
 	}
 
-	return g.DiffNames(baseRef, headRef)
+	files := staged
+	files = append(files, checks.UncommittedFiles...)
+	files = append(files, checks.UntrackedFiles...)
+	return files, nil
 }
 
 func (m *Manager) globalGit() (*git.Git, error) {
@@ -548,7 +851,7 @@ func (m *Manager) globalGit() (*git.Git, error) {
 func hasChangedWatchedFiles(stack *config.Stack, changedFiles []string) (project.Path, bool) {
 	for _, watchFile := range stack.Watch {
 		for _, file := range changedFiles {
-			if file == watchFile.String()[1:] { // project paths
+			if config.WatchMatches(watchFile, file) {
 				return watchFile, true
 			}
 		}
@@ -556,6 +859,17 @@ func hasChangedWatchedFiles(stack *config.Stack, changedFiles []string) (project
 	return project.Path{}, false
 }
 
+func hasChangedFileReads(reads []FileRead, changedFiles []string) (FileRead, string, bool) {
+	for _, read := range reads {
+		for _, file := range changedFiles {
+			if config.WatchMatches(read.Path, file) {
+				return read, file, true
+			}
+		}
+	}
+	return FileRead{}, "", false
+}
+
 func checkRepoIsClean(g *git.Git) (RepoChecks, error) {
 	untracked, err := g.ListUntracked()
 	if err != nil {
@@ -11,9 +11,11 @@ import (
 
 	"github.com/madlambda/spells/assert"
 	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/errors"
 	"github.com/terramate-io/terramate/project"
 	"github.com/terramate-io/terramate/stack"
 	"github.com/terramate-io/terramate/test"
+	"github.com/terramate-io/terramate/test/sandbox"
 )
 
 type repository struct {
@@ -193,6 +195,182 @@ func TestListChangedStackReason(t *testing.T) {
 	}
 }
 
+func TestListChangedIgnoresDisabledStacks(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"s:stacks/enabled",
+		"s:stacks/disabled",
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+	git.CheckoutNew("change")
+
+	test.WriteFile(t, filepath.Join(s.RootDir(), "stacks", "disabled"), stack.DefaultFilename, `
+stack {
+  disabled = true
+}
+`)
+	test.WriteFile(t, filepath.Join(s.RootDir(), "stacks", "enabled"), "main.tf", "# changed")
+	git.CommitAll("change stacks")
+
+	m := newManager(t, s.RootDir())
+	report, err := m.ListChanged()
+	assert.NoError(t, err)
+
+	assertStacks(t, []string{"/stacks/enabled"}, report.Stacks, true)
+	assertStacks(t, []string{"/stacks/disabled"}, report.Disabled, true)
+	assert.EqualStrings(t, "disabled: stack has unmerged changes", report.Disabled[0].Reason)
+}
+
+func TestListChangedIncludesWorktree(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"s:stacks/committed",
+		"s:stacks/staged",
+		"s:stacks/unstaged",
+		"s:stacks/untracked",
+		"s:stacks/unchanged",
+		"f:stacks/staged/main.tf:# staged",
+		"f:stacks/unstaged/main.tf:# unstaged",
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+	git.CheckoutNew("change")
+
+	test.WriteFile(t, filepath.Join(s.RootDir(), "stacks", "committed"), "main.tf", "# committed")
+	git.CommitAll("change committed stack")
+
+	stagedFile := test.WriteFile(t, filepath.Join(s.RootDir(), "stacks", "staged"), "main.tf", "# changed")
+	git.Add(stagedFile)
+	test.WriteFile(t, filepath.Join(s.RootDir(), "stacks", "unstaged"), "main.tf", "# changed")
+	test.WriteFile(t, filepath.Join(s.RootDir(), "stacks", "untracked"), "main.tf", "# new")
+
+	m := newManager(t, s.RootDir())
+	report, err := m.ListChanged()
+	assert.NoError(t, err)
+	assertStacks(t, []string{"/stacks/committed"}, report.Stacks, true)
+
+	m.IncludeWorktree(true)
+	report, err = m.ListChanged()
+	assert.NoError(t, err)
+	assertStacks(t, []string{
+		"/stacks/committed",
+		"/stacks/staged",
+		"/stacks/unstaged",
+		"/stacks/untracked",
+	}, report.Stacks, true)
+
+	assert.EqualStrings(t, "stack has unmerged changes", report.Stacks[0].Reason)
+	for _, entry := range report.Stacks[1:] {
+		assert.EqualStrings(t, "stack has uncommitted changes", entry.Reason)
+	}
+}
+
+func TestListChangedTracksFileReads(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"s:stacks/a",
+		"s:stacks/b",
+		"f:shared/file.txt:content",
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+	git.CheckoutNew("change")
+
+	test.WriteFile(t, filepath.Join(s.RootDir(), "shared"), "file.txt", "changed")
+	git.CommitAll("change shared file")
+
+	m := newManager(t, s.RootDir())
+	report, err := m.ListChanged()
+	assert.NoError(t, err)
+	assertStacks(t, []string{}, report.Stacks, true)
+
+	m.TrackFileReads(func(st *config.Stack) ([]stack.FileRead, error) {
+		if st.Dir.String() == "/stacks/a" {
+			// stacks failing evaluation are handled as having no reads.
+			return nil, errors.E("evaluation failed")
+		}
+		return []stack.FileRead{
+			{
+				Path: project.NewPath("/shared/file.txt"),
+				By:   `generate_file "file.txt"`,
+			},
+		}, nil
+	})
+	report, err = m.ListChanged()
+	assert.NoError(t, err)
+	assertStacks(t, []string{"/stacks/b"}, report.Stacks, true)
+	assert.EqualStrings(t,
+		`stack changed because shared/file.txt read by generate_file "file.txt" changed`,
+		report.Stacks[0].Reason)
+}
+
+func TestListChangedFollowsVendoredModules(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"s:stacks/a",
+		"s:stacks/b",
+		"s:stacks/c",
+		`f:stacks/a/main.tf:module "local" {
+		  source = "../../modules/local"
+		}`,
+		`f:stacks/b/main.tf:module "remote" {
+		  source = "github.com/terramate-io/other//sub?ref=v2"
+		}`,
+		`f:stacks/c/main.tf:module "not_vendored" {
+		  source = "github.com/terramate-io/missing?ref=v1"
+		}`,
+		`f:modules/local/main.tf:module "remote" {
+		  source = "git::https://example.com/terramate-io/mod.git?ref=v1"
+		}`,
+		"f:vendor/example.com/terramate-io/mod/v1/main.tf:# v1",
+		"f:vendor/github.com/terramate-io/other/v2/sub/main.tf:# v2",
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+	git.CheckoutNew("change")
+
+	test.WriteFile(t, filepath.Join(s.RootDir(), "vendor/example.com/terramate-io/mod/v1"),
+		"main.tf", "# patched")
+	test.WriteFile(t, filepath.Join(s.RootDir(), "vendor/github.com/terramate-io/other/v2/sub"),
+		"main.tf", "# patched")
+	git.CommitAll("patch vendored modules")
+
+	m := newManager(t, s.RootDir())
+	report, err := m.ListChanged()
+	assert.NoError(t, err)
+	assertStacks(t, []string{}, report.Stacks, true)
+
+	m.FollowVendoredModules(project.NewPath("/vendor"))
+	report, err = m.ListChanged()
+	assert.NoError(t, err)
+	assertStacks(t, []string{"/stacks/a", "/stacks/b"}, report.Stacks, true)
+	assert.EqualStrings(t,
+		`stack changed because "../../modules/local" changed because `+
+			`module "../../modules/local" changed because `+
+			`../../modules/local changed because `+
+			`module "git::https://example.com/terramate-io/mod.git?ref=v1" `+
+			`vendored at /vendor/example.com/terramate-io/mod/v1 has unmerged changes `,
+		report.Stacks[0].Reason)
+	assert.EqualStrings(t,
+		`stack changed because "github.com/terramate-io/other//sub?ref=v2" changed because `+
+			`module "github.com/terramate-io/other//sub?ref=v2" `+
+			`vendored at /vendor/github.com/terramate-io/other/v2 has unmerged changes`,
+		report.Stacks[1].Reason)
+}
+
 func assertStacks(
 	t *testing.T, want []string, got []stack.Entry, wantReason bool,
 ) {
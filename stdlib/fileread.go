@@ -0,0 +1,97 @@
+// Copyright 2023 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package stdlib
+
+import (
+	"path/filepath"
+
+	"github.com/terramate-io/terramate/hcl/eval"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// FileReadFunc is called with the absolute path of each file read by the
+// filesystem functions. For tm_fileset, it's called with the absolute glob
+// pattern of the files.
+type FileReadFunc func(path string)
+
+// fileReadFuncNames are the functions which read the file given in their first
+// argument.
+var fileReadFuncNames = []string{
+	"tm_file",
+	"tm_fileexists",
+	"tm_filebase64",
+	"tm_filebase64sha256",
+	"tm_filebase64sha512",
+	"tm_filemd5",
+	"tm_filesha1",
+	"tm_filesha256",
+	"tm_filesha512",
+	"tm_templatefile",
+}
+
+// TrackFileReads replaces the filesystem functions of the evaluation context
+// with functions reporting the files they read to onRead. Relative paths are
+// resolved from basedir, which must be the base directory of the functions.
+func TrackFileReads(evalctx *eval.Context, basedir string, onRead FileReadFunc) {
+	funcs := evalctx.Unwrap().Functions
+	for _, name := range fileReadFuncNames {
+		fn, ok := funcs[name]
+		if !ok {
+			continue
+		}
+		evalctx.SetFunction(name, trackFileRead(fn, func(args []cty.Value) {
+			if p, ok := stringArg(args, 0); ok {
+				onRead(absPath(basedir, p))
+			}
+		}))
+	}
+
+	if fn, ok := funcs["tm_fileset"]; ok {
+		evalctx.SetFunction("tm_fileset", trackFileRead(fn, func(args []cty.Value) {
+			dir, ok := stringArg(args, 0)
+			if !ok {
+				return
+			}
+			pattern, ok := stringArg(args, 1)
+			if !ok {
+				return
+			}
+			onRead(filepath.Join(absPath(basedir, dir), pattern))
+		}))
+	}
+}
+
+// trackFileRead wraps fn so track is called with the arguments of each call.
+func trackFileRead(fn function.Function, track func(args []cty.Value)) function.Function {
+	return function.New(&function.Spec{
+		Params:   fn.Params(),
+		VarParam: fn.VarParam(),
+		Type: func(args []cty.Value) (cty.Type, error) {
+			return fn.ReturnTypeForValues(args)
+		},
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			track(args)
+			return fn.Call(args)
+		},
+	})
+}
+
+func stringArg(args []cty.Value, index int) (string, bool) {
+	if index >= len(args) {
+		return "", false
+	}
+	arg, _ := args[index].Unmark()
+	if !arg.IsKnown() || arg.IsNull() || arg.Type() != cty.String {
+		return "", false
+	}
+	return arg.AsString(), true
+}
+
+func absPath(basedir, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(basedir, path)
+}
@@ -297,6 +297,67 @@ func TestStdlibTmVersionMatch(t *testing.T) {
 	}
 }
 
+func TestStdlibTrackFileReads(t *testing.T) {
+	t.Parallel()
+
+	type testcase struct {
+		expr string
+		want []string
+	}
+
+	for _, tc := range []testcase{
+		{
+			expr: `tm_file("file.txt")`,
+			want: []string{"file.txt"},
+		},
+		{
+			expr: `tm_filesha256("dir/file.yaml")`,
+			want: []string{"dir/file.yaml"},
+		},
+		{
+			expr: `tm_templatefile("template.tpl", {name = "world"})`,
+			want: []string{"template.tpl"},
+		},
+		{
+			expr: `tm_fileset("dir", "*.yaml")`,
+			want: []string{"dir/*.yaml"},
+		},
+		{
+			expr: `tm_fileexists("non-existent.txt")`,
+			want: []string{"non-existent.txt"},
+		},
+		{
+			expr: `[tm_file("file.txt"), tm_upper("file.txt"), tm_file("dir/file.yaml")]`,
+			want: []string{"file.txt", "dir/file.yaml"},
+		},
+	} {
+		tc := tc
+		t.Run(tc.expr, func(t *testing.T) {
+			t.Parallel()
+
+			rootdir := test.TempDir(t)
+			test.WriteFile(t, rootdir, "file.txt", "file")
+			test.WriteFile(t, rootdir, "template.tpl", "hello ${name}")
+			test.WriteFile(t, filepath.Join(rootdir, "dir"), "file.yaml", "yaml")
+
+			var got []string
+			ctx := eval.NewContext(stdlib.Functions(rootdir))
+			stdlib.TrackFileReads(ctx, rootdir, func(path string) {
+				relpath, err := filepath.Rel(rootdir, path)
+				assert.NoError(t, err)
+				got = append(got, filepath.ToSlash(relpath))
+			})
+
+			_, err := ctx.Eval(test.NewExpr(t, tc.expr))
+			assert.NoError(t, err)
+			assert.EqualInts(t, len(tc.want), len(got), "files read: %v", got)
+			for i, want := range tc.want {
+				assert.EqualStrings(t, want, got[i])
+			}
+		})
+	}
+}
+
 func TestStdlibNewFunctionsMustPanicIfRelativeBaseDir(t *testing.T) {
 	defer func() {
 		err := recover()
@@ -69,6 +69,7 @@ func AssertTerramateConfig(t *testing.T, got, want hcl.Config) {
 	assertGenHCLBlocks(t, got.Generate.HCLs, want.Generate.HCLs)
 	assertGenFileBlocks(t, got.Generate.Files, want.Generate.Files)
 	assertScriptBlocks(t, got.Scripts, want.Scripts)
+	assertRunBlock(t, got.Run, want.Run)
 }
 
 // AssertDiff will compare the two values and fail if they are not the same
@@ -240,6 +241,12 @@ func assertTerramateConfigBlock(t *testing.T, got, want *hcl.RootConfig) {
 		}
 	}
 
+	if (want.ChangeDetection == nil) != (got.ChangeDetection == nil) ||
+		(want.ChangeDetection != nil && *want.ChangeDetection != *got.ChangeDetection) {
+		t.Fatalf("want.ChangeDetection[%+v] != got.ChangeDetection[%+v]",
+			want.ChangeDetection, got.ChangeDetection)
+	}
+
 	if !slices.Equal(want.Experiments, got.Experiments) {
 		t.Fatalf("want.Experiments[%+v] != got.Experiments[%+v]", want.Experiments, got.Experiments)
 	}
@@ -337,15 +344,71 @@ func assertTerramateRunBlock(t *testing.T, got, want *hcl.RunConfig) {
 		"want.Run.CheckGenCode %v != got.Run.CheckGenCode %v",
 		want.CheckGenCode, got.CheckGenCode)
 
-	if (want.Env == nil) != (got.Env == nil) {
+	assert.IsTrue(t, want.Timeout == got.Timeout,
+		"want.Run.Timeout %v != got.Run.Timeout %v",
+		want.Timeout, got.Timeout)
+
+	AssertDiff(t, got.SensitiveEnv, want.SensitiveEnv, "run.sensitive_env mismatch")
+	AssertDiff(t, got.SensitiveGlobals, want.SensitiveGlobals, "run.sensitive_globals mismatch")
+	AssertDiff(t, got.MaskPatterns, want.MaskPatterns, "run.mask_patterns mismatch")
+	AssertDiff(t, got.InheritEnv, want.InheritEnv, "run.inherit_env mismatch")
+
+	if (want.EnvFiles == nil) != (got.EnvFiles == nil) {
+		t.Fatalf("want.Run.EnvFiles[%+v] != got.Run.EnvFiles[%+v]",
+			want.EnvFiles, got.EnvFiles)
+	}
+	if want.EnvFiles != nil {
+		assert.EqualStrings(t,
+			exprAsStr(t, want.EnvFiles.Expr),
+			exprAsStr(t, got.EnvFiles.Expr),
+			"run.env_files mismatch")
+	}
+
+	assertRunHook(t, "before", got.Before, want.Before)
+	assertRunHook(t, "after", got.After, want.After)
+
+	assertRunEnv(t, got.Env, want.Env)
+}
+
+func assertRunBlock(t *testing.T, got, want *hcl.Run) {
+	t.Helper()
+
+	if (want == nil) != (got == nil) {
+		t.Fatalf("want.Run[%+v] != got.Run[%+v]", want, got)
+	}
+
+	if want == nil {
+		return
+	}
+
+	if (want.Condition == nil) != (got.Condition == nil) {
+		t.Fatalf("want.Run.Condition[%+v] != got.Run.Condition[%+v]",
+			want.Condition, got.Condition)
+	}
+	if want.Condition != nil {
+		assert.EqualStrings(t,
+			exprAsStr(t, want.Condition.Expr),
+			exprAsStr(t, got.Condition.Expr),
+			"run.condition mismatch")
+	}
+
+	AssertDiff(t, got.SensitiveEnv, want.SensitiveEnv, "run.sensitive_env mismatch")
+
+	assertRunEnv(t, got.Env, want.Env)
+}
+
+func assertRunEnv(t *testing.T, got, want *hcl.RunEnv) {
+	t.Helper()
+
+	if (want == nil) != (got == nil) {
 		t.Fatalf(
 			"want.Run.Env[%+v] != got.Run.Env[%+v]",
-			want.Env,
-			got.Env,
+			want,
+			got,
 		)
 	}
 
-	if want.Env == nil {
+	if want == nil {
 		return
 	}
 
@@ -354,8 +417,8 @@ func assertTerramateRunBlock(t *testing.T, got, want *hcl.RunConfig) {
 	// So we do this hack in an attempt of comparing the attributes
 	// original expressions (no eval involved).
 
-	gotHCL := hclFromAttributes(t, got.Env.Attributes)
-	wantHCL := hclFromAttributes(t, want.Env.Attributes)
+	gotHCL := hclFromAttributes(t, got.Attributes)
+	wantHCL := hclFromAttributes(t, want.Attributes)
 
 	AssertDiff(t, gotHCL, wantHCL)
 }
@@ -376,6 +439,23 @@ func assertTerramateCloudBlock(t *testing.T, got, want *hcl.CloudConfig) {
 	}
 }
 
+func assertRunHook(t *testing.T, name string, got, want *hcl.RunHook) {
+	t.Helper()
+
+	if (want == nil) != (got == nil) {
+		t.Fatalf("want.Run.%s[%+v] != got.Run.%s[%+v]", name, want, name, got)
+	}
+
+	if want == nil {
+		return
+	}
+
+	assert.EqualStrings(t,
+		exprAsStr(t, want.Command.Expr),
+		exprAsStr(t, got.Command.Expr),
+		"run.%s.command mismatch", name)
+}
+
 // hclFromAttributes ensures that we always build the same HCL document
 // given an hcl.Attributes.
 func hclFromAttributes(t *testing.T, attrs ast.Attributes) string {
@@ -404,6 +484,27 @@ func assertStackBlock(t *testing.T, got, want *hcl.Stack) {
 	for i, w := range want.After {
 		assert.EqualStrings(t, w, got.After[i], "stack after mismatch")
 	}
+
+	assert.IsTrue(t, want.Timeout == got.Timeout,
+		"want.Timeout %v != got.Timeout %v", want.Timeout, got.Timeout)
+
+	assert.IsTrue(t, want.Disabled == got.Disabled,
+		"want.Disabled %v != got.Disabled %v", want.Disabled, got.Disabled)
+
+	assert.EqualInts(t, len(want.Variants), len(got.Variants), "Variants length mismatch")
+
+	for i, w := range want.Variants {
+		g := got.Variants[i]
+		assert.EqualStrings(t, w.Name, g.Name, "stack variant name mismatch")
+		assert.EqualStrings(t,
+			hclFromAttributes(t, w.Globals),
+			hclFromAttributes(t, g.Globals),
+			"stack.variant %q globals mismatch", w.Name)
+		assert.EqualStrings(t,
+			hclFromAttributes(t, w.Env),
+			hclFromAttributes(t, g.Env),
+			"stack.variant %q env mismatch", w.Name)
+	}
 }
 
 // WriteRootConfig writes a basic terramate root config.
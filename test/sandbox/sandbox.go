@@ -23,6 +23,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/madlambda/spells/assert"
@@ -694,6 +695,10 @@ func buildTree(t testing.TB, root *config.Root, environ []string, layout []strin
 				cfg.Stack.Description = value
 			case "tags":
 				cfg.Stack.Tags = parseListSpec(t, name, value)
+			case "timeout":
+				timeout, err := time.ParseDuration(value)
+				assert.NoError(t, err, "parsing stack timeout")
+				cfg.Stack.Timeout = timeout
 			default:
 				t.Fatalf("attribute " + parts[0] + " not supported.")
 			}